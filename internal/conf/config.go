@@ -5,15 +5,25 @@ import (
 	"gitee.com/RandolphCYG/akita/pkg/cache"
 	"gitee.com/RandolphCYG/akita/pkg/db"
 	"gitee.com/RandolphCYG/akita/pkg/email"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
 )
 
 // Config 全局配置文件 结构体的名称对应yaml文件中各配置的平台
 type Config struct {
-	System   System
-	Database db.Config
-	Redis    cache.Config
-	LdapCfg  model.LdapCfg
-	Email    email.Config
+	System       System
+	Database     db.Config
+	Redis        cache.Config
+	LdapCfg      model.LdapCfg
+	Email        email.Config
+	Sync         model.SyncThreshold
+	Hr           hr.SourceCfg
+	HrCache      model.HrCacheConfig
+	Offboarding  model.OffboardingConfig
+	WeworkDepart model.WeworkDepartConfig
+	Probation    model.ProbationConfig
+	TagRule      model.TagRuleConfig
+	Renewal      model.RenewalConfig
+	Notify       model.NotifyConfig
 }
 
 // System 系统配置
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"gitee.com/RandolphCYG/akita/internal/service/company"
+	"github.com/gin-gonic/gin"
+)
+
+type CompanySettingHandler interface {
+	Fetch(ctx *gin.Context)
+	Create(ctx *gin.Context)
+	Update(ctx *gin.Context)
+	Delete(ctx *gin.Context)
+}
+
+// companySettingField 公司配置字段
+type companySettingField struct {
+	Name string
+}
+
+func NewCompanySettingHandler() CompanySettingHandler {
+	return &companySettingField{}
+}
+
+// Fetch 查询全部公司配置
+func (csf companySettingField) Fetch(ctx *gin.Context) {
+	var service company.CompanySettingService
+	res := service.Fetch()
+	ctx.JSON(200, res)
+}
+
+// Create 增加公司配置
+func (csf companySettingField) Create(ctx *gin.Context) {
+	var service company.CompanySettingService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Create()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Update 修改公司配置
+func (csf companySettingField) Update(ctx *gin.Context) {
+	var service company.CompanySettingService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Update()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Delete 删除公司配置
+func (csf companySettingField) Delete(ctx *gin.Context) {
+	var service company.CompanySettingService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Delete()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 type HrUserHandler interface {
 	CacheHrUsersManual(ctx *gin.Context)
+	SendChangeReportManual(ctx *gin.Context)
 }
 
 // hrUserField 定时任务字段
@@ -27,3 +28,49 @@ func (hu hrUserField) CacheHrUsersManual(ctx *gin.Context) {
 		ctx.JSON(200, err)
 	}
 }
+
+// SendChangeReportManual 手动触发发送人员变化报告
+func (hu hrUserField) SendChangeReportManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := hruser.SendChangeReportManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type HrSnapshotHandler interface {
+	Fetch(ctx *gin.Context)
+	Diff(ctx *gin.Context)
+}
+
+// hrSnapshotField HR快照字段
+type hrSnapshotField struct {
+	Name string
+}
+
+func NewHrSnapshotHandler() HrSnapshotHandler {
+	return &hrSnapshotField{}
+}
+
+// Fetch 查询最近的HR快照
+func (hs hrSnapshotField) Fetch(ctx *gin.Context) {
+	var service hruser.SnapshotService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Diff 对比两份HR快照
+func (hs hrSnapshotField) Diff(ctx *gin.Context) {
+	var service hruser.SnapshotService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Diff()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"gitee.com/RandolphCYG/akita/internal/service/identity"
+	"github.com/gin-gonic/gin"
+)
+
+type IdentityHandler interface {
+	Fetch(ctx *gin.Context)
+}
+
+// identityField 身份登记字段
+type identityField struct {
+	Name string
+}
+
+func NewIdentityHandler() IdentityHandler {
+	return &identityField{}
+}
+
+// Fetch 查询一个人在各系统中的身份
+func (i identityField) Fetch(ctx *gin.Context) {
+	var service identity.IdentityService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
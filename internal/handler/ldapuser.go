@@ -8,6 +8,8 @@ import (
 type LdapUserHandler interface {
 	ScanExpiredLdapUsersManual(ctx *gin.Context)
 	SyncLdapUsersManual(ctx *gin.Context)
+	ScanPwdExpiringLdapUsersManual(ctx *gin.Context)
+	DeliverCredentialsManual(ctx *gin.Context)
 }
 
 // ldapUserField 定时任务字段
@@ -38,3 +40,71 @@ func (lu ldapUserField) SyncLdapUsersManual(ctx *gin.Context) {
 		ctx.JSON(200, err)
 	}
 }
+
+// ScanPwdExpiringLdapUsersManual 手动触发扫描密码即将过期的ldap用户
+func (lu ldapUserField) ScanPwdExpiringLdapUsersManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := ldapuser.ScanPwdExpiringUsersManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// DeliverCredentialsManual 手动触发发送新员工初始密码
+func (lu ldapUserField) DeliverCredentialsManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := ldapuser.DeliverCredentialsManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type LdapSyncPlanHandler interface {
+	Fetch(ctx *gin.Context)
+	Approve(ctx *gin.Context)
+	Reject(ctx *gin.Context)
+}
+
+// ldapSyncPlanField 同步变更计划字段
+type ldapSyncPlanField struct {
+	Name string
+}
+
+func NewLdapSyncPlanHandler() LdapSyncPlanHandler {
+	return &ldapSyncPlanField{}
+}
+
+// Fetch 查询变更计划
+func (lsp ldapSyncPlanField) Fetch(ctx *gin.Context) {
+	var service ldapuser.SyncPlanService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Approve 批准挂起的变更计划
+func (lsp ldapSyncPlanField) Approve(ctx *gin.Context) {
+	var service ldapuser.SyncPlanService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Approve()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Reject 驳回挂起的变更计划
+func (lsp ldapSyncPlanField) Reject(ctx *gin.Context) {
+	var service ldapuser.SyncPlanService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Reject()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"github.com/gin-gonic/gin"
+)
+
+type NotifyHandler interface {
+	FetchEvents(ctx *gin.Context)
+	FetchOutbox(ctx *gin.Context)
+	RetryOutbox(ctx *gin.Context)
+	FetchPreferences(ctx *gin.Context)
+	SavePreference(ctx *gin.Context)
+	DeletePreference(ctx *gin.Context)
+	FetchTemplates(ctx *gin.Context)
+	SaveTemplate(ctx *gin.Context)
+}
+
+// notifyField 通知字段
+type notifyField struct {
+	Name string
+}
+
+func NewNotifyHandler() NotifyHandler {
+	return &notifyField{}
+}
+
+// FetchEvents 查询全部通知事件
+func (nf notifyField) FetchEvents(ctx *gin.Context) {
+	res := notify.FetchEvents()
+	ctx.JSON(200, res)
+}
+
+// FetchOutbox 查询最近的消息
+func (nf notifyField) FetchOutbox(ctx *gin.Context) {
+	var service notify.OutboxService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// RetryOutbox 重试失败的消息
+func (nf notifyField) RetryOutbox(ctx *gin.Context) {
+	var service notify.OutboxService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Retry()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// FetchPreferences 查询通知偏好
+func (nf notifyField) FetchPreferences(ctx *gin.Context) {
+	var service notify.PreferenceService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// SavePreference 新增或修改通知偏好
+func (nf notifyField) SavePreference(ctx *gin.Context) {
+	var service notify.PreferenceService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Save()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// DeletePreference 删除通知偏好
+func (nf notifyField) DeletePreference(ctx *gin.Context) {
+	var service notify.PreferenceService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Delete()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// FetchTemplates 查询消息模板及可用参数
+func (nf notifyField) FetchTemplates(ctx *gin.Context) {
+	var service notify.TemplateService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// SaveTemplate 校验并保存消息模板
+func (nf notifyField) SaveTemplate(ctx *gin.Context) {
+	var service notify.TemplateService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Save()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"gitee.com/RandolphCYG/akita/internal/service/offboarding"
+	"github.com/gin-gonic/gin"
+)
+
+type OffboardingHandler interface {
+	ExecuteManual(ctx *gin.Context)
+	Fetch(ctx *gin.Context)
+	Retry(ctx *gin.Context)
+	FetchRehires(ctx *gin.Context)
+}
+
+// offboardingField 离职流程字段
+type offboardingField struct {
+	Name string
+}
+
+func NewOffboardingHandler() OffboardingHandler {
+	return &offboardingField{}
+}
+
+// ExecuteManual 手动触发执行离职任务
+func (o offboardingField) ExecuteManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := offboarding.ExecuteManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Fetch 查询离职任务
+func (o offboardingField) Fetch(ctx *gin.Context) {
+	var service offboarding.OffboardingService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Retry 重试失败的步骤
+func (o offboardingField) Retry(ctx *gin.Context) {
+	var service offboarding.OffboardingService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Retry()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// FetchRehires 查询复职记录
+func (o offboardingField) FetchRehires(ctx *gin.Context) {
+	var service offboarding.RehireService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/url"
+
+	"gitee.com/RandolphCYG/akita/internal/service/reconcile"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler interface {
+	ReconcileManual(ctx *gin.Context)
+	Fetch(ctx *gin.Context)
+	Download(ctx *gin.Context)
+}
+
+// reconcileField 身份核对字段
+type reconcileField struct {
+	Name string
+}
+
+func NewReconcileHandler() ReconcileHandler {
+	return &reconcileField{}
+}
+
+// ReconcileManual 手动触发身份核对
+func (rc reconcileField) ReconcileManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := reconcile.ReconcileManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Fetch 查询最近一次核对报告
+func (rc reconcileField) Fetch(ctx *gin.Context) {
+	var service reconcile.ReportService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Download 下载最近一次核对报告 csv或xlsx
+func (rc reconcileField) Download(ctx *gin.Context) {
+	var service reconcile.ReportService
+	if err := ctx.ShouldBind(&service); err != nil {
+		ctx.JSON(200, err)
+		return
+	}
+	filename, data, err := service.Download()
+	if err != nil {
+		ctx.JSON(200, serializer.Err(serializer.CodeParamErr, "导出核对报告失败", err))
+		return
+	}
+	ctx.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(filename))
+	ctx.Data(200, "application/octet-stream", data)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"gitee.com/RandolphCYG/akita/internal/service/wework"
+	"gitee.com/RandolphCYG/akita/web"
 	"github.com/gin-gonic/gin"
 )
 
@@ -38,6 +39,8 @@ type WeworkUserHandler interface {
 	CacheUsersManual(ctx *gin.Context)
 	ScanExpiredUsersManual(ctx *gin.Context)
 	ScanNewHrUsersManual(ctx *gin.Context)
+	SyncUsersManual(ctx *gin.Context)
+	SyncDeparts(ctx *gin.Context)
 }
 
 // weworkUserField 定时任务字段
@@ -78,3 +81,292 @@ func (wuf weworkUserField) ScanNewHrUsersManual(ctx *gin.Context) {
 		ctx.JSON(200, err)
 	}
 }
+
+// SyncUsersManual 手动触发以HR数据同步企业微信用户属性
+func (wuf weworkUserField) SyncUsersManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := wework.SyncUsersManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// SyncDeparts 同步HR部门结构到企业微信
+func (wuf weworkUserField) SyncDeparts(ctx *gin.Context) {
+	var service wework.DepartSyncService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Sync()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type WeworkTagHandler interface {
+	FetchProbations(ctx *gin.Context)
+	ScanProbationManual(ctx *gin.Context)
+	FetchRules(ctx *gin.Context)
+	CreateRule(ctx *gin.Context)
+	UpdateRule(ctx *gin.Context)
+	DeleteRule(ctx *gin.Context)
+	ApplyRules(ctx *gin.Context)
+}
+
+// weworkTagField 企微标签字段
+type weworkTagField struct {
+	Name string
+}
+
+func NewWeworkTagHandler() WeworkTagHandler {
+	return &weworkTagField{}
+}
+
+// FetchProbations 查询试用期记录
+func (wtf weworkTagField) FetchProbations(ctx *gin.Context) {
+	var service wework.ProbationService
+	if err := ctx.ShouldBind(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// ScanProbationManual 手动触发扫描试用期员工
+func (wtf weworkTagField) ScanProbationManual(ctx *gin.Context) {
+	if err := ctx.ShouldBind(0); err == nil {
+		res := wework.ScanProbationManual()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// FetchRules 查询全部标签规则
+func (wtf weworkTagField) FetchRules(ctx *gin.Context) {
+	var service wework.TagRuleService
+	res := service.Fetch()
+	ctx.JSON(200, res)
+}
+
+// CreateRule 增加标签规则
+func (wtf weworkTagField) CreateRule(ctx *gin.Context) {
+	var service wework.TagRuleService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Create()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// UpdateRule 修改标签规则
+func (wtf weworkTagField) UpdateRule(ctx *gin.Context) {
+	var service wework.TagRuleService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Update()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// DeleteRule 删除标签规则
+func (wtf weworkTagField) DeleteRule(ctx *gin.Context) {
+	var service wework.TagRuleService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Delete()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// ApplyRules 按标签规则更新标签成员
+func (wtf weworkTagField) ApplyRules(ctx *gin.Context) {
+	var service wework.TagRuleService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Apply()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type WeworkPwdHandler interface {
+	Page(ctx *gin.Context)
+	Auth(ctx *gin.Context)
+	Modify(ctx *gin.Context)
+	SendResetCode(ctx *gin.Context)
+	Reset(ctx *gin.Context)
+}
+
+// weworkPwdField 企微自助修改密码字段
+type weworkPwdField struct {
+	Name string
+}
+
+func NewWeworkPwdHandler() WeworkPwdHandler {
+	return &weworkPwdField{}
+}
+
+// Page 自助修改密码H5页面 企微OAuth回调地址
+func (wpf weworkPwdField) Page(ctx *gin.Context) {
+	ctx.Data(200, "text/html; charset=utf-8", web.PwdPage)
+}
+
+// Auth 企微OAuth认证
+func (wpf weworkPwdField) Auth(ctx *gin.Context) {
+	var service wework.PwdService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Auth()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Modify 自助修改密码
+func (wpf weworkPwdField) Modify(ctx *gin.Context) {
+	var service wework.PwdService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Modify()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// SendResetCode 发送重置密码验证码
+func (wpf weworkPwdField) SendResetCode(ctx *gin.Context) {
+	var service wework.PwdService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.SendResetCode()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Reset 验证码校验通过后重置密码
+func (wpf weworkPwdField) Reset(ctx *gin.Context) {
+	var service wework.PwdService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Reset()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type WeworkRenewalHandler interface {
+	Page(ctx *gin.Context)
+	Fetch(ctx *gin.Context)
+	Apply(ctx *gin.Context)
+}
+
+// weworkRenewalField 企微一键续期字段
+type weworkRenewalField struct {
+	Name string
+}
+
+func NewWeworkRenewalHandler() WeworkRenewalHandler {
+	return &weworkRenewalField{}
+}
+
+// Page 账号续期审批H5页面 企微OAuth回调地址
+func (wrf weworkRenewalField) Page(ctx *gin.Context) {
+	ctx.Data(200, "text/html; charset=utf-8", web.RenewalPage)
+}
+
+// Fetch 查询待续期的账号
+func (wrf weworkRenewalField) Fetch(ctx *gin.Context) {
+	var service wework.RenewalApplyService
+	if err := ctx.ShouldBindQuery(&service); err == nil {
+		res := service.Fetch()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+// Apply 企微OAuth认证后提交账号续期审批
+func (wrf weworkRenewalField) Apply(ctx *gin.Context) {
+	var service wework.RenewalApplyService
+	if err := ctx.ShouldBindJSON(&service); err == nil {
+		res := service.Apply()
+		ctx.JSON(200, res)
+	} else {
+		ctx.JSON(200, err)
+	}
+}
+
+type WeworkCallbackHandler interface {
+	VerifyContact(ctx *gin.Context)
+	HandleContact(ctx *gin.Context)
+	VerifyApp(ctx *gin.Context)
+	HandleApp(ctx *gin.Context)
+}
+
+// weworkCallbackField 企微回调字段
+type weworkCallbackField struct {
+	Name string
+}
+
+func NewWeworkCallbackHandler() WeworkCallbackHandler {
+	return &weworkCallbackField{}
+}
+
+// VerifyContact 校验通讯录变更回调地址 原样返回解密后的echostr
+func (wcf weworkCallbackField) VerifyContact(ctx *gin.Context) {
+	verifyCallback(ctx, (*wework.CallbackService).VerifyContact)
+}
+
+// HandleContact 接收通讯录变更事件 应答success后异步处理
+func (wcf weworkCallbackField) HandleContact(ctx *gin.Context) {
+	handleCallback(ctx, (*wework.CallbackService).HandleContact)
+}
+
+// VerifyApp 校验UUAP公告应用回调地址 原样返回解密后的echostr
+func (wcf weworkCallbackField) VerifyApp(ctx *gin.Context) {
+	verifyCallback(ctx, (*wework.CallbackService).VerifyApp)
+}
+
+// HandleApp 接收UUAP公告应用的模板卡片事件 应答success后异步处理
+func (wcf weworkCallbackField) HandleApp(ctx *gin.Context) {
+	handleCallback(ctx, (*wework.CallbackService).HandleApp)
+}
+
+// verifyCallback 校验回调地址 企业微信要求应答明文echostr
+func verifyCallback(ctx *gin.Context, verify func(*wework.CallbackService) (string, error)) {
+	var service wework.CallbackService
+	if err := ctx.ShouldBindQuery(&service); err != nil {
+		ctx.String(400, err.Error())
+		return
+	}
+	echo, err := verify(&service)
+	if err != nil {
+		ctx.String(400, err.Error())
+		return
+	}
+	ctx.String(200, echo)
+}
+
+// handleCallback 接收回调事件 企业微信要求应答success
+func handleCallback(ctx *gin.Context, handle func(*wework.CallbackService, []byte) error) {
+	var service wework.CallbackService
+	if err := ctx.ShouldBindQuery(&service); err != nil {
+		ctx.String(400, err.Error())
+		return
+	}
+	body, err := ctx.GetRawData()
+	if err == nil {
+		err = handle(&service, body)
+	}
+	if err != nil {
+		ctx.String(400, err.Error())
+		return
+	}
+	ctx.String(200, "success")
+}
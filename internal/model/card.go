@@ -0,0 +1,110 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 模板卡片任务 发送带按钮的卡片时记录 用户点击后按task_id找到卡片对应的账号并处理
+* 一键续期策略 即将过期的账号本人或申请人、担保人点击卡片按钮直接续期
+*
+ */
+
+const (
+	CardKindRenewal = "renewal" // 账号即将过期 本人一键续期
+	CardKindSponsor = "sponsor" // 申请人与担保人确认续期
+
+	CardPending    = "pending"    // 待点击
+	CardProcessing = "processing" // 已点击 处理中
+	CardDone       = "done"       // 已处理
+
+	defaultRenewalDays      = 30
+	defaultRenewalMaxTimes  = 2
+	defaultRenewalAheadDays = 14
+)
+
+var (
+	// RenewalCfg 一键续期配置
+	RenewalCfg RenewalConfig
+)
+
+// RenewalConfig 一键续期配置 0使用默认值
+type RenewalConfig struct {
+	Days      int // 每次续期天数 从原过期时间起算
+	MaxTimes  int // 一年内本人自助续期的最多次数 超过后须申请人、担保人确认或提交审批
+	AheadDays int // 距离过期不超过该天数时才可续期
+}
+
+// RenewalDays 每次续期天数
+func (c RenewalConfig) RenewalDays() int {
+	if c.Days <= 0 {
+		return defaultRenewalDays
+	}
+	return c.Days
+}
+
+// RenewalMaxTimes 一年内本人自助续期的最多次数
+func (c RenewalConfig) RenewalMaxTimes() int {
+	if c.MaxTimes <= 0 {
+		return defaultRenewalMaxTimes
+	}
+	return c.MaxTimes
+}
+
+// RenewalAheadDays 距离过期不超过该天数时才可续期
+func (c RenewalConfig) RenewalAheadDays() int {
+	if c.AheadDays <= 0 {
+		return defaultRenewalAheadDays
+	}
+	return c.AheadDays
+}
+
+// CardTask 模板卡片任务
+type CardTask struct {
+	gorm.Model
+	TaskId  string     `json:"task_id" gorm:"type:varchar(128);uniqueIndex;not null;comment:卡片task_id"`
+	Kind    string     `json:"kind" gorm:"type:varchar(50);not null;comment:类别 renewal 本人一键续期 sponsor 申请人与担保人确认续期"`
+	Userid  string     `json:"userid" gorm:"type:varchar(255);index;not null;comment:卡片接收人企微userid"`
+	Payload string     `json:"payload" gorm:"type:text;comment:卡片对应的账号 json"`
+	Status  string     `json:"status" gorm:"type:varchar(50);not null;comment:状态 pending 待点击 processing 处理中 done 已处理"`
+	Result  string     `json:"result" gorm:"type:text;comment:处理结果 每个账号一行"`
+	DoneAt  *time.Time `json:"done_at" gorm:"comment:处理时间"`
+}
+
+// CreateCardTask 生成task_id并记录卡片任务
+func CreateCardTask(kind, userid string, payload []byte) (task CardTask, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	task = CardTask{TaskId: kind + "_" + hex.EncodeToString(b), Kind: kind, Userid: userid, Payload: string(payload), Status: CardPending}
+	err = DB.Create(&task).Error
+	return
+}
+
+// FetchCardTask 根据task_id查询卡片任务
+func FetchCardTask(taskId string) (task CardTask, err error) {
+	err = DB.Where("task_id = ?", taskId).First(&task).Error
+	return
+}
+
+// ClaimCardTask 将待点击的任务置为处理中 重复点击或回调重试时返回false
+func ClaimCardTask(task *CardTask) bool {
+	result := DB.Model(&CardTask{}).Where("id = ? AND status = ?", task.ID, CardPending).Update("status", CardProcessing)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	task.Status = CardProcessing
+	return true
+}
+
+// FinishCardTask 记录处理结果
+func FinishCardTask(task *CardTask, result string) error {
+	now := time.Now()
+	task.Status, task.Result, task.DoneAt = CardDone, result, &now
+	return DB.Model(task).Updates(map[string]interface{}{"status": task.Status, "result": task.Result, "done_at": task.DoneAt}).Error
+}
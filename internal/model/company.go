@@ -0,0 +1,122 @@
+package model
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 公司配置 各公司新账号的企业微信部门、标签、C7N默认项目和有效期
+* 数据库为准 启动及增删改后加载到内存
+*
+ */
+
+var (
+	companySettings   []CompanySetting
+	companySettingsMu sync.RWMutex
+
+	// DefaultCompanySettings 无公司配置时写入的默认配置 本公司与外部公司各一条
+	DefaultCompanySettings = []CompanySetting{
+		{IsOuter: false, HrCompanyCode: "2600", WeworkDepartId: 69, WeworkDepartName: "新加入待分配", WeworkTagId: 36, WeworkTagName: "试用期员工", C7nProjectId: "4"},
+		{IsOuter: true, WeworkDepartId: 79, WeworkDepartName: "合作伙伴", C7nProjectId: "4", ExpireDays: 90},
+	}
+)
+
+// CompanySetting 公司配置 公司名称为空的是同类(本公司或外部公司)的默认配置
+type CompanySetting struct {
+	gorm.Model
+	Company          string `json:"company" gorm:"type:varchar(255);uniqueIndex:idx_company_outer;not null;default:'';comment:公司名称 与工单和HR数据一致 为空表示同类公司的默认配置"`
+	IsOuter          bool   `json:"is_outer" gorm:"uniqueIndex:idx_company_outer;not null;default:false;comment:是否外部公司"`
+	HrCompanyCode    string `json:"hr_company_code" gorm:"type:varchar(100);index;comment:HR公司代码 配置后为该公司HR在职员工自动创建企业微信账号"`
+	WeworkDepartId   int    `json:"wework_depart_id" gorm:"type:int;not null;comment:新账号默认企业微信部门id"`
+	WeworkDepartName string `json:"wework_depart_name" gorm:"type:varchar(255);comment:企业微信部门名称 保存时校验并填写"`
+	WeworkTagId      int    `json:"wework_tag_id" gorm:"type:int;not null;default:0;comment:新账号企业微信标签id 0不打标签"`
+	WeworkTagName    string `json:"wework_tag_name" gorm:"type:varchar(255);comment:企业微信标签名称 保存时校验并填写"`
+	C7nProjectId     string `json:"c7n_project_id" gorm:"type:varchar(100);comment:C7N默认项目id 为空不分配"`
+	C7nProjectName   string `json:"c7n_project_name" gorm:"type:varchar(255);comment:C7N项目名称 保存时校验并填写"`
+	ExpireDays       int    `json:"expire_days" gorm:"type:int;not null;default:0;comment:新账号有效天数 0永不过期"`
+}
+
+// InitCompanySettings 无公司配置时写入默认配置 并加载到内存
+func InitCompanySettings() {
+	if result := DB.Limit(1).Find(&[]CompanySetting{}); result.RowsAffected == 0 {
+		DB.Create(&DefaultCompanySettings)
+	}
+	LoadCompanySettings()
+}
+
+// LoadCompanySettings 从数据库加载公司配置到内存
+func LoadCompanySettings() error {
+	var settings []CompanySetting
+	if err := DB.Find(&settings).Error; err != nil {
+		return err
+	}
+	companySettingsMu.Lock()
+	companySettings = settings
+	companySettingsMu.Unlock()
+	return nil
+}
+
+// FetchCompanySetting 按公司名称查找配置 没有则使用同类公司的默认配置
+func FetchCompanySetting(company string, isOuter bool) (setting CompanySetting, ok bool) {
+	companySettingsMu.RLock()
+	defer companySettingsMu.RUnlock()
+	for _, s := range companySettings {
+		if s.Company != "" && s.Company == company {
+			return s, true
+		}
+		if s.Company == "" && s.IsOuter == isOuter {
+			setting, ok = s, true
+		}
+	}
+	return
+}
+
+// FetchCompanySettingByHrCode 按HR公司代码查找配置 没有配置的公司不自动创建企业微信账号
+func FetchCompanySettingByHrCode(code string) (setting CompanySetting, ok bool) {
+	companySettingsMu.RLock()
+	defer companySettingsMu.RUnlock()
+	for _, s := range companySettings {
+		if code != "" && s.HrCompanyCode == code {
+			return s, true
+		}
+	}
+	return
+}
+
+// FetchCompanySettings 查询全部公司配置
+func FetchCompanySettings() (settings []CompanySetting, err error) {
+	err = DB.Order("is_outer, company").Find(&settings).Error
+	return
+}
+
+// SaveCompanySetting 新增或修改公司配置 并重新加载 修改时只更新配置字段 保留创建时间
+func SaveCompanySetting(setting *CompanySetting) error {
+	if setting.ID == 0 {
+		if err := DB.Create(setting).Error; err != nil {
+			return err
+		}
+		return LoadCompanySettings()
+	}
+	result := DB.Model(setting).Select("company", "is_outer", "hr_company_code", "wework_depart_id", "wework_depart_name",
+		"wework_tag_id", "wework_tag_name", "c7n_project_id", "c7n_project_name", "expire_days").Updates(setting)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := DB.First(setting, setting.ID).Error; err != nil {
+		return err
+	}
+	return LoadCompanySettings()
+}
+
+// DeleteCompanySetting 删除公司配置 并重新加载
+func DeleteCompanySetting(id uint) error {
+	if err := DB.Unscoped().Delete(&CompanySetting{}, id).Error; err != nil {
+		return err
+	}
+	return LoadCompanySettings()
+}
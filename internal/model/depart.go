@@ -0,0 +1,64 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+/*
+* 企业微信部门同步 HR部门路径与企业微信部门id的对应关系
+*
+ */
+
+var (
+	// WeworkDepartCfg 企业微信部门同步配置
+	WeworkDepartCfg WeworkDepartConfig
+)
+
+// WeworkDepartConfig 企业微信部门同步配置 0使用默认值
+type WeworkDepartConfig struct {
+	RootId int // HR一级部门所在的企业微信部门id 默认为根部门1
+}
+
+// WeworkDepartMapping HR部门路径与企业微信部门的对应关系
+type WeworkDepartMapping struct {
+	gorm.Model
+	Path     string `json:"path" gorm:"type:varchar(500);uniqueIndex;not null;comment:HR部门路径 以.分隔"`
+	DepartId int    `json:"depart_id" gorm:"type:int;index;not null;comment:企业微信部门id"`
+	Name     string `json:"name" gorm:"type:varchar(255);not null;comment:部门名称"`
+}
+
+// FetchWeworkDepartMapping 按HR部门路径查询企业微信部门
+func FetchWeworkDepartMapping(path string) (mapping WeworkDepartMapping, err error) {
+	err = DB.Where("path = ?", path).First(&mapping).Error
+	return
+}
+
+// FetchWeworkDepartMappings 查询全部对应关系
+func FetchWeworkDepartMappings() (mappings []WeworkDepartMapping, err error) {
+	err = DB.Order("path").Find(&mappings).Error
+	return
+}
+
+// SaveWeworkDepartMapping 保存HR部门路径对应的企业微信部门 已存在则更新
+func SaveWeworkDepartMapping(path string, departId int, name string) error {
+	var mapping WeworkDepartMapping
+	DB.Where("path = ?", path).Limit(1).Find(&mapping)
+	mapping.Path, mapping.DepartId, mapping.Name = path, departId, name
+	return DB.Save(&mapping).Error
+}
+
+// FetchWeworkDepartMappingsByDepartId 按企业微信部门id查询对应关系
+func FetchWeworkDepartMappingsByDepartId(departId int) (mappings []WeworkDepartMapping, err error) {
+	err = DB.Where("depart_id = ?", departId).Find(&mappings).Error
+	return
+}
+
+// DeleteWeworkDepartMappingsByDepartId 企业微信部门被删除时删除其对应关系
+func DeleteWeworkDepartMappingsByDepartId(departId int) error {
+	return DB.Unscoped().Where("depart_id = ?", departId).Delete(&WeworkDepartMapping{}).Error
+}
+
+// DeleteWeworkDepartMapping 删除HR部门路径的对应关系
+func DeleteWeworkDepartMapping(path string) error {
+	return DB.Unscoped().Where("path = ?", path).Delete(&WeworkDepartMapping{}).Error
+}
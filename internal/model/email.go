@@ -21,9 +21,16 @@ func DeleteEmailTemplate(key string) {
 	DB.Where("key = ?", key).Delete(&EmailTemplate{})
 }
 
-// UpdateEmailTemplate 改 邮件模板
-func UpdateEmailTemplate(key, value string) {
-	DB.Model(&WeworkMsgTemplate{}).Create(&EmailTemplate{Key: key, Value: value})
+// UpdateEmailTemplate 改 邮件模板 不存在时新增
+func UpdateEmailTemplate(key, value string) error {
+	var count int64
+	if err := DB.Model(&EmailTemplate{}).Where(&EmailTemplate{Key: key}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return DB.Create(&EmailTemplate{Key: key, Value: value}).Error
+	}
+	return DB.Model(&EmailTemplate{}).Where(&EmailTemplate{Key: key}).Update("value", value).Error
 }
 
 // FetchEmailTemplate 查 邮件模板
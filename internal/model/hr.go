@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+)
+
+var (
+	// HrSourceCfg HR数据源配置 默认使用数据库中的HR接口连接信息
+	HrSourceCfg hr.SourceCfg
+	// HrCacheCfg HR缓存刷新校验与快照配置
+	HrCacheCfg HrCacheConfig
+)
+
+// HrCacheConfig HR缓存刷新前的校验阈值与快照保留数 0使用默认值
+type HrCacheConfig struct {
+	MinUsers         int // 最少人数 少于则不替换缓存
+	MaxChangePercent int // 新增与消失的人数占原人数的最大百分比 超过则不替换缓存 负数不限制
+	KeepSnapshots    int // 数据库中保留的快照数
+}
+
+// HrSnapshot HR数据快照 每次成功刷新缓存后保存 用于对比与审计
+type HrSnapshot struct {
+	gorm.Model
+	Version string `json:"version" gorm:"type:varchar(50);uniqueIndex;not null;comment:缓存版本"`
+	Mode    string `json:"mode" gorm:"type:varchar(50);not null;comment:刷新方式 full 全量 incremental 增量"`
+	Total   int    `json:"total" gorm:"type:int;not null;comment:人数"`
+	Data    string `json:"data,omitempty" gorm:"type:longtext;comment:HR用户json"`
+}
+
+// CreateHrSnapshot 保存快照并只保留最近keep份
+func CreateHrSnapshot(s *HrSnapshot, keep int) (err error) {
+	if err = DB.Create(s).Error; err != nil {
+		return
+	}
+	var ids []uint
+	DB.Model(&HrSnapshot{}).Order("id desc").Pluck("id", &ids)
+	if len(ids) > keep {
+		err = DB.Unscoped().Delete(&HrSnapshot{}, ids[keep:]).Error
+	}
+	return
+}
+
+// FetchHrSnapshot 查询快照及数据
+func FetchHrSnapshot(id uint) (s HrSnapshot, err error) {
+	err = DB.First(&s, id).Error
+	return
+}
+
+// FetchHrSnapshots 查询最近的快照 不含数据
+func FetchHrSnapshots(limit int) (snapshots []HrSnapshot, err error) {
+	err = DB.Omit("data").Order("id desc").Limit(limit).Find(&snapshots).Error
+	return
+}
+
+// FetchLatestHrSnapshot 查询最新的快照及数据
+func FetchLatestHrSnapshot() (s HrSnapshot, err error) {
+	err = DB.Order("id desc").First(&s).Error
+	return
+}
+
+// FetchHrSnapshotBefore 查询某时间之前最新的快照及数据
+func FetchHrSnapshotBefore(t time.Time) (s HrSnapshot, err error) {
+	err = DB.Where("created_at < ?", t).Order("id desc").First(&s).Error
+	return
+}
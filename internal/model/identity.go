@@ -0,0 +1,88 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+* 身份登记 以工号关联同一个人在各系统中的账号
+*
+ */
+
+const (
+	IdentityActive   = "active"   // 在职或账号有效
+	IdentityDisabled = "disabled" // 账号已过期禁用
+	IdentityLeft     = "left"     // 已离职
+)
+
+// Identity 一个人在各系统中的身份 工号与AD的employeeNumber、企业微信的工号扩展属性一致 外部公司带前缀
+type Identity struct {
+	gorm.Model
+	Eid          string `json:"eid" gorm:"type:varchar(100);uniqueIndex;not null;comment:工号 外部公司带前缀"`
+	Name         string `json:"name" gorm:"type:varchar(100);comment:真实姓名"`
+	Company      string `json:"company" gorm:"type:varchar(128);comment:公司"`
+	AdDn         string `json:"ad_dn" gorm:"type:varchar(255);comment:AD用户dn"`
+	AdSam        string `json:"ad_sam" gorm:"type:varchar(128);index;comment:AD SAM账号"`
+	WeworkUserid string `json:"wework_userid" gorm:"type:varchar(128);index;comment:企业微信userid"`
+	C7nUserId    string `json:"c7n_user_id" gorm:"type:varchar(100);comment:C7N用户id"`
+	SponsorEid   string `json:"sponsor_eid" gorm:"type:varchar(100);comment:担保人工号"`
+	State        string `json:"state" gorm:"type:varchar(50);comment:状态 active 有效 disabled 过期禁用 left 离职"`
+}
+
+// SaveIdentity 按工号新建或更新部分字段 values的键为列名
+func SaveIdentity(eid string, values map[string]interface{}) error {
+	if eid == "" {
+		return nil
+	}
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Identity{Eid: eid}).Error; err != nil {
+		return err
+	}
+	return DB.Model(&Identity{}).Where("eid = ?", eid).Updates(values).Error
+}
+
+// SaveIdentities 按工号批量新建或更新 只更新columns中的列
+func SaveIdentities(rows []Identity, columns ...string) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "eid"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).CreateInBatches(rows, 500).Error
+}
+
+// FetchIdentity 按工号查询身份
+func FetchIdentity(eid string) (identity Identity, err error) {
+	err = DB.Where("eid = ?", eid).First(&identity).Error
+	return
+}
+
+// FetchIdentityEidsByState 查询某状态的全部工号
+func FetchIdentityEidsByState(state string) (eids map[string]bool, err error) {
+	var rows []string
+	if err = DB.Model(&Identity{}).Where("state = ?", state).Pluck("eid", &rows).Error; err != nil {
+		return
+	}
+	eids = make(map[string]bool, len(rows))
+	for _, eid := range rows {
+		eids[eid] = true
+	}
+	return
+}
+
+// FetchIdentities 按工号、SAM账号、企业微信userid或姓名查询身份
+func FetchIdentities(query Identity) (identities []Identity, err error) {
+	db := DB.Model(&Identity{})
+	if query.Eid != "" {
+		db = db.Where("eid = ?", query.Eid)
+	}
+	if query.AdSam != "" {
+		db = db.Where("ad_sam = ?", query.AdSam)
+	}
+	if query.WeworkUserid != "" {
+		db = db.Where("wework_userid = ?", query.WeworkUserid)
+	}
+	if query.Name != "" {
+		db = db.Where("name = ?", query.Name)
+	}
+	err = db.Limit(100).Find(&identities).Error
+	return
+}
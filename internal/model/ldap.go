@@ -2,7 +2,7 @@ package model
 
 import (
 	"crypto/tls"
-
+	"encoding/json"
 	"time"
 
 	ldappool "github.com/RandolphCYG/ldapPool"
@@ -10,6 +10,7 @@ import (
 	"gorm.io/gorm"
 
 	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/pkg/util"
 )
 
 var (
@@ -37,8 +38,9 @@ type LdapCfg struct {
 
 // CompanyType 公司类型
 type CompanyType struct {
-	IsOuter bool   `json:"is_outer"` // 是否外部公司
-	Prefix  string `json:"prefix"`   // 用户名前缀 外部公司才有
+	IsOuter   bool            `json:"is_outer"`             // 是否外部公司
+	Prefix    string          `json:"prefix"`               // 用户名前缀 外部公司才有
+	PwdPolicy *util.PwdPolicy `json:"pwd_policy,omitempty"` // 密码策略 不配置则使用默认策略
 }
 
 // LdapField LDAP服务器字段配置
@@ -88,6 +90,18 @@ type LdapField struct {
 	UserGroupDescription string `json:"user_group_description" gorm:"type:varchar(255);not null;comment:用户组描述"`
 }
 
+// PwdPolicy 根据公司查询密码策略 公司未配置则使用默认策略
+func (f LdapField) PwdPolicy(company string) util.PwdPolicy {
+	var companyTypes map[string]CompanyType
+	if err := json.Unmarshal([]byte(f.CompanyType), &companyTypes); err != nil {
+		return util.DefaultPwdPolicy
+	}
+	if c, ok := companyTypes[company]; ok && c.PwdPolicy != nil {
+		return *c.PwdPolicy
+	}
+	return util.DefaultPwdPolicy
+}
+
 // Init 初始化连接池
 func Init(c *LdapCfg) (err error) {
 	LdapCfgs = LdapCfg{
@@ -189,3 +203,54 @@ func FetchLdapUserDepartRecord(offsetBefore, offsetAfter int) (ldapUserDepartRec
 	_ = DB.Where("created_at BETWEEN ? AND ?", begin, end).Find(&ldapUserDepartRecords)
 	return
 }
+
+// LdapUserAttrRecord LDAP用户属性变化记录
+type LdapUserAttrRecord struct {
+	gorm.Model
+	Name     string `json:"name" gorm:"type:varchar(255);not null;comment:真实姓名"`
+	Eid      string `json:"eid" gorm:"type:varchar(255);not null;comment:工号"`
+	Attr     string `json:"attr" gorm:"type:varchar(255);not null;comment:属性"`
+	OldValue string `json:"old_value" gorm:"type:varchar(255);comment:旧值"`
+	NewValue string `json:"new_value" gorm:"type:varchar(255);comment:新值"`
+}
+
+// CreateLdapUserAttrRecord 用户属性变化记录
+func CreateLdapUserAttrRecord(name, eid, attr, oldValue, newValue string) {
+	DB.Model(&LdapUserAttrRecord{}).Create(&LdapUserAttrRecord{Name: name, Eid: eid, Attr: attr, OldValue: oldValue, NewValue: newValue})
+}
+
+const (
+	CredentialPending   = "pending"   // 等待企业微信账号创建
+	CredentialDelivered = "delivered" // 已发送初始密码
+	CredentialFailed    = "failed"    // 发送失败 等待重试
+)
+
+// LdapCredentialDelivery HR同步自动创建的LDAP账号 初始密码待发送到新员工企业微信
+type LdapCredentialDelivery struct {
+	gorm.Model
+	Sam         string     `json:"sam" gorm:"type:varchar(128);uniqueIndex;not null;comment:SAM账号"`
+	Name        string     `json:"name" gorm:"type:varchar(255);not null;comment:真实姓名"`
+	Eid         string     `json:"eid" gorm:"type:varchar(255);not null;comment:工号"`
+	Dn          string     `json:"dn" gorm:"type:varchar(255);not null;comment:用户dn"`
+	Company     string     `json:"company" gorm:"type:varchar(128);comment:公司 决定密码策略"`
+	Status      string     `json:"status" gorm:"type:varchar(50);not null;comment:状态 pending 等待企微账号 delivered 已发送 failed 发送失败"`
+	Result      string     `json:"result" gorm:"type:varchar(255);comment:发送结果"`
+	DeliveredAt *time.Time `json:"delivered_at" gorm:"comment:发送时间"`
+}
+
+// CreateLdapCredentialDelivery 新建初始密码发送任务 同一账号只保留一条
+func CreateLdapCredentialDelivery(d LdapCredentialDelivery) {
+	d.Status = CredentialPending
+	DB.Where(LdapCredentialDelivery{Sam: d.Sam}).Assign(d).FirstOrCreate(&LdapCredentialDelivery{})
+}
+
+// FetchUndeliveredLdapCredentials 查询尚未发送初始密码的账号
+func FetchUndeliveredLdapCredentials() (deliveries []LdapCredentialDelivery, err error) {
+	err = DB.Where("status <> ?", CredentialDelivered).Find(&deliveries).Error
+	return
+}
+
+// UpdateLdapCredentialDelivery 更新初始密码发送状态
+func UpdateLdapCredentialDelivery(d *LdapCredentialDelivery) {
+	DB.Model(d).Updates(map[string]interface{}{"status": d.Status, "result": d.Result, "delivered_at": d.DeliveredAt})
+}
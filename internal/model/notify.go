@@ -0,0 +1,160 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 通知发件箱 每条通知的每个渠道一条 先记录再发送 失败的由定时任务按退避重试
+* 通知偏好 个人按事件选择接收渠道
+*
+ */
+
+const (
+	NotifyPending = "pending" // 待发送或待重试
+	NotifySent    = "sent"    // 已送达
+	NotifyFailed  = "failed"  // 重试耗尽或敏感消息发送失败
+
+	ChannelRobot = "robot" // 企微群机器人
+
+	defaultNotifyMaxAttempts    = 5
+	defaultNotifyBackoffSeconds = 60
+	defaultNotifyRetentionDays  = 30
+)
+
+var (
+	// NotifyCfg 通知配置
+	NotifyCfg NotifyConfig
+)
+
+// NotifyConfig 通知配置 0使用默认值
+type NotifyConfig struct {
+	MaxAttempts    int // 每条消息的最大尝试次数
+	BackoffSeconds int // 首次重试的间隔 之后每次翻倍 最长1小时
+	RetentionDays  int // 已送达消息的保留天数
+}
+
+// NotifyMaxAttempts 每条消息的最大尝试次数
+func (c NotifyConfig) NotifyMaxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return defaultNotifyMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+// NotifyBackoff 第attempts次失败后的重试间隔
+func (c NotifyConfig) NotifyBackoff(attempts int) time.Duration {
+	seconds := c.BackoffSeconds
+	if seconds <= 0 {
+		seconds = defaultNotifyBackoffSeconds
+	}
+	backoff := time.Duration(seconds) * time.Second
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+// NotifyRetentionDays 已送达消息的保留天数
+func (c NotifyConfig) NotifyRetentionDays() int {
+	if c.RetentionDays <= 0 {
+		return defaultNotifyRetentionDays
+	}
+	return c.RetentionDays
+}
+
+// NotifyOutbox 通知发件箱
+type NotifyOutbox struct {
+	gorm.Model
+	EventKey  string     `json:"event_key" gorm:"type:varchar(100);index;not null;comment:通知事件"`
+	Channel   string     `json:"channel" gorm:"type:varchar(50);not null;comment:渠道 wework 企微应用消息 email 邮件 robot 群机器人"`
+	Target    string     `json:"target" gorm:"type:varchar(1000);comment:接收人 企微userid或邮箱 多个用逗号分隔"`
+	Subject   string     `json:"subject" gorm:"type:varchar(255);comment:邮件标题"`
+	Content   string     `json:"content" gorm:"type:mediumtext;comment:消息内容 敏感消息不保存"`
+	Sensitive bool       `json:"sensitive" gorm:"not null;default:false;comment:是否敏感消息 不保存内容 不重试"`
+	Status    string     `json:"status" gorm:"type:varchar(50);index;not null;comment:状态 pending 待发送 sent 已送达 failed 失败"`
+	Attempts  int        `json:"attempts" gorm:"type:int;not null;default:0;comment:已尝试次数"`
+	NextAt    time.Time  `json:"next_at" gorm:"index;comment:下次尝试时间"`
+	LastError string     `json:"last_error" gorm:"type:varchar(1000);comment:最近一次错误"`
+	SentAt    *time.Time `json:"sent_at" gorm:"comment:送达时间"`
+}
+
+// CreateNotifyOutbox 记录待发送的消息
+func CreateNotifyOutbox(o *NotifyOutbox) error {
+	return DB.Create(o).Error
+}
+
+// UpdateNotifyOutbox 更新发送结果
+func UpdateNotifyOutbox(o *NotifyOutbox) {
+	DB.Model(o).Updates(map[string]interface{}{
+		"status":     o.Status,
+		"attempts":   o.Attempts,
+		"next_at":    o.NextAt,
+		"last_error": o.LastError,
+		"sent_at":    o.SentAt,
+	})
+}
+
+// FetchDueNotifyOutbox 查询到期待重试的消息
+func FetchDueNotifyOutbox(limit int) (outbox []NotifyOutbox, err error) {
+	err = DB.Where("status = ? AND next_at <= ?", NotifyPending, time.Now()).Order("id").Limit(limit).Find(&outbox).Error
+	return
+}
+
+// FetchNotifyOutbox 按事件或状态查询最近的消息 不返回内容
+func FetchNotifyOutbox(eventKey, status string, limit int) (outbox []NotifyOutbox, err error) {
+	db := DB.Model(&NotifyOutbox{}).Omit("content")
+	if eventKey != "" {
+		db = db.Where("event_key = ?", eventKey)
+	}
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err = db.Order("id desc").Limit(limit).Find(&outbox).Error
+	return
+}
+
+// RetryNotifyOutbox 将失败的非敏感消息重新置为待发送
+func RetryNotifyOutbox(id uint) (int64, error) {
+	result := DB.Model(&NotifyOutbox{}).Where("id = ? AND status = ? AND sensitive = ?", id, NotifyFailed, false).
+		Updates(map[string]interface{}{"status": NotifyPending, "attempts": 0, "next_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeNotifyOutbox 删除保留期之前已送达的消息
+func PurgeNotifyOutbox(before time.Time) {
+	DB.Unscoped().Where("status = ? AND sent_at < ?", NotifySent, before).Delete(&NotifyOutbox{})
+}
+
+// NotifyPreference 通知偏好 事件为空表示全部事件
+type NotifyPreference struct {
+	gorm.Model
+	Userid   string `form:"userid" json:"userid" gorm:"type:varchar(255);uniqueIndex:idx_userid_event;not null;comment:企微userid"`
+	EventKey string `json:"event_key" gorm:"type:varchar(100);uniqueIndex:idx_userid_event;not null;default:'';comment:通知事件 为空表示全部事件"`
+	Channels string `json:"channels" gorm:"type:varchar(255);not null;comment:接收渠道 多个用逗号分隔 wework|email"`
+}
+
+// FetchNotifyPreferences 查询个人的通知偏好 不带userid查询全部
+func FetchNotifyPreferences(userid string) (prefs []NotifyPreference, err error) {
+	db := DB.Model(&NotifyPreference{})
+	if userid != "" {
+		db = db.Where("userid = ?", userid)
+	}
+	err = db.Order("userid, event_key").Find(&prefs).Error
+	return
+}
+
+// SaveNotifyPreference 新增或修改通知偏好
+func SaveNotifyPreference(p *NotifyPreference) error {
+	return DB.Save(p).Error
+}
+
+// DeleteNotifyPreference 删除通知偏好
+func DeleteNotifyPreference(id uint) error {
+	return DB.Unscoped().Delete(&NotifyPreference{}, id).Error
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 离职流程 每个离职员工一个任务 各系统的处理为独立的步骤 分别记录与重试
+* 复职 离职员工以同一工号恢复在职
+*
+ */
+
+const (
+	OffboardingRunning   = "running"   // 处理中
+	OffboardingDone      = "done"      // 全部完成
+	OffboardingFailed    = "failed"    // 有步骤重试耗尽
+	OffboardingCancelled = "cancelled" // 已复职 取消
+
+	StepAdDisable     = "ad_disable"     // 禁用AD账号并移动到禁用OU
+	StepAdGroups      = "ad_groups"      // 移出AD组 保存原组以便恢复
+	StepC7nDisable    = "c7n_disable"    // 禁用C7N用户并移除项目角色
+	StepWeworkDisable = "wework_disable" // 禁用企业微信账号
+	StepWeworkDelete  = "wework_delete"  // 保留期后删除企业微信账号
+	StepReport        = "report"         // 向IT发送离职清单
+
+	StepPending = "pending" // 待执行或待重试
+	StepDone    = "done"    // 执行成功
+	StepFailed  = "failed"  // 重试耗尽
+
+	RehirePending = "pending" // 待处理或待重试
+	RehireDone    = "done"    // 处理完成
+	RehireFailed  = "failed"  // 重试耗尽
+
+	defaultWeworkRetentionDays = 30
+)
+
+var (
+	// OffboardingCfg 离职流程配置
+	OffboardingCfg OffboardingConfig
+
+	// OffboardingSteps 离职流程的步骤 按顺序执行
+	OffboardingSteps = []string{StepAdDisable, StepAdGroups, StepC7nDisable, StepWeworkDisable, StepWeworkDelete, StepReport}
+)
+
+// OffboardingConfig 离职流程配置 0使用默认值
+type OffboardingConfig struct {
+	WeworkRetentionDays int // 企业微信账号禁用后保留的天数 到期删除
+	MaxAttempts         int // 每个步骤的最大尝试次数
+}
+
+// OffboardingTask 离职任务
+type OffboardingTask struct {
+	gorm.Model
+	Eid        string            `json:"eid" gorm:"type:varchar(100);index;not null;comment:工号"`
+	Name       string            `json:"name" gorm:"type:varchar(100);not null;comment:真实姓名"`
+	Department string            `json:"department" gorm:"type:varchar(255);comment:离职前部门"`
+	Source     string            `json:"source" gorm:"type:varchar(100);comment:触发来源"`
+	Status     string            `json:"status" gorm:"type:varchar(50);not null;comment:状态 running 处理中 done 完成 failed 失败 cancelled 已复职取消"`
+	Steps      []OffboardingStep `json:"steps,omitempty" gorm:"foreignKey:TaskID"`
+}
+
+// OffboardingStep 离职任务的步骤
+type OffboardingStep struct {
+	gorm.Model
+	TaskID   uint       `json:"task_id" gorm:"index;not null;comment:离职任务id"`
+	Name     string     `json:"name" gorm:"type:varchar(50);not null;comment:步骤 ad_disable ad_groups c7n_disable wework_disable wework_delete report"`
+	Status   string     `json:"status" gorm:"type:varchar(50);not null;comment:状态 pending done failed"`
+	Attempts int        `json:"attempts" gorm:"type:int;not null;default:0;comment:已尝试次数"`
+	RunAt    time.Time  `json:"run_at" gorm:"comment:最早执行时间"`
+	Data     string     `json:"data" gorm:"type:text;comment:步骤数据 如移出前的AD组"`
+	Result   string     `json:"result" gorm:"type:varchar(1000);comment:执行结果"`
+	DoneAt   *time.Time `json:"done_at" gorm:"comment:完成时间"`
+}
+
+// CreateOffboardingTask 为离职员工创建任务及全部步骤 已有处理中的任务时不重复创建
+func CreateOffboardingTask(eid, name, department, source string) (created bool, err error) {
+	var count int64
+	if err = DB.Model(&OffboardingTask{}).Where("eid = ? AND status = ?", eid, OffboardingRunning).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	retention := OffboardingCfg.WeworkRetentionDays
+	if retention <= 0 {
+		retention = defaultWeworkRetentionDays
+	}
+	now := time.Now()
+	task := OffboardingTask{Eid: eid, Name: name, Department: department, Source: source, Status: OffboardingRunning}
+	for _, s := range OffboardingSteps {
+		step := OffboardingStep{Name: s, Status: StepPending, RunAt: now}
+		if s == StepWeworkDelete {
+			step.RunAt = now.AddDate(0, 0, retention)
+		}
+		task.Steps = append(task.Steps, step)
+	}
+	if err = DB.Create(&task).Error; err != nil {
+		return
+	}
+	return true, nil
+}
+
+// FetchOffboardingTask 查询离职任务及步骤
+func FetchOffboardingTask(id uint) (task OffboardingTask, err error) {
+	err = DB.Preload("Steps").First(&task, id).Error
+	return
+}
+
+// FetchOffboardingTasks 按工号或状态查询最近的离职任务 不含步骤
+func FetchOffboardingTasks(eid, status string, limit int) (tasks []OffboardingTask, err error) {
+	db := DB.Model(&OffboardingTask{})
+	if eid != "" {
+		db = db.Where("eid = ?", eid)
+	}
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err = db.Order("id desc").Limit(limit).Find(&tasks).Error
+	return
+}
+
+// FetchRunningOffboardingTasks 查询处理中的离职任务及步骤
+func FetchRunningOffboardingTasks() (tasks []OffboardingTask, err error) {
+	err = DB.Preload("Steps").Where("status = ?", OffboardingRunning).Find(&tasks).Error
+	return
+}
+
+// UpdateOffboardingStep 更新步骤执行结果
+func UpdateOffboardingStep(step *OffboardingStep) {
+	DB.Model(step).Updates(map[string]interface{}{
+		"status": step.Status, "attempts": step.Attempts, "data": step.Data, "result": step.Result, "done_at": step.DoneAt,
+	})
+}
+
+// UpdateOffboardingTaskStatus 更新离职任务状态
+func UpdateOffboardingTaskStatus(id uint, status string) {
+	DB.Model(&OffboardingTask{}).Where("id = ?", id).Update("status", status)
+}
+
+// RetryOffboardingTask 将重试耗尽的步骤重置为待执行 任务恢复为处理中
+func RetryOffboardingTask(id uint) (ok bool, err error) {
+	result := DB.Model(&OffboardingStep{}).Where("task_id = ? AND status = ?", id, StepFailed).
+		Updates(map[string]interface{}{"status": StepPending, "attempts": 0})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	UpdateOffboardingTaskStatus(id, OffboardingRunning)
+	return true, nil
+}
+
+// CancelOffboardingTasks 复职时取消处理中的离职任务 未执行的步骤不再执行
+func CancelOffboardingTasks(eid string) {
+	DB.Model(&OffboardingTask{}).Where("eid = ? AND status = ?", eid, OffboardingRunning).Update("status", OffboardingCancelled)
+}
+
+// FetchLatestOffboardingTask 查询员工最近一次离职任务及步骤
+func FetchLatestOffboardingTask(eid string) (task OffboardingTask, err error) {
+	err = DB.Preload("Steps").Where("eid = ?", eid).Order("id desc").First(&task).Error
+	return
+}
+
+// RehireRecord 复职记录 身份登记为离职的员工在HR中恢复在职
+type RehireRecord struct {
+	gorm.Model
+	Eid           string     `json:"eid" gorm:"type:varchar(100);index;not null;comment:工号"`
+	Name          string     `json:"name" gorm:"type:varchar(100);not null;comment:真实姓名"`
+	OldDepartment string     `json:"old_department" gorm:"type:varchar(255);comment:离职前部门"`
+	Department    string     `json:"department" gorm:"type:varchar(255);comment:复职部门"`
+	Data          string     `json:"-" gorm:"type:text;comment:HR数据json"`
+	Status        string     `json:"status" gorm:"type:varchar(50);not null;comment:状态 pending 待处理 done 完成 failed 失败"`
+	Attempts      int        `json:"attempts" gorm:"type:int;not null;default:0;comment:已尝试次数"`
+	AdResult      string     `json:"ad_result" gorm:"type:varchar(1000);comment:AD处理结果 为空表示未完成"`
+	WeworkResult  string     `json:"wework_result" gorm:"type:varchar(1000);comment:企业微信处理结果 为空表示未完成"`
+	Result        string     `json:"result" gorm:"type:varchar(1000);comment:最近一次错误"`
+	DoneAt        *time.Time `json:"done_at" gorm:"comment:完成时间"`
+}
+
+// CreateRehireRecord 创建复职记录 已有待处理的记录时不重复创建
+func CreateRehireRecord(r *RehireRecord) (created bool, err error) {
+	var count int64
+	if err = DB.Model(&RehireRecord{}).Where("eid = ? AND status = ?", r.Eid, RehirePending).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	r.Status = RehirePending
+	if err = DB.Create(r).Error; err != nil {
+		return
+	}
+	return true, nil
+}
+
+// FetchPendingRehireRecords 查询待处理的复职记录
+func FetchPendingRehireRecords() (records []RehireRecord, err error) {
+	err = DB.Where("status = ?", RehirePending).Find(&records).Error
+	return
+}
+
+// FetchPendingRehireEids 待处理复职记录的工号 LDAP同步计划跳过这些员工
+func FetchPendingRehireEids() map[string]bool {
+	var eids []string
+	DB.Model(&RehireRecord{}).Where("status = ?", RehirePending).Pluck("eid", &eids)
+	pending := make(map[string]bool, len(eids))
+	for _, eid := range eids {
+		pending[eid] = true
+	}
+	return pending
+}
+
+// FetchRehireRecords 按工号或状态查询最近的复职记录
+func FetchRehireRecords(eid, status string, limit int) (records []RehireRecord, err error) {
+	db := DB.Model(&RehireRecord{})
+	if eid != "" {
+		db = db.Where("eid = ?", eid)
+	}
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err = db.Order("id desc").Limit(limit).Find(&records).Error
+	return
+}
+
+// UpdateRehireRecord 更新复职处理结果
+func UpdateRehireRecord(r *RehireRecord) {
+	DB.Model(r).Updates(map[string]interface{}{
+		"status": r.Status, "attempts": r.Attempts, "ad_result": r.AdResult, "wework_result": r.WeworkResult, "result": r.Result, "done_at": r.DoneAt,
+	})
+}
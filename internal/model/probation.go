@@ -0,0 +1,163 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 试用期标签 新员工创建企业微信账号时打上公司配置的标签 转正后移除
+* 标签规则 按HR属性维护企业微信标签成员
+*
+ */
+
+const (
+	ProbationActive = "probation" // 试用期中
+	ProbationEnded  = "ended"     // 已转正 标签已移除
+	ProbationLeft   = "left"      // 试用期内离职
+
+	TagRuleEq       = "eq"       // 等于
+	TagRulePrefix   = "prefix"   // 前缀 如部门路径
+	TagRuleContains = "contains" // 包含
+
+	defaultProbationMonths     = 6
+	defaultTagMaxRemovePercent = 20
+	defaultTagMinRemoveGuarded = 5
+)
+
+var (
+	// ProbationCfg 试用期配置
+	ProbationCfg ProbationConfig
+	// TagRuleCfg 标签规则配置
+	TagRuleCfg TagRuleConfig
+)
+
+// ProbationConfig 试用期配置 0使用默认值
+type ProbationConfig struct {
+	Months int    // 试用期月数 从打标签之日起算
+	Stat   string // HR状态(stat2)中表示试用期的值 配置后以HR状态判断转正 不再按月数
+}
+
+// ProbationMonths 试用期月数
+func (c ProbationConfig) ProbationMonths() int {
+	if c.Months <= 0 {
+		return defaultProbationMonths
+	}
+	return c.Months
+}
+
+// TagRuleConfig 标签规则配置 0使用默认值
+type TagRuleConfig struct {
+	MaxRemovePercent int // 单个标签移出人数占现有成员的最大百分比 超过则不移出 负数不限制
+	MinRemoveGuarded int // 移出人数超过该值才校验比例
+}
+
+// TagMaxRemovePercent 单个标签移出人数占现有成员的最大百分比 负数不限制
+func (c TagRuleConfig) TagMaxRemovePercent() int {
+	if c.MaxRemovePercent == 0 {
+		return defaultTagMaxRemovePercent
+	}
+	return c.MaxRemovePercent
+}
+
+// TagMinRemoveGuarded 移出人数超过该值才校验比例
+func (c TagRuleConfig) TagMinRemoveGuarded() int {
+	if c.MinRemoveGuarded <= 0 {
+		return defaultTagMinRemoveGuarded
+	}
+	return c.MinRemoveGuarded
+}
+
+// ProbationRecord 试用期记录 每人每次打试用期标签一条
+type ProbationRecord struct {
+	gorm.Model
+	Eid     string     `json:"eid" gorm:"type:varchar(100);index;not null;comment:工号"`
+	Name    string     `json:"name" gorm:"type:varchar(100);not null;comment:真实姓名"`
+	Userid  string     `json:"userid" gorm:"type:varchar(255);not null;comment:企业微信userid"`
+	TagId   int        `json:"tag_id" gorm:"type:int;not null;comment:试用期标签id"`
+	TagName string     `json:"tag_name" gorm:"type:varchar(255);comment:试用期标签名称"`
+	StartAt time.Time  `json:"start_at" gorm:"comment:试用期开始时间"`
+	EndAt   time.Time  `json:"end_at" gorm:"comment:按月数计算的转正时间"`
+	Status  string     `json:"status" gorm:"type:varchar(50);index;not null;comment:状态 probation 试用期中 ended 已转正 left 试用期内离职"`
+	Result  string     `json:"result" gorm:"type:varchar(1000);comment:转正依据或最近一次错误"`
+	DoneAt  *time.Time `json:"done_at" gorm:"comment:转正或离职时间"`
+}
+
+// CreateProbationRecord 创建试用期记录 已有试用期中的记录时不重复创建
+func CreateProbationRecord(r *ProbationRecord) (created bool, err error) {
+	var count int64
+	if err = DB.Model(&ProbationRecord{}).Where("eid = ? AND status = ?", r.Eid, ProbationActive).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	if r.StartAt.IsZero() {
+		r.StartAt = time.Now()
+	}
+	r.EndAt = r.StartAt.AddDate(0, ProbationCfg.ProbationMonths(), 0)
+	r.Status = ProbationActive
+	if err = DB.Create(r).Error; err != nil {
+		return
+	}
+	return true, nil
+}
+
+// FetchActiveProbationRecords 查询试用期中的记录
+func FetchActiveProbationRecords() (records []ProbationRecord, err error) {
+	err = DB.Where("status = ?", ProbationActive).Find(&records).Error
+	return
+}
+
+// FetchProbationRecords 按工号或状态查询最近的试用期记录
+func FetchProbationRecords(eid, status string, limit int) (records []ProbationRecord, err error) {
+	db := DB.Model(&ProbationRecord{})
+	if eid != "" {
+		db = db.Where("eid = ?", eid)
+	}
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err = db.Order("id desc").Limit(limit).Find(&records).Error
+	return
+}
+
+// UpdateProbationRecord 更新试用期记录状态
+func UpdateProbationRecord(r *ProbationRecord) {
+	DB.Model(r).Updates(map[string]interface{}{"status": r.Status, "result": r.Result, "done_at": r.DoneAt})
+}
+
+// FetchFirstWeworkUserSyncTime 工号最早一次新用户记录的时间 用于补建试用期记录
+func FetchFirstWeworkUserSyncTime(eid string) (t time.Time, ok bool) {
+	var record WeworkUserSyncRecord
+	if DB.Where("eid = ? AND sync_kind LIKE ?", eid, "新用户%").Order("id").Limit(1).Find(&record).RowsAffected == 0 {
+		return
+	}
+	return record.CreatedAt, true
+}
+
+// TagRule 标签规则 HR属性满足条件的在职员工加入标签 同一标签的多条规则满足任一即可
+// 规则中的标签完全由规则维护 不满足任何规则的成员会被移出
+type TagRule struct {
+	gorm.Model
+	Field    string `json:"field" gorm:"type:varchar(50);not null;comment:HR属性 company_code company_name org_all zmplans stat2"`
+	Op       string `json:"op" gorm:"type:varchar(50);not null;comment:匹配方式 eq 等于 prefix 前缀 contains 包含"`
+	Value    string `json:"value" gorm:"type:varchar(255);not null;comment:匹配值"`
+	TagId    int    `json:"tag_id" gorm:"type:int;index;not null;comment:企业微信标签id"`
+	TagName  string `json:"tag_name" gorm:"type:varchar(255);comment:企业微信标签名称 保存时校验并填写"`
+	Disabled bool   `json:"disabled" gorm:"not null;default:false;comment:是否停用"`
+}
+
+// FetchTagRules 查询全部标签规则
+func FetchTagRules() (rules []TagRule, err error) {
+	err = DB.Order("tag_id, id").Find(&rules).Error
+	return
+}
+
+// SaveTagRule 新增或修改标签规则
+func SaveTagRule(rule *TagRule) error {
+	return DB.Save(rule).Error
+}
+
+// DeleteTagRule 删除标签规则
+func DeleteTagRule(id uint) error {
+	return DB.Delete(&TagRule{}, id).Error
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 过期提醒规则
+*
+ */
+
+const (
+	ReminderKindPwd     = "pwd"     // 密码过期提醒
+	ReminderKindAccount = "account" // 账号过期提醒
+
+	ActionNotify  = "notify"  // 仅通知
+	ActionDisable = "disable" // 禁用账号并移动到禁用OU
+
+	ActionRenewSelf    = "renew_self"    // 本人点击卡片一键续期
+	ActionRenewSponsor = "renew_sponsor" // 申请人或担保人点击卡片确认续期
+
+	ChannelWework = "wework" // 企微应用消息
+	ChannelEmail  = "email"  // 邮件
+)
+
+// ExpireReminder 过期提醒规则 距离过期天数命中时按渠道发送提醒
+type ExpireReminder struct {
+	gorm.Model
+	Kind     string `json:"kind" gorm:"type:varchar(50);not null;comment:提醒类别 pwd 密码过期 account 账号过期"`
+	Days     int    `json:"days" gorm:"type:int;not null;comment:距离过期的天数 负数表示已过期的天数"`
+	Channels string `json:"channels" gorm:"type:varchar(255);not null;comment:通知渠道 多个用逗号分隔 wework|email"`
+	Action   string `json:"action" gorm:"type:varchar(50);not null;default:notify;comment:动作 notify 仅通知 disable 禁用账号"`
+}
+
+// HasChannel 判断提醒规则是否包含某渠道
+func (r ExpireReminder) HasChannel(channel string) bool {
+	for _, c := range strings.Split(r.Channels, ",") {
+		if strings.TrimSpace(c) == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchExpireReminders 查询某类别的提醒规则
+func FetchExpireReminders(kind string) (reminders []ExpireReminder, err error) {
+	err = DB.Where("kind = ?", kind).Order("days desc").Find(&reminders).Error
+	return
+}
+
+// InitExpireReminders 某类别无提醒规则时写入默认规则
+func InitExpireReminders(kind string, defaults []ExpireReminder) {
+	if result := DB.Where("kind = ?", kind).Limit(1).Find(&[]ExpireReminder{}); result.RowsAffected == 0 {
+		DB.Create(&defaults)
+	}
+}
+
+// ExpireActionRecord 过期处理记录 每次通知或禁用都记录一条
+type ExpireActionRecord struct {
+	gorm.Model
+	Kind     string `json:"kind" gorm:"type:varchar(50);not null;comment:提醒类别"`
+	Name     string `json:"name" gorm:"type:varchar(255);not null;comment:真实姓名"`
+	Eid      string `json:"eid" gorm:"type:varchar(255);not null;comment:工号"`
+	Sam      string `json:"sam" gorm:"type:varchar(255);not null;comment:账号"`
+	Days     int    `json:"days" gorm:"type:int;not null;comment:距离过期的天数"`
+	Action   string `json:"action" gorm:"type:varchar(50);not null;comment:动作"`
+	Channels string `json:"channels" gorm:"type:varchar(255);comment:实际送达的通知渠道"`
+	Result   string `json:"result" gorm:"type:varchar(255);comment:处理结果 成功为空 失败为错误信息"`
+}
+
+// CreateExpireActionRecord 记录过期处理
+func CreateExpireActionRecord(r ExpireActionRecord) {
+	DB.Model(&ExpireActionRecord{}).Create(&r)
+}
+
+// CountExpireActions 账号一段时间内某动作成功的次数 没有SAM账号的按工号
+func CountExpireActions(eid, sam, action string, since time.Time) (count int64) {
+	db := DB.Model(&ExpireActionRecord{}).Where("action = ? AND result = '' AND created_at >= ?", action, since)
+	if sam != "" {
+		db = db.Where("sam = ?", sam)
+	} else {
+		db = db.Where("eid = ?", eid)
+	}
+	db.Count(&count)
+	return
+}
+
+// FetchExpireActionRecord 查询一段时间的过期处理记录
+func FetchExpireActionRecord(offsetBefore, offsetAfter int) (records []ExpireActionRecord, err error) {
+	begin, _ := time.Parse("2006-01-02", time.Now().AddDate(0, 0, offsetBefore).Format("2006-01-02")) // 开始日期的零点
+	end, _ := time.Parse("2006-01-02", time.Now().AddDate(0, 0, offsetAfter).Format("2006-01-02"))    // 结束日期的最后一秒
+	err = DB.Where("created_at BETWEEN ? AND ?", begin, end).Order("kind, days").Find(&records).Error
+	return
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+/*
+* 账号申请人与担保人
+*
+ */
+
+const (
+	RenewalApplyPrefix = "wework_renewal_apply:" // 一键续期申请 缓存键前缀
+)
+
+// AccountSponsor 账号注册工单的申请人与担保人 账号即将过期时通知能续期的人
+type AccountSponsor struct {
+	gorm.Model
+	Sam        string `json:"sam" gorm:"type:varchar(128);uniqueIndex;not null;comment:SAM账号"`
+	Eid        string `json:"eid" gorm:"type:varchar(100);not null;comment:工单中的工号 外部公司不带前缀"`
+	Name       string `json:"name" gorm:"type:varchar(100);not null;comment:真实姓名"`
+	Company    string `json:"company" gorm:"type:varchar(128);comment:公司"`
+	Applicant  string `json:"applicant" gorm:"type:varchar(100);not null;comment:工单申请人企微userid"`
+	SponsorEid string `json:"sponsor_eid" gorm:"type:varchar(100);comment:担保人工号"`
+	SpNo       string `json:"sp_no" gorm:"type:varchar(255);comment:账号注册工单审批编号"`
+}
+
+// SaveAccountSponsor 记录账号的申请人与担保人 同一账号重复注册时以最新工单为准
+func SaveAccountSponsor(s AccountSponsor) {
+	DB.Where(AccountSponsor{Sam: s.Sam}).Assign(s).FirstOrCreate(&AccountSponsor{})
+}
+
+// FetchAccountSponsor 根据SAM账号查询申请人与担保人
+func FetchAccountSponsor(sam string) (s AccountSponsor, err error) {
+	err = DB.Where("sam = ?", sam).First(&s).Error
+	return
+}
+
+// RenewalApply 一键续期申请 发卡片时缓存在redis中 点击链接后提交账号续期审批
+type RenewalApply struct {
+	Userid string             `json:"userid"` // 审批申请人企微userid
+	Users  []RenewalApplyUser `json:"users"`
+}
+
+// RenewalApplyUser 待续期账号
+type RenewalApplyUser struct {
+	Name string `json:"name"`
+	Eid  string `json:"eid"`
+	Sam  string `json:"sam"`
+	Days int    `json:"days"` // 距离过期的天数
+}
+
+// RenewalApplyCfg 账号续期审批模板配置 存于 third_party_cfgs 的 wework_renewal_apply
+type RenewalApplyCfg struct {
+	TemplateId  string `json:"template_id"`  // 账号续期审批模板id
+	TableId     string `json:"table_id"`     // 待申请人员 明细控件id
+	NameId      string `json:"name_id"`      // 姓名 控件id
+	EidId       string `json:"eid_id"`       // 工号 控件id
+	PlatformId  string `json:"platform_id"`  // 平台 控件id
+	PlatformKey string `json:"platform_key"` // 平台 UUAP选项的key
+	DaysId      string `json:"days_id"`      // 续期天数 控件id
+	Days        string `json:"days"`         // 默认续期天数
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+/*
+* HR同步变更计划
+*
+ */
+
+const (
+	PlanStatusHeld     = "held"     // 超过阈值 等待人工审批
+	PlanStatusApproved = "approved" // 已批准 待执行
+	PlanStatusExecuted = "executed" // 已执行
+	PlanStatusRejected = "rejected" // 已驳回
+
+	PlanActionCreate  = "create"  // 新建账号
+	PlanActionUpdate  = "update"  // 更新属性
+	PlanActionMove    = "move"    // 移动部门
+	PlanActionDisable = "disable" // 离职禁用
+
+	PlanItemPending = "pending" // 待执行
+	PlanItemDone    = "done"    // 执行成功
+	PlanItemFailed  = "failed"  // 执行失败
+	PlanItemSkipped = "skipped" // 跳过
+)
+
+var (
+	// SyncCfg HR同步配置
+	SyncCfg SyncThreshold
+)
+
+// SyncThreshold HR同步变更计划的审批阈值 超过任一阈值则挂起等待人工审批 0使用默认值 负数表示不限制
+type SyncThreshold struct {
+	MaxCreates  int
+	MaxUpdates  int
+	MaxMoves    int
+	MaxDisables int
+}
+
+// LdapSyncPlan HR同步变更计划
+type LdapSyncPlan struct {
+	gorm.Model
+	Status   string             `json:"status" gorm:"type:varchar(50);not null;comment:状态 held 待审批 approved 已批准 executed 已执行 rejected 已驳回"`
+	Creates  int                `json:"creates" gorm:"type:int;not null;comment:新建数"`
+	Updates  int                `json:"updates" gorm:"type:int;not null;comment:属性更新数"`
+	Moves    int                `json:"moves" gorm:"type:int;not null;comment:部门移动数"`
+	Disables int                `json:"disables" gorm:"type:int;not null;comment:禁用数"`
+	Reason   string             `json:"reason" gorm:"type:varchar(255);comment:挂起原因"`
+	Operator string             `json:"operator" gorm:"type:varchar(100);comment:审批人"`
+	Items    []LdapSyncPlanItem `json:"items,omitempty" gorm:"foreignKey:PlanID"`
+}
+
+// LdapSyncPlanItem HR同步变更计划明细
+type LdapSyncPlanItem struct {
+	gorm.Model
+	PlanID    uint   `json:"plan_id" gorm:"index;not null;comment:变更计划id"`
+	Action    string `json:"action" gorm:"type:varchar(50);not null;comment:动作 create update move disable"`
+	Name      string `json:"name" gorm:"type:varchar(255);not null;comment:真实姓名"`
+	Eid       string `json:"eid" gorm:"type:varchar(255);not null;comment:工号"`
+	Dn        string `json:"dn" gorm:"type:varchar(255);comment:计划生成时的用户dn"`
+	NewOu     string `json:"new_ou" gorm:"type:varchar(255);comment:目标OU"`
+	OldDepart string `json:"old_depart" gorm:"type:varchar(255);comment:旧部门"`
+	NewDepart string `json:"new_depart" gorm:"type:varchar(255);comment:新部门"`
+	Level     string `json:"level" gorm:"type:varchar(255);comment:移动级别"`
+	Changes   string `json:"changes" gorm:"type:varchar(4000);comment:变更内容json"`
+	Status    string `json:"status" gorm:"type:varchar(50);not null;comment:状态 pending done failed skipped"`
+	Result    string `json:"result" gorm:"type:varchar(255);comment:执行结果"`
+}
+
+// CreateLdapSyncPlan 保存变更计划及明细
+func CreateLdapSyncPlan(plan *LdapSyncPlan) error {
+	return DB.Create(plan).Error
+}
+
+// FetchLdapSyncPlan 查询变更计划及明细
+func FetchLdapSyncPlan(id uint) (plan LdapSyncPlan, err error) {
+	err = DB.Preload("Items").First(&plan, id).Error
+	return
+}
+
+// FetchLdapSyncPlans 查询最近的变更计划 不含明细
+func FetchLdapSyncPlans(limit int) (plans []LdapSyncPlan, err error) {
+	err = DB.Order("id desc").Limit(limit).Find(&plans).Error
+	return
+}
+
+// UpdateLdapSyncPlanStatus 更新变更计划状态 仅当状态为from时更新 防止重复审批
+func UpdateLdapSyncPlanStatus(id uint, from, to, operator string) (ok bool, err error) {
+	result := DB.Model(&LdapSyncPlan{}).Where("id = ? AND status = ?", id, from).
+		Updates(map[string]interface{}{"status": to, "operator": operator})
+	return result.RowsAffected == 1, result.Error
+}
+
+// UpdateLdapSyncPlanItem 更新明细执行结果
+func UpdateLdapSyncPlanItem(item *LdapSyncPlanItem) {
+	DB.Model(item).Updates(map[string]interface{}{"status": item.Status, "result": item.Result})
+}
+
+// SupersedeHeldLdapSyncPlans 新计划生成后 之前挂起的计划已过时 自动驳回
+func SupersedeHeldLdapSyncPlans(latestId uint) {
+	DB.Model(&LdapSyncPlan{}).Where("status = ? AND id <> ?", PlanStatusHeld, latestId).
+		Updates(map[string]interface{}{"status": PlanStatusRejected, "operator": "system"})
+}
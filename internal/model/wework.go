@@ -21,6 +21,9 @@ type WeworkCfg struct {
 	AppId     int    `json:"app_id" gorm:"type:int(25);unique_index;not null;comment:App ID"`
 	AppName   string `json:"app_name" gorm:"type:varchar(255);unique_index;not null;comment:App名称"`
 	AppSecret string `json:"app_secret" gorm:"type:varchar(255);unique_index;not null;comment:App秘钥"`
+	// 接收事件服务器配置 目前用于通讯录变更回调
+	CallbackToken  string `json:"callback_token" gorm:"type:varchar(255);comment:回调Token"`
+	CallbackAesKey string `json:"callback_aes_key" gorm:"type:varchar(255);comment:回调EncodingAESKey"`
 }
 
 var (
@@ -104,6 +107,13 @@ func CreateWeworkUserSyncRecord(userId, name, eid, syncKind string) {
 	DB.Model(&WeworkUserSyncRecord{}).Create(&WeworkUserSyncRecord{UserId: userId, Name: name, Eid: eid, SyncKind: syncKind})
 }
 
+// FetchLastWeworkUserid 查询工号最近一次变化记录中的企业微信userid
+func FetchLastWeworkUserid(eid string) string {
+	var record WeworkUserSyncRecord
+	DB.Where("eid = ?", eid).Order("id desc").Limit(1).Find(&record)
+	return record.UserId
+}
+
 // UpdateWeworkUserSyncRecord 更新 企微用户变化记录
 func UpdateWeworkUserSyncRecord(userId, name, eid, syncKind, newSyncKind string) {
 	DB.Model(&WeworkUserSyncRecord{}).Where("user_id = ? AND name = ? AND eid = ? and sync_kind = ?", userId, name, eid, syncKind).Update("sync_kind", newSyncKind)
@@ -138,9 +148,16 @@ func DeleteWeworkMsgTemplate(key string) {
 	DB.Where("key = ?", key).Delete(&WeworkMsgTemplate{})
 }
 
-// UpdateWeworkMsgTemplate 改 企微信息模板
-func UpdateWeworkMsgTemplate(key, value string) {
-	DB.Model(&WeworkMsgTemplate{}).Create(&WeworkMsgTemplate{Key: key, Value: value})
+// UpdateWeworkMsgTemplate 改 企微信息模板 不存在时新增
+func UpdateWeworkMsgTemplate(key, value string) error {
+	var count int64
+	if err := DB.Model(&WeworkMsgTemplate{}).Where(&WeworkMsgTemplate{Key: key}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return DB.Create(&WeworkMsgTemplate{Key: key, Value: value}).Error
+	}
+	return DB.Model(&WeworkMsgTemplate{}).Where(&WeworkMsgTemplate{Key: key}).Update("value", value).Error
 }
 
 // FetchWeworkMsgTemplate 查 企微信息模板
@@ -375,10 +392,12 @@ type Applicant struct {
 	Mail          string   `mapstructure:"邮箱"`
 	Company       string   `mapstructure:"公司"`
 	InitPlatforms []string `mapstructure:"所需平台"`
+	SponsorEid    string   `mapstructure:"担保人工号"` // 可选 账号过期时与申请人一并通知
 }
 
 // AccountsRegister 各平台账号注册 工单详情 多个
 type AccountsRegister struct {
+	SpNo    string      `mapstructure:"spNo"`
 	SpName  string      `mapstructure:"spName"`
 	Partyid string      `mapstructure:"partyid"`
 	Userid  string      `mapstructure:"userid"`
@@ -387,6 +406,7 @@ type AccountsRegister struct {
 
 // AccountsRegisterSingle 各平台账号注册 工单详情 单个
 type AccountsRegisterSingle struct {
+	SpNo          string   `mapstructure:"spNo"`
 	SpName        string   `mapstructure:"spName"`
 	Partyid       string   `mapstructure:"partyid"`
 	Userid        string   `mapstructure:"userid"`
@@ -396,6 +416,7 @@ type AccountsRegisterSingle struct {
 	Mail          string   `mapstructure:"邮箱"`
 	Company       string   `mapstructure:"公司"`
 	InitPlatforms []string `mapstructure:"所需平台"`
+	SponsorEid    string   `mapstructure:"担保人工号"`
 }
 
 // UuapPwdRetrieve UUAP密码找回 工单详情
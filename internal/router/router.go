@@ -14,6 +14,8 @@ import (
 	"gitee.com/RandolphCYG/akita/internal/middleware"
 	"gitee.com/RandolphCYG/akita/internal/middleware/log"
 	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
 	"gitee.com/RandolphCYG/akita/pkg/cache"
 	"gitee.com/RandolphCYG/akita/pkg/email"
 	"gitee.com/RandolphCYG/akita/pkg/hr"
@@ -37,24 +39,42 @@ func Init(cfg string) {
 		panic(err)
 	}
 
-	model.InitDB(&Cfg.Database) // 初始化数据库
+	model.InitDB(&Cfg.Database)              // 初始化数据库
+	model.SyncCfg = Cfg.Sync                 // HR同步变更计划审批阈值
+	model.HrSourceCfg = Cfg.Hr               // HR数据源
+	model.HrCacheCfg = Cfg.HrCache           // HR缓存刷新校验与快照
+	model.OffboardingCfg = Cfg.Offboarding   // 离职流程
+	model.WeworkDepartCfg = Cfg.WeworkDepart // 企业微信部门同步
+	model.ProbationCfg = Cfg.Probation       // 试用期
+	model.TagRuleCfg = Cfg.TagRule           // 标签规则
+	model.RenewalCfg = Cfg.Renewal           // 一键续期
+	model.NotifyCfg = Cfg.Notify             // 通知发件箱
 	// 执行数据迁移
 	log.Log.Info("Data migration begin ...")
 	err = model.DB.AutoMigrate(&model.LdapCfg{}, &model.LdapField{}, &hr.HrDataConn{}, &model.WeworkCfg{}, &model.WeworkOrder{},
-		&model.LdapUserDepartRecord{}, &model.WeworkUserSyncRecord{}, &model.WeworkMsgTemplate{}, &model.ThirdPartyCfg{}, &model.EmailTemplate{})
+		&model.LdapUserDepartRecord{}, &model.WeworkUserSyncRecord{}, &model.WeworkMsgTemplate{}, &model.ThirdPartyCfg{}, &model.EmailTemplate{},
+		&model.ExpireReminder{}, &model.ExpireActionRecord{}, &model.AccountSponsor{},
+		&model.LdapSyncPlan{}, &model.LdapSyncPlanItem{}, &model.LdapUserAttrRecord{}, &model.LdapCredentialDelivery{},
+		&model.HrSnapshot{}, &model.Identity{}, &model.OffboardingTask{}, &model.OffboardingStep{},
+		&model.RehireRecord{}, &model.WeworkDepartMapping{}, &model.CompanySetting{}, &model.ProbationRecord{}, &model.TagRule{}, &model.CardTask{},
+		&model.NotifyOutbox{}, &model.NotifyPreference{})
 	if err != nil {
 		return
 	}
 	if result := model.DB.Limit(1).Find(&model.LdapCfg{}); result.RowsAffected == 0 {
 		model.DB.Create(&Cfg.LdapCfg)
 	}
+	model.InitExpireReminders(model.ReminderKindPwd, ldapuser.DefaultPwdReminders)
+	model.InitExpireReminders(model.ReminderKindAccount, ldapuser.DefaultAccountReminders)
+	model.InitCompanySettings()
 	log.Log.Info("Data migration successful ...")
 	// 初始化缓存
 	err = cache.Init(&Cfg.Redis)
 	if err != nil {
 		return
 	}
-	cacheRecover() // 缓存恢复
+	notify.MigrateTemplates() // 旧的%s模板迁移为参数名模板
+	cacheRecover()            // 缓存恢复
 	// 初始化 email
 	err = email.Init(&Cfg.Email)
 	if err != nil {
@@ -230,15 +250,65 @@ func InitRouter() *gin.Engine {
 		ldapFieldsGroup.POST("update", ldapFieldHandler.Update)
 		ldapFieldsGroup.DELETE("delete", ldapFieldHandler.Delete)
 		ldapFieldsGroup.POST("test", ldapFieldHandler.Test)
+		// 公司配置 新账号的企业微信部门、标签、C7N默认项目和有效期
+		companySettingsGroup := v1.Group("company/settings")
+		companySettingHandler := handler.NewCompanySettingHandler()
+		companySettingsGroup.GET("fetch", companySettingHandler.Fetch)
+		companySettingsGroup.POST("create", companySettingHandler.Create)
+		companySettingsGroup.POST("update", companySettingHandler.Update)
+		companySettingsGroup.DELETE("delete", companySettingHandler.Delete)
+		// 通知 发件箱与个人偏好
+		notifyGroup := v1.Group("notify")
+		notifyHandler := handler.NewNotifyHandler()
+		notifyGroup.GET("events", notifyHandler.FetchEvents)        // 通知事件及模板参数
+		notifyGroup.GET("outbox/fetch", notifyHandler.FetchOutbox)  // 查询最近的消息 可按event_key、status筛选
+		notifyGroup.POST("outbox/retry", notifyHandler.RetryOutbox) // 重试失败的消息
+		notifyGroup.GET("preferences/fetch", notifyHandler.FetchPreferences)
+		notifyGroup.POST("preferences/save", notifyHandler.SavePreference)
+		notifyGroup.DELETE("preferences/delete", notifyHandler.DeletePreference)
+		notifyGroup.GET("templates/fetch", notifyHandler.FetchTemplates) // 消息模板及可用参数
+		notifyGroup.POST("templates/save", notifyHandler.SaveTemplate)   // 按事件参数校验后保存
+
 		// ldap 用户
 		ldapUsersGroup := v1.Group("ldap/users")
 		ldapUserHandler := handler.NewLdapUserHandler()
-		ldapUsersGroup.GET("manual/sync", ldapUserHandler.SyncLdapUsersManual)               // 手动触发更新ldap用户
-		ldapUsersGroup.GET("manual/scan/expire", ldapUserHandler.ScanExpiredLdapUsersManual) // 手动触发扫描过期ldap用户
+		ldapUsersGroup.GET("manual/sync", ldapUserHandler.SyncLdapUsersManual)                     // 手动触发更新ldap用户
+		ldapUsersGroup.GET("manual/scan/expire", ldapUserHandler.ScanExpiredLdapUsersManual)       // 手动触发扫描过期ldap用户
+		ldapUsersGroup.GET("manual/scan/pwd", ldapUserHandler.ScanPwdExpiringLdapUsersManual)      // 手动触发扫描密码即将过期的ldap用户
+		ldapUsersGroup.GET("manual/deliver/credentials", ldapUserHandler.DeliverCredentialsManual) // 手动触发发送新员工初始密码
+		// ldap 同步变更计划 超过阈值的计划需人工审批
+		ldapSyncPlansGroup := v1.Group("ldap/sync/plans")
+		ldapSyncPlanHandler := handler.NewLdapSyncPlanHandler()
+		ldapSyncPlansGroup.GET("fetch", ldapSyncPlanHandler.Fetch)      // 查询变更计划 带id查询明细
+		ldapSyncPlansGroup.POST("approve", ldapSyncPlanHandler.Approve) // 批准并执行
+		ldapSyncPlansGroup.POST("reject", ldapSyncPlanHandler.Reject)   // 驳回
 		// hr 用户
 		hrUsersGroup := v1.Group("hr/users")
 		hrUserHandler := handler.NewHrUserHandler()
-		hrUsersGroup.GET("manual/cache", hrUserHandler.CacheHrUsersManual) // 手动触发缓存HR用户
+		hrUsersGroup.GET("manual/cache", hrUserHandler.CacheHrUsersManual)      // 手动触发缓存HR用户
+		hrUsersGroup.GET("manual/report", hrUserHandler.SendChangeReportManual) // 手动触发发送人员变化报告
+		// 身份核对 HR、AD、企业微信、C7N
+		reconcileGroup := v1.Group("reconcile")
+		reconcileHandler := handler.NewReconcileHandler()
+		reconcileGroup.GET("manual", reconcileHandler.ReconcileManual)   // 手动触发身份核对
+		reconcileGroup.GET("report/fetch", reconcileHandler.Fetch)       // 查询最近一次核对报告
+		reconcileGroup.GET("report/download", reconcileHandler.Download) // 下载核对报告 format=csv|xlsx
+		// 身份登记
+		identityGroup := v1.Group("identities")
+		identityHandler := handler.NewIdentityHandler()
+		identityGroup.GET("fetch", identityHandler.Fetch) // 按工号、SAM账号、企业微信userid或姓名查询身份
+		// 离职流程
+		offboardingGroup := v1.Group("offboarding")
+		offboardingHandler := handler.NewOffboardingHandler()
+		offboardingGroup.GET("manual", offboardingHandler.ExecuteManual)       // 手动触发执行离职任务
+		offboardingGroup.GET("tasks/fetch", offboardingHandler.Fetch)          // 查询离职任务 带id查询步骤明细
+		offboardingGroup.POST("tasks/retry", offboardingHandler.Retry)         // 重试失败的步骤
+		offboardingGroup.GET("rehires/fetch", offboardingHandler.FetchRehires) // 查询复职记录
+		// hr 快照
+		hrSnapshotsGroup := v1.Group("hr/snapshots")
+		hrSnapshotHandler := handler.NewHrSnapshotHandler()
+		hrSnapshotsGroup.GET("fetch", hrSnapshotHandler.Fetch) // 查询最近的快照
+		hrSnapshotsGroup.GET("diff", hrSnapshotHandler.Diff)   // 对比两份快照 不带参数对比每日报告的快照
 		// wework 工单
 		weworkOrdersGroup := v1.Group("wework/orders")
 		weworkOrdersHandler := handler.NewWeworkOrdersHandler()
@@ -249,6 +319,41 @@ func InitRouter() *gin.Engine {
 		weworkUsersGroup.GET("manual/cache", weworkUserHandler.CacheUsersManual)             // 手动触发缓存企业微信用户
 		weworkUsersGroup.GET("manual/scan/expire", weworkUserHandler.ScanExpiredUsersManual) // 手动触发扫描企业微信过期用户
 		weworkUsersGroup.GET("manual/scan/new", weworkUserHandler.ScanNewHrUsersManual)      // 手动触发扫描HR缓存数据并为新员工创建企业微信账号
+		weworkUsersGroup.GET("manual/sync", weworkUserHandler.SyncUsersManual)               // 手动触发以HR数据同步企业微信用户属性
+		// wework 部门
+		weworkDepartsGroup := v1.Group("wework/departs")
+		weworkDepartsGroup.GET("sync", weworkUserHandler.SyncDeparts) // 同步HR部门结构 dry_run=true只返回变更
+		// wework 标签 试用期与标签规则
+		weworkTagsGroup := v1.Group("wework/tags")
+		weworkTagHandler := handler.NewWeworkTagHandler()
+		weworkTagsGroup.GET("probations/fetch", weworkTagHandler.FetchProbations)      // 查询试用期记录
+		weworkTagsGroup.GET("probations/manual", weworkTagHandler.ScanProbationManual) // 手动触发扫描试用期员工
+		weworkTagsGroup.GET("rules/fetch", weworkTagHandler.FetchRules)
+		weworkTagsGroup.POST("rules/create", weworkTagHandler.CreateRule)
+		weworkTagsGroup.POST("rules/update", weworkTagHandler.UpdateRule)
+		weworkTagsGroup.DELETE("rules/delete", weworkTagHandler.DeleteRule)
+		weworkTagsGroup.GET("rules/apply", weworkTagHandler.ApplyRules) // 按规则更新标签成员 dry_run=true只返回变化
+		// wework 自助修改密码 页面配置为企微应用主页 通过OAuth获取用户身份
+		weworkPwdGroup := v1.Group("wework/pwd")
+		weworkPwdHandler := handler.NewWeworkPwdHandler()
+		weworkPwdGroup.GET("page", weworkPwdHandler.Page)                 // H5页面
+		weworkPwdGroup.POST("auth", weworkPwdHandler.Auth)                // 企微OAuth认证
+		weworkPwdGroup.POST("modify", weworkPwdHandler.Modify)            // 自助修改密码
+		weworkPwdGroup.POST("reset/code", weworkPwdHandler.SendResetCode) // 发送重置密码验证码
+		weworkPwdGroup.POST("reset", weworkPwdHandler.Reset)              // 重置密码
+		// wework 一键续期 账号续期审批卡片中的链接经企微OAuth跳转到页面
+		weworkRenewalGroup := v1.Group("wework/renewal")
+		weworkRenewalHandler := handler.NewWeworkRenewalHandler()
+		weworkRenewalGroup.GET("page", weworkRenewalHandler.Page)    // H5页面
+		weworkRenewalGroup.GET("fetch", weworkRenewalHandler.Fetch)  // 待续期的账号
+		weworkRenewalGroup.POST("apply", weworkRenewalHandler.Apply) // 认证为本人后提交账号续期审批
+		// wework 回调 通讯录管理应用中配置接收事件服务器
+		weworkCallbackGroup := v1.Group("wework/callback")
+		weworkCallbackHandler := handler.NewWeworkCallbackHandler()
+		weworkCallbackGroup.GET("contact", weworkCallbackHandler.VerifyContact)  // 校验回调地址
+		weworkCallbackGroup.POST("contact", weworkCallbackHandler.HandleContact) // 通讯录变更事件 实时更新成员缓存
+		weworkCallbackGroup.GET("app", weworkCallbackHandler.VerifyApp)          // 校验UUAP公告应用回调地址
+		weworkCallbackGroup.POST("app", weworkCallbackHandler.HandleApp)         // 模板卡片点击事件 一键续期
 		// c7n 项目
 		c7nProjectsGroup := v1.Group("c7n/projects")
 		c7nHandler := handler.NewC7nHandler()
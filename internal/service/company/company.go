@@ -0,0 +1,124 @@
+package company
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/wework"
+	"gitee.com/RandolphCYG/akita/pkg/c7n"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// CompanySettingService 公司配置 请求参数
+type CompanySettingService struct {
+	model.CompanySetting
+}
+
+// Fetch 查询全部公司配置
+func (s *CompanySettingService) Fetch() serializer.Response {
+	settings, err := model.FetchCompanySettings()
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: settings}
+}
+
+// Create 校验企业微信部门、标签和C7N项目后新增公司配置
+func (s *CompanySettingService) Create() serializer.Response {
+	s.ID = 0
+	return s.save("增加成功!")
+}
+
+// Update 校验企业微信部门、标签和C7N项目后修改公司配置
+func (s *CompanySettingService) Update() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少公司配置id", nil)
+	}
+	return s.save("修改成功!")
+}
+
+// Delete 删除公司配置
+func (s *CompanySettingService) Delete() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少公司配置id", nil)
+	}
+	if err := model.DeleteCompanySetting(s.ID); err != nil {
+		return serializer.DBErr("删除公司配置失败", err)
+	}
+	return serializer.Response{Data: s.ID, Msg: "删除成功!"}
+}
+
+// save 校验并保存
+func (s *CompanySettingService) save(msg string) serializer.Response {
+	setting := s.CompanySetting
+	if err := validate(&setting); err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if err := model.SaveCompanySetting(&setting); err != nil {
+		return serializer.DBErr("保存公司配置失败", err)
+	}
+	return serializer.Response{Data: setting, Msg: msg}
+}
+
+// validate 校验配置 企业微信部门、标签和C7N项目须存在 并填写其名称
+func validate(setting *model.CompanySetting) error {
+	if setting.ExpireDays < 0 {
+		return errors.New("有效天数不能为负数")
+	}
+	if setting.HrCompanyCode != "" {
+		settings, err := model.FetchCompanySettings()
+		if err != nil {
+			return err
+		}
+		for _, s := range settings {
+			if s.ID != setting.ID && s.HrCompanyCode == setting.HrCompanyCode {
+				return errors.New("HR公司代码[" + s.HrCompanyCode + "]已被公司配置[" + s.Company + "]使用")
+			}
+		}
+	}
+
+	if setting.WeworkDepartId <= 0 {
+		return errors.New("缺少企业微信部门id")
+	}
+	departsMsg, err := wework.FetchDeparts()
+	if err != nil {
+		return errors.Wrap(err, "查询企业微信部门失败")
+	}
+	setting.WeworkDepartName = ""
+	for _, d := range departsMsg.Department {
+		if d.Id == setting.WeworkDepartId {
+			setting.WeworkDepartName = d.Name
+		}
+	}
+	if setting.WeworkDepartName == "" {
+		return errors.New("企业微信部门[" + strconv.Itoa(setting.WeworkDepartId) + "]不存在")
+	}
+
+	setting.WeworkTagName = ""
+	if setting.WeworkTagId > 0 {
+		tagsMsg, err := wework.FetchTags()
+		if err != nil {
+			return errors.Wrap(err, "查询企业微信标签失败")
+		}
+		for _, t := range tagsMsg.Taglist {
+			if t.Tagid == setting.WeworkTagId {
+				setting.WeworkTagName = t.Tagname
+			}
+		}
+		if setting.WeworkTagName == "" {
+			return errors.New("企业微信标签[" + strconv.Itoa(setting.WeworkTagId) + "]不存在")
+		}
+	}
+
+	setting.C7nProjectName = ""
+	if setting.C7nProjectId != "" {
+		project, err := c7n.FetchProjectById(setting.C7nProjectId)
+		if err != nil {
+			return err
+		}
+		setting.C7nProjectName = project.Name
+	}
+	return nil
+}
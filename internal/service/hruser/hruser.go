@@ -2,9 +2,16 @@ package hruser
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"gitee.com/RandolphCYG/akita/internal/middleware/log"
 	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/internal/service/offboarding"
 	"gitee.com/RandolphCYG/akita/pkg/cache"
 	"gitee.com/RandolphCYG/akita/pkg/hr"
 	"gitee.com/RandolphCYG/akita/pkg/serializer"
@@ -14,6 +21,18 @@ import (
 * 这里是外部接口(HR数据)的模型
  */
 
+const (
+	hrFetchTimes = "hr_fetch_times" // 上次成功获取HR数据的时间 full 全量 last 全量或增量
+
+	snapshotFull        = "full"        // 全量刷新
+	snapshotIncremental = "incremental" // 增量刷新
+
+	// 缓存刷新默认校验阈值与快照保留数
+	defaultMinUsers         = 1
+	defaultMaxChangePercent = 20
+	defaultKeepSnapshots    = 30
+)
+
 // HrDataService HR数据查询条件
 type HrDataService struct {
 	// 获取 token 的 URL
@@ -30,36 +49,180 @@ func CacheUsersManual() serializer.Response {
 	return serializer.Response{Data: 0, Msg: "手动触发缓存HR用户成功!"}
 }
 
-// CacheUsers 缓存HR用户
+// CacheUsers 缓存HR用户 开启增量时每天首次全量 之后只合并变化的用户
+// 新数据先写入带版本的键 校验通过后原子替换 失败时保留原缓存
 func CacheUsers() {
 	log.Log.Info("开始缓存HR用户...")
-	var hrDataConn hr.HrDataConn
-	if result := model.DB.First(&hrDataConn); result.Error != nil {
-		log.Log.Error("Fail to get HR data connection cfg!")
+	source, err := NewSource()
+	if err != nil {
+		log.Log.Error("Fail to get HR data source, ", err)
+		return
 	}
-	h := &hr.HrDataConn{
-		UrlGetToken: hrDataConn.UrlGetToken,
-		UrlGetData:  hrDataConn.UrlGetData,
+
+	now := time.Now()
+	mode := snapshotFull
+	var hrUsers []hr.User
+	if inc, ok := source.(hr.IncrementalSource); ok && model.HrSourceCfg.Incremental {
+		if since, full := lastFetchTime(now); !full {
+			mode = snapshotIncremental
+			if hrUsers, err = mergeChangedUsers(inc, since); err == hr.ErrIncrementalUnsupported {
+				mode = snapshotFull
+			}
+		}
+	}
+	if mode == snapshotFull {
+		hrUsers, err = source.FetchUsers()
 	}
-	hrUsers, err := h.FetchData()
 	if err != nil {
 		log.Log.Error(err)
 		return
 	}
 
-	// 先清空缓存
-	_, err = cache.HDel("hr_users")
+	if err = replaceCache(hrUsers, mode, now); err != nil {
+		log.Log.Error("HR用户缓存未更新: ", err)
+		notify.Robot(`<font color="warning">HR用户缓存未更新</font>` + "\n>" + err.Error())
+		return
+	}
+	if mode == snapshotFull {
+		cache.HSet(hrFetchTimes, "full", now.Format(time.RFC3339))
+	}
+	cache.HSet(hrFetchTimes, "last", now.Format(time.RFC3339))
+	log.Log.Info("缓存HR用户成功! 共", len(hrUsers), "人")
+}
+
+// lastFetchTime 上次成功获取的时间 今天还没有全量获取过时需要全量
+func lastFetchTime(now time.Time) (since time.Time, full bool) {
+	rawFull, _ := cache.HGet(hrFetchTimes, "full")
+	rawLast, _ := cache.HGet(hrFetchTimes, "last")
+	fullAt, err1 := time.Parse(time.RFC3339, rawFull)
+	since, err2 := time.Parse(time.RFC3339, rawLast)
+	if err1 != nil || err2 != nil || fullAt.Format("2006-01-02") != now.Format("2006-01-02") {
+		return since, true
+	}
+	return since, false
+}
+
+// mergeChangedUsers 将变化的用户合并到当前缓存 返回合并后的全量用户
+func mergeChangedUsers(source hr.IncrementalSource, since time.Time) (users []hr.User, err error) {
+	changed, err := source.FetchChangedUsers(since)
 	if err != nil {
-		log.Log.Error("Fail to clean ldap users cache,:", err)
+		return
+	}
+	cached, err := cache.HGetAll("hr_users")
+	if err != nil {
+		return nil, errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
 	}
 
-	// 将HR接口元数据写入缓存
-	for _, user := range hrUsers {
+	merged := make(map[string]hr.User, len(cached)) // 工号->用户 姓名变化时替换旧的
+	for _, v := range cached {
+		var u hr.User
+		if json.Unmarshal([]byte(v), &u) == nil {
+			merged[u.Eid] = u
+		}
+	}
+	for _, u := range changed {
+		merged[u.Eid] = u
+	}
+	for _, u := range merged {
+		users = append(users, u)
+	}
+	log.Log.Info("增量获取HR用户 变化", len(changed), "人")
+	return
+}
+
+// replaceCache 写入带版本的新键 校验后用RENAME原子替换hr_users 并保存快照
+func replaceCache(users []hr.User, mode string, now time.Time) (err error) {
+	version := now.Format("20060102150405")
+	newKey := "hr_users:" + version
+	data := make(map[string]interface{}, len(users))
+	for _, user := range users {
 		userData, _ := json.Marshal(user)
-		_, err := cache.HSet("hr_users", user.Name+user.Eid, userData)
-		if err != nil {
-			log.Log.Error("Fail to update ldap users to cache,:", err)
+		data[user.Name+user.Eid] = userData
+	}
+	if err = validateUsers(data); err != nil {
+		return
+	}
+
+	if _, err = cache.HMSet(newKey, data); err != nil {
+		cache.Del(newKey)
+		return
+	}
+	if err = cache.Rename(newKey, "hr_users"); err != nil {
+		cache.Del(newKey)
+		return
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Eid < users[j].Eid })
+	raw, _ := json.Marshal(users)
+	keep := model.HrCacheCfg.KeepSnapshots
+	if keep <= 0 {
+		keep = defaultKeepSnapshots
+	}
+	if e := model.CreateHrSnapshot(&model.HrSnapshot{Version: version, Mode: mode, Total: len(users), Data: string(raw)}, keep); e != nil {
+		log.Log.Error("保存HR快照错误: ", e)
+	}
+	offboarding.DetectRehires(users) // 需在身份登记更新为在职前
+	saveIdentities(users)
+	return
+}
+
+// saveIdentities 以HR数据登记姓名、公司与在职状态
+func saveIdentities(users []hr.User) {
+	rows := make([]model.Identity, 0, len(users))
+	for _, u := range users {
+		state := model.IdentityActive
+		if u.Stat == hr.StatLeft {
+			state = model.IdentityLeft
+		}
+		rows = append(rows, model.Identity{Eid: strings.TrimSpace(u.Eid), Name: u.Name, Company: u.CompanyName, State: state})
+	}
+	if err := model.SaveIdentities(rows, "name", "company", "state"); err != nil {
+		log.Log.Error("登记HR身份错误: ", err)
+	}
+}
+
+// validateUsers 校验新数据 人数过少或与当前缓存相比新增和消失的人数比例过大时拒绝替换
+func validateUsers(data map[string]interface{}) error {
+	minUsers := model.HrCacheCfg.MinUsers
+	if minUsers <= 0 {
+		minUsers = defaultMinUsers
+	}
+	if len(data) < minUsers {
+		return errors.Errorf("HR用户%d人少于最少人数%d", len(data), minUsers)
+	}
+
+	maxChange := model.HrCacheCfg.MaxChangePercent
+	if maxChange == 0 {
+		maxChange = defaultMaxChangePercent
+	}
+	cached, err := cache.HGetAll("hr_users")
+	if err != nil || len(cached) == 0 || maxChange < 0 { // 首次缓存不校验变化比例
+		return nil
+	}
+	changed := 0
+	for k := range data {
+		if _, ok := cached[k]; !ok {
+			changed++
+		}
+	}
+	for k := range cached {
+		if _, ok := data[k]; !ok {
+			changed++
+		}
+	}
+	if percent := changed * 100 / len(cached); percent > maxChange {
+		return errors.Errorf("HR用户新增与消失%d人 占原%d人的%d%%超过阈值%d%%", changed, len(cached), percent, maxChange)
+	}
+	return nil
+}
+
+// NewSource 按配置创建HR数据源 api类型从数据库读取HR接口连接信息
+func NewSource() (hr.HRSource, error) {
+	var hrDataConn hr.HrDataConn
+	if model.HrSourceCfg.Type == "" || model.HrSourceCfg.Type == hr.SourceApi {
+		if result := model.DB.First(&hrDataConn); result.Error != nil {
+			log.Log.Error("Fail to get HR data connection cfg!")
 		}
 	}
-	log.Log.Info("缓存HR用户成功!")
+	return hr.NewSource(model.HrSourceCfg, &hrDataConn)
 }
@@ -0,0 +1,203 @@
+package hruser
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+// SnapshotService HR快照查询与对比 请求参数
+type SnapshotService struct {
+	From uint `form:"from" json:"from"` // 旧快照id
+	To   uint `form:"to" json:"to"`     // 新快照id
+}
+
+// SnapshotDiff 两份快照的人员变化
+type SnapshotDiff struct {
+	From    model.HrSnapshot `json:"from"`
+	To      model.HrSnapshot `json:"to"`
+	Changes hr.Changes       `json:"changes"`
+}
+
+// Fetch 查询最近的快照 不含数据
+func (s *SnapshotService) Fetch() serializer.Response {
+	snapshots, err := model.FetchHrSnapshots(50)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: snapshots}
+}
+
+// Diff 对比两份快照 未指定时与每日报告相同 对比最新快照与今天(周一为周六)之前的最后一份
+func (s *SnapshotService) Diff() serializer.Response {
+	var from, to model.HrSnapshot
+	var err error
+	if s.From == 0 && s.To == 0 {
+		from, to, err = reportSnapshots(time.Now())
+	} else {
+		if from, err = model.FetchHrSnapshot(s.From); err == nil {
+			to, err = model.FetchHrSnapshot(s.To)
+		}
+	}
+	if err != nil {
+		if errors.Cause(err).Error() == serializer.ErrHrSnapshotStale {
+			return serializer.Err(serializer.CodeNotFound, serializer.ErrHrSnapshotStale, err)
+		}
+		return serializer.DBErr("快照不存在", err)
+	}
+	diff, err := diffSnapshots(from, to)
+	if err != nil {
+		return serializer.Err(serializer.CodeParamErr, "快照数据错误", err)
+	}
+	return serializer.Response{Data: diff}
+}
+
+// SendChangeReportManual 手动触发发送人员变化报告
+func SendChangeReportManual() serializer.Response {
+	go func() {
+		SendChangeReport()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发发送人员变化报告成功!"}
+}
+
+// SendChangeReport 对比HR快照 将人员变化发到机器人和邮件 节假日静默
+func SendChangeReport() {
+	now := time.Now()
+	if isSilent, festival := util.IsHolidaySilentMode(now); isSilent {
+		if festival != "" {
+			notify.Robot(`<font color="warning"> ` + festival + "快乐！祝各位阖家团圆、岁岁平安~" + ` </font>`)
+		}
+		return
+	}
+
+	today := now.Format("2006年01月02日")
+	from, to, err := reportSnapshots(now)
+	if err != nil {
+		log.Log.Error("读取HR快照错误: ", err)
+		if errors.Cause(err).Error() == serializer.ErrHrSnapshotStale { // 不能当作人员无变化
+			notify.Robot(`<font color="warning"> ` + today + ` </font>HR缓存未刷新，无法生成人员变化报告，请检查HR接口！`)
+		}
+		return
+	}
+	diff, err := diffSnapshots(from, to)
+	if err != nil {
+		log.Log.Error("对比HR快照错误: ", err)
+		return
+	}
+
+	c := diff.Changes
+	title := fmt.Sprintf(`<font color="warning"> %s </font>人员变化：入职%d 离职%d 调动%d 职务变化%d 公司变化%d`,
+		today, len(c.Joiners), len(c.Leavers), len(c.Transfers), len(c.TitleChanges), len(c.CompanyChanges))
+	if c.Empty() {
+		notify.Robot(`<font color="warning"> ` + today + ` </font>人员无变化`)
+	} else {
+		rows := reportRows(c)
+		temp := `>%s. <font color="info"> %s </font><font color="warning"> %s </font>%s`
+		var msgs string
+		for i, r := range rows {
+			msgs += "\n\n" + fmt.Sprintf(temp, strconv.Itoa(i+1), r[0], r[1]+r[2], reportChange(r[3], r[4]))
+		}
+		// 消息过长 作剪裁处理
+		for _, m := range util.TruncateMsg(title+msgs, "\n\n") {
+			notify.Robot(m)
+		}
+		if err = sendReportMail(today, c); err != nil {
+			log.Log.Error("发送人员变化报告邮件错误: ", err)
+		}
+	}
+	log.Log.Info("人员变化报告发送成功!")
+}
+
+// reportSnapshots 每日报告对比的快照 最新快照与今天零点(周一为周六零点)之前的最后一份 此后没有新快照时报错
+func reportSnapshots(now time.Time) (from, to model.HrSnapshot, err error) {
+	offset := 0
+	if util.IsMonday(now) {
+		offset = -2 // 若是周一 则将周末的变化一并发出
+	}
+	begin, _ := time.ParseInLocation("2006-01-02", now.AddDate(0, 0, offset).Format("2006-01-02"), time.Local)
+	if to, err = model.FetchLatestHrSnapshot(); err != nil {
+		return
+	}
+	if to.CreatedAt.Before(begin) { // HR刷新失败 最新快照即是对比基准
+		err = errors.New(serializer.ErrHrSnapshotStale)
+		return
+	}
+	from, err = model.FetchHrSnapshotBefore(begin)
+	return
+}
+
+// diffSnapshots 反序列化快照数据并对比
+func diffSnapshots(from, to model.HrSnapshot) (diff SnapshotDiff, err error) {
+	var oldUsers, newUsers []hr.User
+	if err = json.Unmarshal([]byte(from.Data), &oldUsers); err != nil {
+		return diff, errors.Wrap(err, "快照["+from.Version+"]")
+	}
+	if err = json.Unmarshal([]byte(to.Data), &newUsers); err != nil {
+		return diff, errors.Wrap(err, "快照["+to.Version+"]")
+	}
+	from.Data, to.Data = "", ""
+	return SnapshotDiff{From: from, To: to, Changes: hr.Diff(oldUsers, newUsers)}, nil
+}
+
+// reportRows 将人员变化展开为 类别 姓名 工号 原 现
+func reportRows(c hr.Changes) (rows [][5]string) {
+	for _, u := range c.Joiners {
+		rows = append(rows, [5]string{"入职", u.Name, u.Eid, "", u.Department})
+	}
+	for _, u := range c.Leavers {
+		rows = append(rows, [5]string{"离职", u.Name, u.Eid, u.Department, ""})
+	}
+	for _, kind := range []struct {
+		name    string
+		changes []hr.Change
+	}{{"调动", c.Transfers}, {"职务变化", c.TitleChanges}, {"公司变化", c.CompanyChanges}} {
+		for _, ch := range kind.changes {
+			rows = append(rows, [5]string{kind.name, ch.User.Name, ch.User.Eid, ch.Old, ch.New})
+		}
+	}
+	return
+}
+
+// reportChange 变化内容的机器人消息格式
+func reportChange(old, new string) string {
+	switch {
+	case old == "":
+		return `<font color="info"> ` + new + ` </font>`
+	case new == "":
+		return `<font color="comment"> ` + old + ` </font>`
+	default:
+		return `<font color="comment"> ` + old + ` </font>到<font color="info"> ` + new + ` </font>`
+	}
+}
+
+// sendReportMail 按邮件模板发送人员变化报告 未配置收件人时不发送
+func sendReportMail(today string, c hr.Changes) error {
+	receivers, err := cache.HGet("third_party_cfgs", "hr_change_report_receivers")
+	if err != nil || receivers == "" {
+		return nil
+	}
+	var rows strings.Builder
+	for _, r := range reportRows(c) {
+		rows.WriteString("<tr>")
+		for _, col := range r {
+			rows.WriteString("<td>" + html.EscapeString(col) + "</td>")
+		}
+		rows.WriteString("</tr>")
+	}
+	_, err = notify.Notify(notify.Recipient{Emails: strings.Split(receivers, ",")}, notify.EventHrChangeReport,
+		notify.Data{"Subject": today + "人员变化报告", "Date": today, "Rows": rows.String()})
+	return err
+}
@@ -0,0 +1,26 @@
+package identity
+
+import (
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// IdentityService 身份查询 请求参数 至少指定一项
+type IdentityService struct {
+	Eid    string `form:"eid" json:"eid"`       // 工号
+	Sam    string `form:"sam" json:"sam"`       // AD SAM账号
+	Userid string `form:"userid" json:"userid"` // 企业微信userid
+	Name   string `form:"name" json:"name"`     // 真实姓名
+}
+
+// Fetch 以任一系统的账号查询此人在各系统中的身份
+func (s *IdentityService) Fetch() serializer.Response {
+	if s.Eid == "" && s.Sam == "" && s.Userid == "" && s.Name == "" {
+		return serializer.ParamErr("请指定工号、SAM账号、企业微信userid或姓名", nil)
+	}
+	identities, err := model.FetchIdentities(model.Identity{Eid: s.Eid, AdSam: s.Sam, WeworkUserid: s.Userid, Name: s.Name})
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: identities}
+}
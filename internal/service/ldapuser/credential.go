@@ -0,0 +1,127 @@
+package ldapuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ldappool "github.com/RandolphCYG/ldapPool"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/unicode"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// createHrUser 为AD中没有的在职新员工创建账号 初始密码不落库 待企业微信账号创建后重置并发送
+func createHrUser(item *model.LdapSyncPlanItem) (err error) {
+	user, err := planItemUser(item)
+	if err != nil {
+		return
+	}
+	if err = FormatData(user.Email, user.Phone); err != nil {
+		return
+	}
+	CheckOuTree(item.NewOu)
+	if _, err = AddUser(user); err != nil {
+		return
+	}
+	log.Log.Info(item.Name, item.Eid, " 新员工:已创建UUAP账号[", user.Sam, "]部门[", item.NewDepart, "]")
+	model.CreateLdapUserDepartRecord(item.Name, item.Eid, "", item.NewDepart, "新员工")
+	saveLdapIdentity(user)
+	model.CreateLdapCredentialDelivery(model.LdapCredentialDelivery{
+		Sam:     user.Sam,
+		Name:    user.DisplayName,
+		Eid:     user.Num,
+		Dn:      user.Dn,
+		Company: user.Company,
+	})
+	return
+}
+
+// planItemUser 由新建明细中保存的HR数据还原待创建的AD用户
+func planItemUser(item *model.LdapSyncPlanItem) (user *LdapAttributes, err error) {
+	var hrUser hr.User
+	if err = json.Unmarshal([]byte(item.Changes), &hrUser); err != nil {
+		return
+	}
+	user = HrToLdapUser(hrUser)
+	user.Dn = "CN=" + user.DisplayName + user.Num + "," + item.NewOu
+	return
+}
+
+// DeliverCredentialsManual 手动触发发送新员工初始密码
+func DeliverCredentialsManual() serializer.Response {
+	go func() {
+		DeliverCredentials()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发发送新员工初始密码成功!"}
+}
+
+// DeliverCredentials 新员工的企业微信账号创建后 重置初始密码并以保密消息发送给本人 依赖企业微信缓存
+func DeliverCredentials() {
+	deliveries, err := model.FetchUndeliveredLdapCredentials()
+	if err != nil {
+		log.Log.Error("读取待发送初始密码的账号错误: ", err)
+		return
+	}
+	for i := range deliveries {
+		d := &deliveries[i]
+		userid, err := fetchWeworkUserid(d.Eid)
+		if err != nil { // 企业微信账号尚未创建 下次再发
+			continue
+		}
+		if err = deliverCredential(d, userid); err != nil {
+			log.Log.Error("发送新员工["+d.Name+d.Eid+"]初始密码错误: ", err)
+			d.Status = model.CredentialFailed
+			d.Result = err.Error()
+		} else {
+			now := time.Now()
+			d.Status = model.CredentialDelivered
+			d.Result = "已发送至企业微信[" + userid + "]"
+			d.DeliveredAt = &now
+			log.Log.Info("企业微信回执消息:用户【" + userid + "】姓名【" + d.Name + "】账号【" + d.Sam + "】状态【新员工初始密码】")
+		}
+		model.UpdateLdapCredentialDelivery(d)
+	}
+}
+
+// deliverCredential 重置密码并发送 密码只存在于发给本人的消息中 首次登录必须修改
+func deliverCredential(d *model.LdapCredentialDelivery, userid string) (err error) {
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		return errors.Wrap(err, serializer.ErrGetLdapConn)
+	}
+	defer LdapConn.Close()
+
+	pwd, err := resetPwd(LdapConn, d.Dn, d.Company)
+	if err != nil {
+		return
+	}
+	_, err = notify.Notify(notify.Recipient{Userid: userid, Channels: []string{model.ChannelWework}}, notify.EventUuapHrRegister,
+		notify.Data{"Name": d.Name, "Sam": d.Sam, "Pwd": pwd})
+	return
+}
+
+// resetPwd 按公司密码策略重置密码 并要求下次登录修改
+func resetPwd(LdapConn *ldappool.PoolConn, dn, company string) (pwd string, err error) {
+	pwd, err = model.LdapFields.PwdPolicy(company).NewPwd()
+	if err != nil {
+		return
+	}
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	pwdEncoded, err := utf16.NewEncoder().String(fmt.Sprintf("%q", pwd))
+	if err != nil {
+		return
+	}
+	modReq := ldap.NewModifyRequest(dn, []ldap.Control{})
+	modReq.Replace("unicodePwd", []string{pwdEncoded})
+	modReq.Replace("pwdLastSet", []string{"0"})
+	err = LdapConn.Modify(modReq)
+	return
+}
@@ -0,0 +1,37 @@
+package ldapuser
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+func TestPlanItemUser(t *testing.T) {
+	model.LdapCfgs.BaseDn = "DC=xxx,DC=com"
+	hrUser := hr.User{Name: "张三", Eid: "1001", Department: "本公司.研发部", Stat: "在职",
+		Mail: "zhangsan@xxx.com", Mobile: "13800000000", CompanyName: "本公司", Title: "工程师"}
+	notFound := func(*LdapAttributes) (*ldap.Entry, error) { return nil, errors.New(serializer.ErrLdapUserNotFound) }
+
+	// AD中没有的新员工生成新建明细 由新建明细还原出待创建的AD用户
+	items, err := planUser(hrUser, notFound)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, model.PlanActionCreate, items[0].Action)
+
+	user, err := planItemUser(&items[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "CN=张三1001,OU=研发部,OU=本公司,DC=xxx,DC=com", user.Dn)
+	assert.Equal(t, "1001", user.Sam)
+	assert.Equal(t, "张三", user.DisplayName)
+	assert.Equal(t, "zhangsan@xxx.com", user.Email)
+	assert.Equal(t, "13800000000", user.Phone)
+	assert.Equal(t, "544", user.AccountCtl)
+	assert.Equal(t, "研发部", user.Depart)
+	assert.Equal(t, "0", user.PwdLastSet)
+}
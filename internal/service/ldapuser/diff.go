@@ -0,0 +1,80 @@
+package ldapuser
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/go-ldap/ldap/v3"
+
+	ldappool "github.com/RandolphCYG/ldapPool"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+)
+
+// AttrChange 单个属性的变化
+type AttrChange struct {
+	Attr string `json:"attr"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Diff 逐字段对比HR数据转换的用户属性与AD中的用户 返回需要修改的属性
+// 为空的属性不修改; UAC只对比禁用位; 账号过期时间0与最大值都表示永不过期
+func (user *LdapAttributes) Diff(entry *ldap.Entry) (changes []AttrChange) {
+	for _, f := range []struct {
+		attr  string
+		value string
+	}{
+		{"employeeNumber", user.Num},
+		{"mail", user.Email},
+		{"mobile", user.Phone},
+		{"displayName", user.DisplayName},
+		{"department", user.Depart},
+		{"company", user.Company},
+		{"title", user.Title},
+	} {
+		if old := entry.GetAttributeValue(f.attr); f.value != "" && f.value != old {
+			changes = append(changes, AttrChange{Attr: f.attr, Old: old, New: f.value})
+		}
+	}
+
+	if user.AccountCtl != "" {
+		old := entry.GetEqualFoldAttributeValue("userAccountControl")
+		uac, _ := strconv.Atoi(old)
+		want, _ := strconv.Atoi(user.AccountCtl)
+		if (uac&uacAccountDisable != 0) != (want&uacAccountDisable != 0) {
+			changes = append(changes, AttrChange{Attr: "userAccountControl", Old: old, New: strconv.Itoa(uac ^ uacAccountDisable)})
+		}
+	}
+
+	old := entry.GetAttributeValue("accountExpires")
+	oldExpire, _ := strconv.ParseInt(old, 10, 64)
+	if normalizeExpire(user.Expire) != normalizeExpire(oldExpire) && user.Expire != 0 {
+		changes = append(changes, AttrChange{Attr: "accountExpires", Old: old, New: strconv.FormatInt(user.Expire, 10)})
+	}
+	return
+}
+
+// normalizeExpire AD中账号过期时间为0或最大值均表示永不过期
+func normalizeExpire(expire int64) int64 {
+	if expire == 0 {
+		return math.MaxInt64
+	}
+	return expire
+}
+
+// modifyAttrs 只修改有变化的属性
+func modifyAttrs(LdapConn *ldappool.PoolConn, dn string, changes []AttrChange) error {
+	modReq := ldap.NewModifyRequest(dn, []ldap.Control{})
+	for _, c := range changes {
+		modReq.Replace(c.Attr, []string{c.New})
+	}
+	return LdapConn.Modify(modReq)
+}
+
+// recordAttrChanges 记录属性变化历史
+func recordAttrChanges(name, eid string, changes []AttrChange) {
+	for _, c := range changes {
+		model.CreateLdapUserAttrRecord(name, eid, c.Attr, c.Old, c.New)
+	}
+}
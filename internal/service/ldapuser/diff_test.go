@@ -0,0 +1,47 @@
+package ldapuser
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	entry := ldap.NewEntry("CN=张三1001,OU=研发部,DC=xxx,DC=com", map[string][]string{
+		"employeeNumber":     {"1001"},
+		"mail":               {"zhangsan@xxx.com"},
+		"mobile":             {"13800000000"},
+		"displayName":        {"张三"},
+		"department":         {"研发部"},
+		"company":            {"本公司"},
+		"title":              {"工程师"},
+		"userAccountControl": {"66048"}, // 启用 密码永不过期
+		"accountExpires":     {"0"},
+	})
+	user := &LdapAttributes{
+		Num:         "1001",
+		Email:       "zhangsan@xxx.com",
+		Phone:       "",
+		DisplayName: "张三",
+		Depart:      "研发部",
+		Company:     "本公司",
+		Title:       "工程师",
+		AccountCtl:  "544",
+		Expire:      math.MaxInt64,
+	}
+	// 无变化 为空的属性不修改 UAC只对比禁用位 过期时间0与最大值等价
+	assert.Empty(t, user.Diff(entry))
+
+	user.Title = "高级工程师"
+	user.AccountCtl = "546"
+	user.Expire = 132000000000000000
+	changes := user.Diff(entry)
+	assert.Equal(t, []AttrChange{
+		{Attr: "title", Old: "工程师", New: "高级工程师"},
+		{Attr: "userAccountControl", Old: "66048", New: "66050"},
+		{Attr: "accountExpires", Old: "0", New: strconv.FormatInt(132000000000000000, 10)},
+	}, changes)
+}
@@ -0,0 +1,275 @@
+package ldapuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+const (
+	uacAccountDisable     = 0x2     // 账号已禁用
+	uacDontExpirePassword = 0x10000 // 密码永不过期
+)
+
+var (
+	// DefaultAccountReminders 默认账号过期提醒规则 过期30天后禁用
+	DefaultAccountReminders = []model.ExpireReminder{
+		{Kind: model.ReminderKindAccount, Days: 14, Channels: model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindAccount, Days: 7, Channels: model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindAccount, Days: -7, Channels: model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindAccount, Days: -30, Channels: model.ChannelEmail, Action: model.ActionDisable},
+	}
+)
+
+// accountExpireEvent 按过期天数和动作选择账号过期提醒的通知事件
+func accountExpireEvent(expireDays int, action string) string {
+	switch {
+	case action == model.ActionDisable:
+		return notify.EventUuapExpiredDisabled
+	case expireDays < 0:
+		return notify.EventUuapExpired
+	default:
+		return notify.EventUuapExpiring
+	}
+}
+
+// ScanExpiredUsersManual 手动触发扫描过期ldap用户
+func ScanExpiredUsersManual() serializer.Response {
+	go func() {
+		ScanExpiredUsers()
+	}()
+	return serializer.Response{Data: 0}
+}
+
+// ScanExpiredUsers 扫描过期ldap用户 按提醒规则通知或禁用 完成后发汇总通知
+func ScanExpiredUsers() {
+	reminders, err := model.FetchExpireReminders(model.ReminderKindAccount)
+	if err != nil {
+		log.Log.Error("读取账号过期提醒规则错误: ", err)
+		return
+	}
+
+	var expiring []sponsoredUser // 需要通知申请人与担保人续期的账号
+	currentTime := time.Now()
+	for _, u := range FetchLdapUsers(&LdapAttributes{}) {
+		uac, _ := strconv.Atoi(u.GetEqualFoldAttributeValue("userAccountControl"))
+		if uac&uacAccountDisable != 0 { // 已禁用的账号无需处理
+			continue
+		}
+		expire, _ := strconv.ParseInt(u.GetAttributeValue("accountExpires"), 10, 64)
+		if expire == 0 || expire == math.MaxInt64 { // 排除不过期的账号
+			continue
+		}
+		expireDays := util.SubDays(util.NtToUnix(expire), currentTime)
+		if r, ok := matchAccountReminder(reminders, expireDays); ok {
+			user := newExpireUser(u)
+			log.Log.Info(user, " 过期天数: ", expireDays)
+			HandleExpiredLdapUsers(user, expireDays, r)
+			if r.Action == model.ActionNotify {
+				expiring = append(expiring, sponsoredUser{Sam: user.Sam, Days: expireDays})
+			}
+		}
+	}
+	log.Log.Info("扫描过期ldap用户完成!")
+
+	NotifySponsors(expiring)
+	SendExpireSummary()
+}
+
+// matchAccountReminder 匹配账号过期提醒规则 通知规则需天数相等 禁用规则在超过宽限期后均命中
+func matchAccountReminder(reminders []model.ExpireReminder, expireDays int) (model.ExpireReminder, bool) {
+	for _, r := range reminders {
+		if r.Action == model.ActionDisable && expireDays <= r.Days {
+			return r, true
+		}
+	}
+	for _, r := range reminders {
+		if r.Action != model.ActionDisable && expireDays == r.Days {
+			return r, true
+		}
+	}
+	return model.ExpireReminder{}, false
+}
+
+// HandleExpiredLdapUsers 处理过期用户 禁用规则先禁用并移动到禁用OU 再按渠道通知 全部记录在案
+func HandleExpiredLdapUsers(user *LdapAttributes, expireDays int, reminder model.ExpireReminder) {
+	record := model.ExpireActionRecord{
+		Kind:   model.ReminderKindAccount,
+		Name:   user.DisplayName,
+		Eid:    user.Num,
+		Sam:    user.Sam,
+		Days:   expireDays,
+		Action: reminder.Action,
+	}
+	if reminder.Action == model.ActionDisable {
+		if err := disableExpiredUser(user); err != nil {
+			log.Log.Error("禁用过期用户【"+user.DisplayName+"】账号【"+user.Sam+"】错误: ", err)
+			record.Result = err.Error()
+			model.CreateExpireActionRecord(record)
+			return
+		}
+		log.Log.Info("用户【" + user.DisplayName + "】账号【" + user.Sam + "】状态【已经过期禁用】")
+		model.SaveIdentity(user.Num, map[string]interface{}{"ad_dn": movedDn(user.Dn, model.LdapFields.BaseDnDisabled), "state": model.IdentityDisabled})
+	}
+
+	channels, err := notifyExpire(user, expireDays, reminder, accountExpireEvent(expireDays, reminder.Action))
+	record.Channels = channels
+	if err != nil {
+		record.Result = err.Error()
+	}
+	model.CreateExpireActionRecord(record)
+}
+
+// disableExpiredUser 禁用过期用户并移动到禁用OU
+func disableExpiredUser(user *LdapAttributes) (err error) {
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	if err = disableDn(LdapConn, user.Dn); err != nil {
+		return
+	}
+	disabledOu := model.LdapFields.BaseDnDisabled
+	if disabledOu == "" || strings.EqualFold(strings.SplitN(user.Dn, ",", 2)[1], disabledOu) {
+		return
+	}
+	return moveDn(LdapConn, user.Dn, disabledOu)
+}
+
+// notifyExpire 按提醒规则的渠道发送过期提醒 即将过期的账号以一键续期卡片代替企微消息 返回实际送达的渠道
+func notifyExpire(user *LdapAttributes, expireDays int, reminder model.ExpireReminder, eventKey string) (channels string, err error) {
+	var sent []string
+	var r notify.Recipient
+	if reminder.HasChannel(model.ChannelEmail) && user.Email != "" {
+		r.Emails = []string{user.Email}
+		r.Channels = append(r.Channels, model.ChannelEmail)
+	}
+	if reminder.HasChannel(model.ChannelWework) && user.Num != "" {
+		userid, e := fetchWeworkUserid(user.Num)
+		switch {
+		case e != nil:
+			log.Log.Warning("未找到用户【" + user.DisplayName + "】工号【" + user.Num + "】的企业微信账号")
+			err = e
+		case eventKey == notify.EventUuapExpiring && reminder.Action == model.ActionNotify:
+			if e = SendRenewalCard(userid, model.RenewalApplyUser{Name: user.DisplayName, Eid: user.Num, Sam: user.Sam, Days: expireDays}); e != nil {
+				log.Log.Error(e)
+				err = e
+			} else {
+				sent = append(sent, model.ChannelWework)
+			}
+		default:
+			r.Userid = userid
+			r.Channels = append(r.Channels, model.ChannelWework)
+		}
+	}
+	if len(r.Channels) == 0 {
+		return strings.Join(sent, ","), err
+	}
+
+	days := strconv.Itoa(int(math.Abs(float64(expireDays))))
+	s, e := notify.Notify(r, eventKey, notify.Data{"Name": user.DisplayName, "Sam": user.Sam, "Days": days})
+	if e != nil {
+		err = e
+	}
+	return strings.Join(append(sent, s...), ","), err
+}
+
+// SendExpireSummary 汇总通知过期处理记录 周一将周末的处理结果一并发出
+func SendExpireSummary() {
+	now := time.Now()
+	var records []model.ExpireActionRecord
+	if util.IsMonday(now) {
+		records, _ = model.FetchExpireActionRecord(-2, 1)
+	} else {
+		records, _ = model.FetchExpireActionRecord(0, 1)
+	}
+
+	today := now.Format("2006年01月02日")
+	tempTitle := `<font color="warning"> ` + today + ` </font>UUAP账号过期处理：`
+	temp := `>%s. <font color="warning"> %s </font>账号<font color="comment"> %s </font>%s<font color="info"> %s </font>%s`
+	var msgs string
+	for i, r := range records {
+		msgs += "\n\n"
+		kind := "账号"
+		if r.Kind == model.ReminderKindPwd {
+			kind = "密码"
+		}
+		if r.Days >= 0 {
+			kind += "剩余" + strconv.Itoa(r.Days) + "天"
+		} else {
+			kind += "已过期" + strconv.Itoa(-r.Days) + "天"
+		}
+		action := "通知" + r.Channels
+		switch r.Action {
+		case model.ActionDisable:
+			action = "禁用"
+		case model.ActionRenewSelf:
+			action = "本人一键续期"
+		case model.ActionRenewSponsor:
+			action = "担保人确认续期"
+		}
+		result := ""
+		if r.Result != "" {
+			result = `<font color="warning">失败</font>`
+		}
+		msgs += fmt.Sprintf(temp, strconv.Itoa(i+1), r.Name, r.Sam, kind, action, result)
+	}
+
+	// 根据是否为节假日决定是否发消息
+	if isSilent, _ := util.IsHolidaySilentMode(now); isSilent {
+		// 消息静默
+	} else {
+		if len(records) == 0 {
+			notify.Robot(`<font color="warning"> ` + today + ` </font>UUAP账号无过期处理`)
+		} else {
+			notify.Robot(tempTitle + msgs) // 消息过长时按行拆分
+		}
+	}
+	log.Log.Info("过期处理汇总通知发送成功!")
+}
+
+// newExpireUser 取过期处理需要的用户属性 dn为用户自身的dn
+func newExpireUser(entry *ldap.Entry) *LdapAttributes {
+	return &LdapAttributes{
+		Num:         entry.GetAttributeValue("employeeNumber"),
+		Sam:         entry.GetAttributeValue("sAMAccountName"),
+		Dn:          entry.DN,
+		DisplayName: entry.GetAttributeValue("displayName"),
+		Email:       entry.GetAttributeValue("mail"),
+	}
+}
+
+// fetchWeworkUserid 根据工号从企微用户缓存中查询userid
+func fetchWeworkUserid(eid string) (userid string, err error) {
+	raw, err := cache.HGet("wework_users", eid)
+	if err != nil {
+		return
+	}
+	var u struct {
+		Userid string `json:"userid"`
+	}
+	if err = json.Unmarshal([]byte(raw), &u); err != nil {
+		return
+	}
+	if u.Userid == "" {
+		err = errors.New("userid is empty")
+	}
+	return u.Userid, err
+}
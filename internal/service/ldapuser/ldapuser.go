@@ -1,22 +1,20 @@
 package ldapuser
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
+	ldappool "github.com/RandolphCYG/ldapPool"
 	"github.com/go-ldap/ldap/v3"
 	"github.com/pkg/errors"
 	"golang.org/x/text/encoding/unicode"
 
 	"gitee.com/RandolphCYG/akita/internal/middleware/log"
 	"gitee.com/RandolphCYG/akita/internal/model"
-	"gitee.com/RandolphCYG/akita/pkg/cache"
-	"gitee.com/RandolphCYG/akita/pkg/email"
-	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
 	"gitee.com/RandolphCYG/akita/pkg/serializer"
 	"gitee.com/RandolphCYG/akita/pkg/util"
 )
@@ -24,16 +22,17 @@ import (
 var (
 	// LDAP 用户属性
 	attrs = []string{
-		"employeeNumber",     // 工号
-		"sAMAccountName",     // SAM账号
-		"distinguishedName",  // dn
-		"UserAccountControl", // 用户账户控制
-		"accountExpires",     // 账户过期时间
-		"pwdLastSet",         // 用户下次登录必须修改密码
-		"whenCreated",        // 创建时间
-		"whenChanged",        // 修改时间
-		"displayName",        // 显示名
-		"sn",                 // 姓
+		"employeeNumber",                      // 工号
+		"sAMAccountName",                      // SAM账号
+		"distinguishedName",                   // dn
+		"UserAccountControl",                  // 用户账户控制
+		"accountExpires",                      // 账户过期时间
+		"pwdLastSet",                          // 用户下次登录必须修改密码
+		"msDS-UserPasswordExpiryTimeComputed", // 域控计算的密码过期时间
+		"whenCreated",                         // 创建时间
+		"whenChanged",                         // 修改时间
+		"displayName",                         // 显示名
+		"sn",                                  // 姓
 		"name",
 		"givenName",  // 名
 		"mail",       // 邮箱
@@ -66,7 +65,8 @@ type LdapAttributes struct {
 	Title          string `json:"title" gorm:"type:varchar(100)"`                          // 职务
 	WeworkExpire   string `json:"wework_expire" gorm:"-"`                                  // 企业微信过期日期
 	WeworkDepartId int    `json:"wework_depart_id" gorm:"-"`                               // 企业微信部门id
-	ProbationFlag  int    `json:"probation_flag" gorm:"-"`                                 // 打试用期标签 1 打标签 0 不打标签
+	WeworkTagId    int    `json:"wework_tag_id" gorm:"-"`                                  // 企业微信标签id 0 不打标签
+	WeworkTagName  string `json:"wework_tag_name" gorm:"-"`                                // 企业微信标签名称
 }
 
 // FetchLdapUsers 多条件查询用户 返回符合搜索条件的用户列表
@@ -157,6 +157,12 @@ func AddUser(user *LdapAttributes) (pwd string, err error) {
 	addReq.Attribute("mail", []string{user.Email})                                             // 邮箱 必填
 	addReq.Attribute("mobile", []string{user.Phone})                                           // 手机号 必填 某些系统需要
 	addReq.Attribute("company", []string{user.Company})
+	if user.Depart != "" {
+		addReq.Attribute("department", []string{user.Depart})
+	}
+	if user.Title != "" {
+		addReq.Attribute("title", []string{user.Title})
+	}
 
 	if err = LdapConn.Add(addReq); err != nil {
 		if ldap.IsErrorWithCode(err, 68) {
@@ -167,9 +173,13 @@ func AddUser(user *LdapAttributes) (pwd string, err error) {
 		return
 	}
 
-	// 初始化复杂密码
+	// 按公司密码策略初始化复杂密码
 	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
-	pwd, err = util.NewPwd(8)                                            // 密码字符串
+	pwd, err = model.LdapFields.PwdPolicy(user.Company).NewPwd() // 密码字符串
+	if err != nil {
+		log.Log.Error("Fail to generate pwd, err: ", err)
+		return
+	}
 	pwdEncoded, err := utf16.NewEncoder().String(fmt.Sprintf("%q", pwd)) // 密码字符字面值
 	if err != nil {
 		log.Log.Error("Fail to encode pwd, err: ", err)
@@ -184,6 +194,17 @@ func AddUser(user *LdapAttributes) (pwd string, err error) {
 	return
 }
 
+// saveLdapIdentity 新建AD账号后登记身份
+func saveLdapIdentity(user *LdapAttributes) {
+	model.SaveIdentity(user.Num, map[string]interface{}{
+		"name":    user.DisplayName,
+		"company": user.Company,
+		"ad_dn":   user.Dn,
+		"ad_sam":  user.Sam,
+		"state":   model.IdentityActive,
+	})
+}
+
 // RetrievePwd 密码找回
 func (user *LdapAttributes) RetrievePwd() (sam string, newPwd string, err error) {
 	// 获取连接
@@ -200,9 +221,13 @@ func (user *LdapAttributes) RetrievePwd() (sam string, newPwd string, err error)
 	}
 
 	sam = entry.GetAttributeValue("sAMAccountName")
-	// 初始化复杂密码
+	// 按公司密码策略初始化复杂密码
 	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
-	newPwd, err = util.NewPwd(8)                                            // 密码字符串
+	newPwd, err = model.LdapFields.PwdPolicy(entry.GetAttributeValue("company")).NewPwd() // 密码字符串
+	if err != nil {
+		log.Log.Error("Fail to generate pwd, err: ", err)
+		return
+	}
 	pwdEncoded, err := utf16.NewEncoder().String(fmt.Sprintf("%q", newPwd)) // 密码字符字面值
 	if err != nil {
 		log.Log.Error("Fail to encode pwd, err: ", err)
@@ -227,9 +252,14 @@ func (user *LdapAttributes) ModifyPwd(newUserPwd string) (err error) {
 	}
 	defer LdapConn.Close()
 
-	entry, err := FetchUser(user)
-	if err != nil {
-		return
+	// 已知DN时直接修改 否则根据cn查询用户
+	dn := user.Dn
+	if dn == "" {
+		entry, err := FetchUser(user)
+		if err != nil {
+			return err
+		}
+		dn = entry.DN
 	}
 	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
 	pwdEncoded, err := utf16.NewEncoder().String(fmt.Sprintf("%q", newUserPwd))
@@ -237,7 +267,7 @@ func (user *LdapAttributes) ModifyPwd(newUserPwd string) (err error) {
 		log.Log.Error("Fail to encode pwd, err: ", err)
 	}
 
-	modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	modReq := ldap.NewModifyRequest(dn, []ldap.Control{})
 	modReq.Replace("unicodePwd", []string{pwdEncoded})
 
 	if err = LdapConn.Modify(modReq); err != nil {
@@ -247,6 +277,57 @@ func (user *LdapAttributes) ModifyPwd(newUserPwd string) (err error) {
 	return
 }
 
+// CheckPwd 校验用户密码 使用独立连接以用户身份绑定 不影响连接池中的管理员连接
+func (user *LdapAttributes) CheckPwd(pwd string) (err error) {
+	if user.Dn == "" || pwd == "" {
+		return errors.New(serializer.ErrOldPwd)
+	}
+	conn, err := ldap.DialURL(model.LdapCfgs.ConnUrl)
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer conn.Close()
+
+	if err = conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	if err = conn.Bind(user.Dn, pwd); err != nil {
+		err = errors.Wrap(err, serializer.ErrOldPwd)
+		return
+	}
+	return
+}
+
+// FetchUserByNum 根据工号(employeeNumber)查询唯一用户 外部公司用户的工号带前缀
+func FetchUserByNum(num string) (result *ldap.Entry, err error) {
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		model.LdapCfgs.BaseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=organizationalPerson)(employeeNumber="+ldap.EscapeFilter(num)+"))",
+		attrs,
+		nil,
+	)
+
+	sr, err := LdapConn.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) != 1 {
+		return nil, errors.New(serializer.ErrLdapUserNotFound)
+	}
+	return sr.Entries[0], nil
+}
+
 // FetchUser 根据cn查询用户 注意: cn查询不到则会返回管理员用户
 func FetchUser(user *LdapAttributes) (result *ldap.Entry, err error) {
 	// 获取连接
@@ -280,7 +361,7 @@ func FetchUser(user *LdapAttributes) (result *ldap.Entry, err error) {
 	if len(sr.Entries) > 0 && len(sr.Entries[0].Attributes) > 0 {
 		result = sr.Entries[0]
 	} else {
-		return nil, errors.Wrap(err, serializer.ErrLdapUserNotFound)
+		return nil, errors.New(serializer.ErrLdapUserNotFound)
 	}
 	return
 }
@@ -319,14 +400,18 @@ func (user *LdapAttributes) MoveDn(newOu string) (err error) {
 	if err != nil {
 		return
 	}
-	cn := strings.Split(entry.DN, ",")[0]
-	movReq := ldap.NewModifyDNRequest(entry.DN, cn, true, newOu)
+	return moveDn(LdapConn, entry.DN, newOu)
+}
+
+// moveDn 将dn移动到新的OU下
+func moveDn(LdapConn *ldappool.PoolConn, dn string, newOu string) (err error) {
+	cn := strings.Split(dn, ",")[0]
+	movReq := ldap.NewModifyDNRequest(dn, cn, true, newOu)
 	if err = LdapConn.Conn.ModifyDN(movReq); err != nil {
 		log.Log.Error("Fail to move user dn, err: ", err)
 		return
 	}
 	return
-
 }
 
 // NewUser 将 ldap.Entry 类型转换为自定义类型 LdapAttributes
@@ -376,50 +461,21 @@ func (user *LdapAttributes) Update() (err error) {
 	}
 
 	if entry != nil { // 当用户记录存在时
-		if user.Num != entry.GetAttributeValue("employeeNumber") &&
-			// user.Sam != entry.GetAttributeValue("sAMAccountName") &&
-			user.Email != entry.GetAttributeValue("mail") &&
-			user.Phone != entry.GetAttributeValue("mobile") &&
-			user.DisplayName != entry.GetAttributeValue("displayName") &&
-			user.Depart != entry.GetAttributeValue("department") &&
-			user.Company != entry.GetAttributeValue("company") &&
-			user.Title != entry.GetAttributeValue("title") &&
-			user.AccountCtl != entry.GetAttributeValue("UserAccountControl") {
-			// 更新用户普通信息
-			modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
-			modReq.Replace("employeeNumber", []string{user.Num})
-			modReq.Replace("mail", []string{user.Email})
-			modReq.Replace("mobile", []string{user.Phone})
-			modReq.Replace("displayName", []string{user.DisplayName})
-			modReq.Replace("department", []string{user.Depart})
-			modReq.Replace("company", []string{user.Company})
-			modReq.Replace("title", []string{user.Title})
-			modReq.Replace("accountExpires", []string{strconv.FormatInt(user.Expire, 10)})
-
-			if err := LdapConn.Modify(modReq); err != nil {
+		// 只修改有变化的属性
+		if changes := user.Diff(entry); len(changes) > 0 {
+			if err = modifyAttrs(LdapConn, entry.DN, changes); err != nil {
 				log.Log.Error("Fail to update user's info: ", err)
+				return
 			}
+			recordAttrChanges(user.DisplayName, user.Num, changes)
 		}
 
 		// 若用户部门或状态发生变化 由部门1>>部门2 由部门1>>离职
 		if user.Dn != "" {
 			if !strings.EqualFold(strings.SplitN(entry.DN, ",", 2)[1], user.Dn) {
 				oldDepart := util.DnToDeparts(strings.Join(strings.Split(entry.DN, ",")[1:], ","))
-				oldDeparts := strings.Split(oldDepart, ".")
 				newDepart := util.DnToDeparts(user.Dn)
-				newDeparts := strings.Split(newDepart, ".")
-				var level string
-				// 若新或旧部门 有一个是外部公司 另一个是内部公司
-				if (strings.Contains(oldDepart, "合作伙伴") && !strings.Contains(newDepart, "合作伙伴")) ||
-					(!strings.Contains(oldDepart, "合作伙伴") && strings.Contains(newDepart, "合作伙伴")) {
-					level = "公司级别"
-				} else {
-					if oldDeparts[len(oldDeparts)-1] != newDeparts[len(newDeparts)-1] {
-						level = "部门级别"
-					} else {
-						level = "结构级别"
-					}
-				}
+				level := DepartLevel(oldDepart, newDepart)
 				log.Log.Info(user.DisplayName, user.Num, " 岗位变动:[", oldDepart, "]转到[", newDepart, "],类型:", level)
 				model.CreateLdapUserDepartRecord(user.DisplayName, user.Num, oldDepart, newDepart, level)
 				CheckOuTree(user.Dn)
@@ -571,6 +627,12 @@ func DepartToDn(depart string) (dn string) {
 	return
 }
 
+// IsDisabled 账号是否已禁用
+func (user *LdapAttributes) IsDisabled() bool {
+	uac, _ := strconv.Atoi(user.AccountCtl)
+	return uac&uacAccountDisable != 0
+}
+
 // Disable ldap用户方法——禁用用户 禁用用户不修改用户的OU
 func (user *LdapAttributes) Disable() (err error) {
 	// 获取连接
@@ -585,8 +647,12 @@ func (user *LdapAttributes) Disable() (err error) {
 	if err != nil {
 		return
 	}
+	return disableDn(LdapConn, entry.DN)
+}
 
-	modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+// disableDn 禁用dn对应的用户
+func disableDn(LdapConn *ldappool.PoolConn, dn string) (err error) {
+	modReq := ldap.NewModifyRequest(dn, []ldap.Control{})
 	// 对用户的普通数据进行选择性更新
 	modReq.Replace("userAccountControl", []string{"546"})
 	if err = LdapConn.Modify(modReq); err != nil {
@@ -640,41 +706,6 @@ type LdapUserService struct {
 	Mobile string `json:"mobile" gorm:"type:varchar(50);not null;comment:手机号"`
 }
 
-// ScanExpiredUsersManual 手动触发扫描过期ldap用户
-func ScanExpiredUsersManual() serializer.Response {
-	go func() {
-		ScanExpiredUsers()
-	}()
-	return serializer.Response{Data: 0}
-}
-
-// ScanExpiredUsers 扫描过期ldap用户
-func ScanExpiredUsers() {
-	LdapUsers := FetchLdapUsers(&LdapAttributes{})
-	currentTime := time.Now()
-	// expireLdapUsers := make([]*ldap.LdapAttributes, 0, 10)  // TODO 预留防止更改传参
-	for _, u := range LdapUsers {
-		expire, _ := strconv.ParseInt(u.GetAttributeValue("accountExpires"), 10, 64)
-		expireDays := util.FormatLdapExpireDays(util.SubDays(util.NtToUnix(expire), currentTime))
-		if expireDays != 106752 { // 排除不过期的账号
-			if expireDays >= -7 && expireDays <= 14 { // 未/已经过期 7 天内的账号
-				ldapUser, err := NewUser(u) // 初始化速度较慢 适用定时异步任务处理少量数据
-				if err != nil {
-					log.Log.Error(err)
-					return
-				}
-				// expireLdapUsers = append(expireLdapUsers, ldapUser)
-				log.Log.Info(ldapUser, " 过期天数: ", expireDays)
-				err = HandleExpiredLdapUsers(ldapUser, expireDays)
-				if err != nil {
-					return
-				} // 处理过期账号
-			}
-		}
-
-	}
-}
-
 // SyncUsersManual 手动触发更新ldap用户
 func SyncUsersManual() serializer.Response {
 	go func() {
@@ -683,118 +714,6 @@ func SyncUsersManual() serializer.Response {
 	return serializer.Response{Data: 0, Msg: "手动触发更新ldap用户成功!"}
 }
 
-// SyncUsers 更新ldap用户
-func SyncUsers() {
-	// 从缓存取HR元数据
-	ldapUsers, err := cache.HGetAll("hr_users")
-	if err != nil {
-		err = errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
-		return
-	}
-
-	log.Log.Info("开始更新ldap用户...")
-	var wg sync.WaitGroup
-	ch := make(chan struct{}, 20)
-	for cn, u := range ldapUsers {
-		ch <- struct{}{}
-		wg.Add(1)
-		go func(cn string, u string) {
-			defer wg.Done()
-			var userStat, dn string
-			var expire int64
-			var user hr.User
-
-			json.Unmarshal([]byte(u), &user) // 反序列化
-			if user.Stat == "离职" {
-				userStat = "546"
-				dn = model.LdapFields.BaseDnDisabled // 禁用部门
-				expire = 0                           // 账号失效
-			} else { // 在职员工
-				userStat = "544"                 // 账号有效
-				dn = DepartToDn(user.Department) // 将部门转换为DN
-				expire = util.ExpireTime(-1)     // 账号永久有效
-			}
-			depart := strings.Split(user.Department, ".")[len(strings.Split(user.Department, "."))-1]
-			name := []rune(user.Name)
-
-			// 将hr数据转换为ldap信息格式
-			ldapUser := &LdapAttributes{
-				Num:         user.Eid,
-				Sam:         user.Eid,
-				DisplayName: user.Name,
-				Email:       user.Mail,
-				Phone:       user.Mobile,
-				Dn:          dn,
-				PwdLastSet:  "0", // 用户下次必须修改密码 0
-				AccountCtl:  userStat,
-				Expire:      expire,
-				Sn:          string(name[0]),
-				Name:        user.Name,
-				GivenName:   string(name[1:]),
-				Company:     user.CompanyName,
-				Depart:      depart,
-				Title:       user.Title,
-			}
-			// 更新用户操作
-			err := ldapUser.Update()
-			if err != nil {
-				if err == errors.Wrap(err, serializer.ErrLdapUserNotFound) {
-					// Do nothing
-				} else {
-					err = errors.Wrap(err, serializer.ErrUpdateUser)
-					log.Log.Error(err)
-				}
-			}
-			<-ch
-		}(cn, u)
-	}
-	wg.Wait() // 等待
-	log.Log.Info("更新ldap用户成功!")
-
-	// 更新完成后，将数据库更改记录统一公布
-	now := time.Now()
-	// 若是周一 则将周末的处理结果一并发出
-	var ldapUserDepartRecords []model.LdapUserDepartRecord
-	if util.IsMonday(now) {
-		ldapUserDepartRecords, _ = model.FetchLdapUserDepartRecord(-2, 1)
-	} else {
-		ldapUserDepartRecords, _ = model.FetchLdapUserDepartRecord(0, 1)
-	}
-
-	today := now.Format("2006年01月02日")
-	tempTitle := `<font color="warning"> ` + today + ` </font>LDAP用户架构变化：`
-	temp := `>%s. <font color="warning"> %s </font>岗位变动:<font color="comment"> %s </font>到<font color="info"> %s </font>级别<font color="warning"> %s </font>`
-	var msgs string
-	for i, r := range ldapUserDepartRecords {
-		if i != len(ldapUserDepartRecords) {
-			msgs += "\n\n"
-		}
-		msgs += fmt.Sprintf(temp, strconv.Itoa(i+1), r.Name, r.OldDepart, r.NewDepart, r.Level)
-	}
-
-	// 根据是否为节假日决定是否发消息
-	if isSilent, festival := util.IsHolidaySilentMode(now); isSilent {
-		if festival != "" {
-			util.SendRobotMsg(`<font color="warning"> ` + festival + "快乐！祝各位阖家团圆、岁岁平安~" + ` </font>`)
-		} else {
-			// 不是节日 只是周末静默
-		}
-	} else {
-		// 工作日正常发送通知
-		if len(ldapUserDepartRecords) == 0 {
-			util.SendRobotMsg(`<font color="warning"> ` + today + ` </font>LDAP用户架构无变化`)
-		} else {
-			// 消息过长 作剪裁处理
-			msgs := util.TruncateMsg(tempTitle+msgs, "\n\n")
-			for _, m := range msgs {
-				util.SendRobotMsg(m)
-			}
-		}
-	}
-
-	log.Log.Info("汇总通知发送成功!")
-}
-
 // FormatData 校验邮箱和手机号格式
 func FormatData(mail string, mobile string) (err error) {
 	if strings.Contains(mail, " ") || strings.Contains(mobile, " ") || len(mobile) != 11 {
@@ -808,19 +727,10 @@ func CreateLdapUser(o model.AccountsRegister, user *LdapAttributes) (err error)
 	// 数据校验 1. 手机号11位 中间不允许有空格 2. 邮箱中间不允许有空格
 	err = FormatData(user.Email, user.Phone)
 	if err != nil {
-		// 创建成功发送企业微信消息
-		createAccountsWeworkMsgTemplate, _ := cache.HGet("wework_msg_templates", "wework_template_uuap_register_err")
-		msg := map[string]interface{}{
-			"touser":  o.Userid,
-			"msgtype": "markdown",
-			"agentid": model.WeworkUuapCfg.AppId,
-			"markdown": map[string]interface{}{
-				"content": fmt.Sprintf(createAccountsWeworkMsgTemplate, o.SpName, user.DisplayName, err),
-			},
-		}
-		_, err = model.CorpAPIMsg.MessageSend(msg)
+		// 格式错误发送企业微信消息
+		_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventUuapRegisterErr,
+			notify.Data{"SpName": o.SpName, "DisplayName": user.DisplayName, "Err": err.Error()})
 		if err != nil {
-			err = errors.Wrap(err, serializer.ErrSendWeMsg)
 			return
 		}
 		log.Log.Info("企业微信回执消息:工单【" + o.SpName + "】用户【" + o.Userid + "】姓名【" + user.DisplayName + "】工号【" + user.Num + "】状态【初次注册-手机号|邮箱格式错误】")
@@ -835,73 +745,20 @@ func CreateLdapUser(o model.AccountsRegister, user *LdapAttributes) (err error)
 		err = HandleUuapDuplicateRegister(user, o)
 		return
 	}
+	saveLdapIdentity(user)
 
 	// 创建成功发送企业微信消息
-	createUuapWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_uuap_register")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-
-	msg := map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(createUuapWeworkMsgTemplate, o.SpName, user.Sam, pwd),
-		},
-	}
-	_, err = model.CorpAPIMsg.MessageSend(msg)
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventUuapRegister,
+		notify.Data{"SpName": o.SpName, "Sam": user.Sam, "Pwd": pwd})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单【" + o.SpName + "】用户【" + o.Userid + "】姓名【" + user.DisplayName + "】工号【" + user.Num + "】状态【初次注册】")
 	return
 }
 
-// HandleExpiredLdapUsers 处理过期用户
-func HandleExpiredLdapUsers(user *LdapAttributes, expireDays int) (err error) {
-	emailTempUuaplateExpiring, err := cache.HGet("email_templates", "email_template_uuap_expiring")
-	if err != nil {
-		log.Log.Error("读取即将过期邮件消息模板错误: ", err)
-	}
-	emailTemplateUuapExpired, err := cache.HGet("email_templates", "email_template_uuap_expired")
-	if err != nil {
-		log.Log.Error("读取已过期邮件消息模板错误: ", err)
-	}
-	emailTemplateUuapExpiredDisabled, err := cache.HGet("email_templates", "email_template_uuap_expired_disabled")
-	if err != nil {
-		log.Log.Error("读取已过期禁用邮件消息模板错误: ", err)
-	}
-
-	if expireDays == 7 || expireDays == 14 { // 即将过期提醒 7|14天前
-		address := []string{user.Email}
-		htmlContent := fmt.Sprintf(emailTempUuaplateExpiring, user.DisplayName, user.Sam, strconv.Itoa(expireDays))
-		err = email.SendMailHtml(address, "UUAP账号即将过期通知", htmlContent)
-		if err != nil {
-			log.Log.Error("发邮件错误: ", err)
-			return
-		}
-		log.Log.Info("邮件发送成功！用户【" + user.DisplayName + "】账号【" + user.Sam + "】状态【即将过期】")
-	} else if expireDays == -7 { // 已经过期提醒 7天后
-		address := []string{user.Email}
-		htmlContent := fmt.Sprintf(emailTemplateUuapExpired, user.DisplayName, user.Sam, strconv.Itoa(-expireDays)) // 此时过期天数为负值
-		email.SendMailHtml(address, "UUAP账号已过期通知", htmlContent)
-		log.Log.Info("邮件发送成功！用户【" + user.DisplayName + "】账号【" + user.Sam + "】状态【已经过期】")
-	} else if expireDays == -30 { // 已经过期且禁用提醒 30天后
-		fmt.Println(emailTemplateUuapExpiredDisabled)
-		log.Log.Info("邮件发送成功！用户【" + user.DisplayName + "】账号【" + user.Sam + "】状态【已经过期禁用】")
-	}
-	return
-}
-
 // HandleUuapDuplicateRegister 处理重复注册
 func HandleUuapDuplicateRegister(user *LdapAttributes, order model.AccountsRegister) (err error) {
-	duplicateRegisterUuapUserWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_uuap_user_duplicate_register")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-
 	// 获取连接
 	LdapConn, err := model.LdapPool.Get()
 	if err != nil {
@@ -916,16 +773,9 @@ func HandleUuapDuplicateRegister(user *LdapAttributes, order model.AccountsRegis
 	}
 	sam := entry.GetAttributeValue("sAMAccountName")
 
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  order.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(duplicateRegisterUuapUserWeworkMsgTemplate, order.SpName, user.DisplayName, sam),
-		},
-	})
+	_, err = notify.Notify(notify.Recipient{Userid: order.Userid}, notify.EventUuapUserDuplicateRegister,
+		notify.Data{"SpName": order.SpName, "DisplayName": user.DisplayName, "Sam": sam})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单【" + order.SpName + "】用户【" + order.Userid + "】姓名【" + user.DisplayName + "】工号【" + user.Num + "】状态【已注册过的UUAP用户】")
@@ -0,0 +1,180 @@
+package ldapuser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// OffboardUser 离职禁用 按工号禁用AD账号并移动到禁用OU 返回移动后的dn 已处理过的账号不重复修改
+func OffboardUser(num string) (dn string, err error) {
+	entry, err := FetchUserByNum(num)
+	if err != nil {
+		return
+	}
+
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	dn = entry.DN
+	uac, _ := strconv.Atoi(entry.GetEqualFoldAttributeValue("userAccountControl"))
+	if uac&uacAccountDisable == 0 {
+		if err = disableDn(LdapConn, dn); err != nil {
+			return
+		}
+	}
+	disabledOu := model.LdapFields.BaseDnDisabled
+	if disabledOu != "" && !strings.EqualFold(parentDn(dn), disabledOu) {
+		if err = moveDn(LdapConn, dn, disabledOu); err != nil {
+			return
+		}
+		dn = movedDn(dn, disabledOu)
+	}
+	return
+}
+
+// RehireUser 复职 按工号启用AD账号并移动到HR部门对应的OU 离职时保存的组在部门未变时恢复 否则移出残留的组 返回移动后的dn
+func RehireUser(user *LdapAttributes, groups []string) (dn string, err error) {
+	entry, err := FetchUserByNum(user.Num)
+	if err != nil {
+		return
+	}
+
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	dn = entry.DN
+	modReq := ldap.NewModifyRequest(dn, []ldap.Control{})
+	modReq.Replace("userAccountControl", []string{user.AccountCtl})
+	modReq.Replace("accountExpires", []string{strconv.FormatInt(user.Expire, 10)})
+	if err = LdapConn.Modify(modReq); err != nil {
+		return
+	}
+	if !strings.EqualFold(parentDn(dn), user.Dn) {
+		CheckOuTree(user.Dn)
+		if err = moveDn(LdapConn, dn, user.Dn); err != nil {
+			return
+		}
+		dn = movedDn(dn, user.Dn)
+	}
+
+	if groups != nil {
+		err = RestoreGroups(user.Num, groups)
+	} else {
+		_, err = RemoveGroups(user.Num)
+	}
+	return
+}
+
+// IsEnabled 按工号判断AD账号是否启用 没有账号时返回false
+func IsEnabled(num string) (enabled bool, err error) {
+	entry, err := FetchUserByNum(num)
+	if err != nil {
+		if errors.Cause(err).Error() == serializer.ErrLdapUserNotFound {
+			return false, nil
+		}
+		return
+	}
+	uac, _ := strconv.Atoi(entry.GetEqualFoldAttributeValue("userAccountControl"))
+	return uac&uacAccountDisable == 0, nil
+}
+
+// RemoveGroups 按工号将用户移出所有AD组 返回移出前的组dn 用于恢复
+func RemoveGroups(num string) (groups []string, err error) {
+	entry, err := fetchUserGroups(num)
+	if err != nil {
+		return
+	}
+
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	for _, g := range entry.GetAttributeValues("memberOf") {
+		modReq := ldap.NewModifyRequest(g, []ldap.Control{})
+		modReq.Delete("member", []string{entry.DN})
+		if err = LdapConn.Modify(modReq); err != nil {
+			return groups, errors.Wrap(err, "移出组["+g+"]失败")
+		}
+		groups = append(groups, g)
+	}
+	return
+}
+
+// RestoreGroups 按工号将用户重新加入AD组 已在组中的跳过
+func RestoreGroups(num string, groups []string) (err error) {
+	entry, err := fetchUserGroups(num)
+	if err != nil {
+		return
+	}
+
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	joined := make(map[string]bool)
+	for _, g := range entry.GetAttributeValues("memberOf") {
+		joined[strings.ToLower(g)] = true
+	}
+	for _, g := range groups {
+		if joined[strings.ToLower(g)] {
+			continue
+		}
+		modReq := ldap.NewModifyRequest(g, []ldap.Control{})
+		modReq.Add("member", []string{entry.DN})
+		if err = LdapConn.Modify(modReq); err != nil {
+			return errors.Wrap(err, "加入组["+g+"]失败")
+		}
+	}
+	return
+}
+
+// fetchUserGroups 按工号查询用户及其所属组
+func fetchUserGroups(num string) (result *ldap.Entry, err error) {
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		model.LdapCfgs.BaseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=organizationalPerson)(employeeNumber="+ldap.EscapeFilter(num)+"))",
+		[]string{"memberOf"},
+		nil,
+	)
+	sr, err := LdapConn.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) != 1 {
+		return nil, errors.New(serializer.ErrLdapUserNotFound)
+	}
+	return sr.Entries[0], nil
+}
@@ -0,0 +1,452 @@
+package ldapuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+const (
+	// 变更计划默认审批阈值
+	defaultMaxCreates  = 50
+	defaultMaxUpdates  = 200
+	defaultMaxMoves    = 100
+	defaultMaxDisables = 30
+)
+
+// SyncPlanService 变更计划查询与审批 请求参数
+type SyncPlanService struct {
+	Id       uint   `form:"id" json:"id"`
+	Operator string `form:"operator" json:"operator"` // 审批人
+}
+
+// Fetch 查询变更计划 指定id时返回明细 否则返回最近的计划列表
+func (s *SyncPlanService) Fetch() serializer.Response {
+	if s.Id != 0 {
+		plan, err := model.FetchLdapSyncPlan(s.Id)
+		if err != nil {
+			return serializer.DBErr("变更计划不存在", err)
+		}
+		return serializer.Response{Data: plan}
+	}
+	plans, err := model.FetchLdapSyncPlans(20)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: plans}
+}
+
+// Approve 批准挂起的变更计划并异步执行
+func (s *SyncPlanService) Approve() serializer.Response {
+	if s.Operator == "" {
+		return serializer.ParamErr("审批人不能为空", nil)
+	}
+	ok, err := model.UpdateLdapSyncPlanStatus(s.Id, model.PlanStatusHeld, model.PlanStatusApproved, s.Operator)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	if !ok {
+		return serializer.ParamErr("变更计划不存在或不是待审批状态", nil)
+	}
+	log.Log.Info("变更计划[" + strconv.Itoa(int(s.Id)) + "]已由[" + s.Operator + "]批准")
+
+	go func() {
+		plan, err := model.FetchLdapSyncPlan(s.Id)
+		if err != nil {
+			log.Log.Error("读取变更计划错误: ", err)
+			return
+		}
+		ExecuteSyncPlan(&plan)
+		SendSyncSummary(&plan)
+	}()
+	return serializer.Response{Data: s.Id, Msg: "变更计划已批准，开始执行!"}
+}
+
+// Reject 驳回挂起的变更计划
+func (s *SyncPlanService) Reject() serializer.Response {
+	if s.Operator == "" {
+		return serializer.ParamErr("审批人不能为空", nil)
+	}
+	ok, err := model.UpdateLdapSyncPlanStatus(s.Id, model.PlanStatusHeld, model.PlanStatusRejected, s.Operator)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	if !ok {
+		return serializer.ParamErr("变更计划不存在或不是待审批状态", nil)
+	}
+	log.Log.Info("变更计划[" + strconv.Itoa(int(s.Id)) + "]已由[" + s.Operator + "]驳回")
+	return serializer.Response{Data: s.Id, Msg: "变更计划已驳回!"}
+}
+
+// SyncUsers 根据HR缓存生成变更计划 未超过阈值则直接执行 超过则挂起等待审批
+func SyncUsers() {
+	log.Log.Info("开始生成ldap用户变更计划...")
+	plan, err := BuildSyncPlan()
+	if err != nil {
+		log.Log.Error("生成ldap用户变更计划错误: ", err)
+		return
+	}
+	if plan.Status == model.PlanStatusApproved {
+		ExecuteSyncPlan(plan)
+	} else {
+		log.Log.Warning("变更计划[" + strconv.Itoa(int(plan.ID)) + "]已挂起: " + plan.Reason)
+	}
+	SendSyncSummary(plan)
+}
+
+// BuildSyncPlan 对比HR缓存与AD 生成并保存变更计划
+func BuildSyncPlan() (plan *model.LdapSyncPlan, err error) {
+	// 从缓存取HR元数据
+	hrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
+		return
+	}
+
+	rehiring := model.FetchPendingRehireEids() // 待处理的复职由离职流程恢复账号
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failed []string
+	items := make([]model.LdapSyncPlanItem, 0)
+	ch := make(chan struct{}, 20)
+	for _, u := range hrUsers {
+		ch <- struct{}{}
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-ch }()
+			var user hr.User
+			if err := json.Unmarshal([]byte(u), &user); err != nil || rehiring[strings.TrimSpace(user.Eid)] {
+				return
+			}
+			userItems, err := planUser(user, FetchUser)
+			mu.Lock()
+			if err != nil {
+				failed = append(failed, user.Name+user.Eid)
+			}
+			items = append(items, userItems...)
+			mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+
+	// 查询AD失败时不生成计划 避免把已有账号当作新建
+	if len(failed) > 0 {
+		err = errors.New("查询AD用户失败" + strconv.Itoa(len(failed)) + "人 不生成变更计划: " + strings.Join(failed, "、"))
+		return
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Action != items[j].Action {
+			return items[i].Action < items[j].Action
+		}
+		return items[i].Eid < items[j].Eid
+	})
+
+	plan = &model.LdapSyncPlan{Items: items}
+	for _, item := range items {
+		switch item.Action {
+		case model.PlanActionCreate:
+			plan.Creates++
+		case model.PlanActionUpdate:
+			plan.Updates++
+		case model.PlanActionMove:
+			plan.Moves++
+		case model.PlanActionDisable:
+			plan.Disables++
+		}
+	}
+	plan.Status = model.PlanStatusApproved
+	if plan.Reason = exceedThreshold(plan); plan.Reason != "" {
+		plan.Status = model.PlanStatusHeld
+	}
+	if err = model.CreateLdapSyncPlan(plan); err != nil {
+		return
+	}
+	model.SupersedeHeldLdapSyncPlans(plan.ID)
+	return
+}
+
+// planUser 对比单个HR用户与AD 生成变更明细 查询AD出错(非未找到用户)时返回错误
+func planUser(user hr.User, fetch func(*LdapAttributes) (*ldap.Entry, error)) (items []model.LdapSyncPlanItem, err error) {
+	if user.Name == "" || user.Eid == "" { // cn为空时会查询到管理员
+		return
+	}
+	ldapUser := HrToLdapUser(user)
+	entry, err := fetch(ldapUser)
+	if err != nil && errors.Cause(err).Error() != serializer.ErrLdapUserNotFound {
+		log.Log.Error("查询AD用户["+user.Name+user.Eid+"]错误: ", err)
+		return nil, err
+	}
+	if entry == nil { // AD中没有该用户
+		err = nil
+		if user.Stat != "离职" { // AD中没有的在职员工
+			changes, _ := json.Marshal(user)
+			items = append(items, model.LdapSyncPlanItem{
+				Action:    model.PlanActionCreate,
+				Name:      user.Name,
+				Eid:       user.Eid,
+				NewOu:     ldapUser.Dn,
+				NewDepart: user.Department,
+				Changes:   string(changes),
+				Status:    model.PlanItemPending,
+			})
+		}
+		return
+	}
+
+	base := model.LdapSyncPlanItem{
+		Name:      user.Name,
+		Eid:       user.Eid,
+		Dn:        entry.DN,
+		OldDepart: util.DnToDeparts(parentDn(entry.DN)),
+		Status:    model.PlanItemPending,
+	}
+
+	// 离职员工禁用并移动到禁用OU
+	if user.Stat == "离职" {
+		uac, _ := strconv.Atoi(entry.GetEqualFoldAttributeValue("userAccountControl"))
+		if uac&uacAccountDisable == 0 || !strings.EqualFold(parentDn(entry.DN), ldapUser.Dn) {
+			item := base
+			item.Action = model.PlanActionDisable
+			item.NewOu = ldapUser.Dn
+			items = append(items, item)
+		}
+		return
+	}
+
+	if changes := ldapUser.Diff(entry); len(changes) > 0 {
+		b, _ := json.Marshal(changes)
+		item := base
+		item.Action = model.PlanActionUpdate
+		item.Changes = string(b)
+		items = append(items, item)
+	}
+
+	// 部门变化 由部门1>>部门2
+	if !strings.EqualFold(parentDn(entry.DN), ldapUser.Dn) {
+		item := base
+		item.Action = model.PlanActionMove
+		item.NewOu = ldapUser.Dn
+		item.NewDepart = util.DnToDeparts(ldapUser.Dn)
+		item.Level = DepartLevel(item.OldDepart, item.NewDepart)
+		items = append(items, item)
+	}
+	return
+}
+
+// exceedThreshold 判断变更计划是否超过审批阈值 返回挂起原因
+func exceedThreshold(plan *model.LdapSyncPlan) string {
+	var reasons []string
+	check := func(name string, n, max, defaultMax int) {
+		if max == 0 {
+			max = defaultMax
+		}
+		if max >= 0 && n > max {
+			reasons = append(reasons, fmt.Sprintf("%s%d超过阈值%d", name, n, max))
+		}
+	}
+	check("新建", plan.Creates, model.SyncCfg.MaxCreates, defaultMaxCreates)
+	check("更新", plan.Updates, model.SyncCfg.MaxUpdates, defaultMaxUpdates)
+	check("移动", plan.Moves, model.SyncCfg.MaxMoves, defaultMaxMoves)
+	check("禁用", plan.Disables, model.SyncCfg.MaxDisables, defaultMaxDisables)
+	return strings.Join(reasons, ";")
+}
+
+// ExecuteSyncPlan 执行已批准的变更计划 依次更新属性、移动部门、禁用、新建
+func ExecuteSyncPlan(plan *model.LdapSyncPlan) {
+	log.Log.Info("开始执行变更计划[" + strconv.Itoa(int(plan.ID)) + "]...")
+	for _, action := range []string{model.PlanActionUpdate, model.PlanActionMove, model.PlanActionDisable, model.PlanActionCreate} {
+		var wg sync.WaitGroup
+		ch := make(chan struct{}, 20)
+		for i := range plan.Items {
+			item := &plan.Items[i]
+			if item.Action != action || item.Status != model.PlanItemPending {
+				continue
+			}
+			ch <- struct{}{}
+			wg.Add(1)
+			go func(item *model.LdapSyncPlanItem) {
+				defer wg.Done()
+				defer func() { <-ch }()
+				if err := executeItem(item); err != nil {
+					log.Log.Error("执行变更["+item.Action+"]用户["+item.Name+item.Eid+"]错误: ", err)
+					item.Status = model.PlanItemFailed
+					item.Result = err.Error()
+				} else if item.Status == model.PlanItemPending {
+					item.Status = model.PlanItemDone
+				}
+				model.UpdateLdapSyncPlanItem(item)
+			}(item)
+		}
+		wg.Wait()
+	}
+	model.UpdateLdapSyncPlanStatus(plan.ID, model.PlanStatusApproved, model.PlanStatusExecuted, plan.Operator)
+	plan.Status = model.PlanStatusExecuted
+	log.Log.Info("执行变更计划[" + strconv.Itoa(int(plan.ID)) + "]完成!")
+}
+
+// executeItem 执行单条变更
+func executeItem(item *model.LdapSyncPlanItem) (err error) {
+	if item.Action == model.PlanActionCreate {
+		return createHrUser(item)
+	}
+
+	// 获取连接
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	switch item.Action {
+	case model.PlanActionUpdate:
+		var changes []AttrChange
+		if err = json.Unmarshal([]byte(item.Changes), &changes); err != nil {
+			return
+		}
+		if err = modifyAttrs(LdapConn, item.Dn, changes); err != nil {
+			return
+		}
+		recordAttrChanges(item.Name, item.Eid, changes)
+	case model.PlanActionMove:
+		CheckOuTree(item.NewOu)
+		if err = moveDn(LdapConn, item.Dn, item.NewOu); err != nil {
+			return
+		}
+		log.Log.Info(item.Name, item.Eid, " 岗位变动:[", item.OldDepart, "]转到[", item.NewDepart, "],类型:", item.Level)
+		model.SaveIdentity(item.Eid, map[string]interface{}{"ad_dn": movedDn(item.Dn, item.NewOu)})
+		model.CreateLdapUserDepartRecord(item.Name, item.Eid, item.OldDepart, item.NewDepart, item.Level)
+	case model.PlanActionDisable: // 由离职流程禁用AD并处理其他系统
+		var created bool
+		if created, err = model.CreateOffboardingTask(item.Eid, item.Name, item.OldDepart, "LDAP同步"); err != nil {
+			return
+		}
+		item.Result = "已创建离职任务"
+		if !created {
+			item.Result = "已有处理中的离职任务"
+		}
+	}
+	return
+}
+
+// SendSyncSummary 变更计划执行结果通知 人员变化见HR人员变化报告 挂起的计划不受节假日静默影响
+func SendSyncSummary(plan *model.LdapSyncPlan) {
+	now := time.Now()
+	today := now.Format("2006年01月02日")
+	planMsg := fmt.Sprintf(`<font color="warning"> %s </font>LDAP变更计划<font color="comment"> #%d </font>新建%d 更新%d 移动%d 禁用%d`,
+		today, plan.ID, plan.Creates, plan.Updates, plan.Moves, plan.Disables)
+
+	if plan.Status == model.PlanStatusHeld {
+		notify.Robot(planMsg + "\n>" + `<font color="warning">已挂起: ` + plan.Reason + `</font>` +
+			"\n>请核对明细后通过接口`/api/v1/ldap/sync/plans/approve`批准或`/api/v1/ldap/sync/plans/reject`驳回")
+		log.Log.Info("汇总通知发送成功!")
+		return
+	}
+
+	// 根据是否为节假日决定是否发消息
+	if isSilent, _ := util.IsHolidaySilentMode(now); isSilent {
+		return
+	}
+	var failed []string
+	for _, item := range plan.Items {
+		if item.Status == model.PlanItemFailed {
+			failed = append(failed, item.Name+item.Eid+"["+item.Action+"]")
+		}
+	}
+	if len(failed) > 0 {
+		planMsg += "\n\n" + `>执行失败<font color="warning"> ` + strconv.Itoa(len(failed)) + ` </font>项: ` + strings.Join(failed, "、")
+	}
+	// 消息过长 作剪裁处理
+	for _, m := range util.TruncateMsg(planMsg, "、") {
+		notify.Robot(m)
+	}
+	log.Log.Info("汇总通知发送成功!")
+}
+
+// HrToLdapUser 将hr数据转换为ldap信息格式 离职员工的Dn为禁用OU
+func HrToLdapUser(user hr.User) *LdapAttributes {
+	var userStat, dn string
+	var expire int64
+	if user.Stat == "离职" {
+		userStat = "546"
+		dn = model.LdapFields.BaseDnDisabled // 禁用部门
+		expire = 0                           // 账号失效
+	} else { // 在职员工
+		userStat = "544"                 // 账号有效
+		dn = DepartToDn(user.Department) // 将部门转换为DN
+		expire = util.ExpireTime(-1)     // 账号永久有效
+	}
+	depart := strings.Split(user.Department, ".")[len(strings.Split(user.Department, "."))-1]
+	name := []rune(user.Name)
+
+	ldapUser := &LdapAttributes{
+		Num:         user.Eid,
+		Sam:         user.Eid,
+		DisplayName: user.Name,
+		Email:       user.Mail,
+		Phone:       user.Mobile,
+		Dn:          dn,
+		PwdLastSet:  "0", // 用户下次必须修改密码 0
+		AccountCtl:  userStat,
+		Expire:      expire,
+		Name:        user.Name,
+		Company:     user.CompanyName,
+		Depart:      depart,
+		Title:       user.Title,
+	}
+	if len(name) > 0 {
+		ldapUser.Sn = string(name[0])
+		ldapUser.GivenName = string(name[1:])
+	}
+	return ldapUser
+}
+
+// DepartLevel 部门变动级别 公司级别、部门级别或结构级别
+func DepartLevel(oldDepart, newDepart string) (level string) {
+	oldDeparts := strings.Split(oldDepart, ".")
+	newDeparts := strings.Split(newDepart, ".")
+	// 若新或旧部门 有一个是外部公司 另一个是内部公司
+	if strings.Contains(oldDepart, "合作伙伴") != strings.Contains(newDepart, "合作伙伴") {
+		level = "公司级别"
+	} else if oldDeparts[len(oldDeparts)-1] != newDeparts[len(newDeparts)-1] {
+		level = "部门级别"
+	} else {
+		level = "结构级别"
+	}
+	return
+}
+
+// movedDn 移动到新OU后的dn 新OU为空时不变
+func movedDn(dn, newOu string) string {
+	if newOu == "" {
+		return dn
+	}
+	return strings.SplitN(dn, ",", 2)[0] + "," + newOu
+}
+
+// parentDn 返回dn的上级OU
+func parentDn(dn string) string {
+	parts := strings.SplitN(dn, ",", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
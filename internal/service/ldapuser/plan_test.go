@@ -0,0 +1,56 @@
+package ldapuser
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+func TestPlanUser(t *testing.T) {
+	log.Log = logrus.New()
+	model.LdapCfgs.BaseDn = "DC=xxx,DC=com"
+	model.LdapFields.BaseDnDisabled = "OU=禁用,DC=xxx,DC=com"
+
+	active := hr.User{Name: "张三", Eid: "1001", Department: "研发部", Stat: "在职"}
+	left := hr.User{Name: "张三", Eid: "1001", Department: "研发部", Stat: "离职"}
+	moved := ldap.NewEntry("CN=张三1001,OU=测试部,DC=xxx,DC=com", map[string][]string{
+		"employeeNumber": {"1001"}, "displayName": {"张三"}, "department": {"研发部"},
+		"userAccountControl": {"544"}, "accountExpires": {"0"},
+	})
+	notFound := func(*LdapAttributes) (*ldap.Entry, error) { return nil, errors.New(serializer.ErrLdapUserNotFound) }
+	empty := func(*LdapAttributes) (*ldap.Entry, error) { return nil, nil }
+	failed := func(*LdapAttributes) (*ldap.Entry, error) { return nil, errors.New("connection reset") }
+	found := func(*LdapAttributes) (*ldap.Entry, error) { return moved, nil }
+
+	cases := []struct {
+		name    string
+		user    hr.User
+		fetch   func(*LdapAttributes) (*ldap.Entry, error)
+		actions []string
+		err     bool
+	}{
+		{"AD未找到在职员工", active, notFound, []string{model.PlanActionCreate}, false},
+		{"AD查询无结果", active, empty, []string{model.PlanActionCreate}, false},
+		{"AD未找到离职员工", left, notFound, nil, false},
+		{"AD查询出错", active, failed, nil, true},
+		{"部门变化", active, found, []string{model.PlanActionMove}, false},
+		{"离职员工禁用", left, found, []string{model.PlanActionDisable}, false},
+	}
+	for _, c := range cases {
+		items, err := planUser(c.user, c.fetch)
+		assert.Equal(t, c.err, err != nil, c.name)
+		var actions []string
+		for _, item := range items {
+			actions = append(actions, item.Action)
+		}
+		assert.Equal(t, c.actions, actions, c.name)
+	}
+}
@@ -0,0 +1,139 @@
+package ldapuser
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+var (
+	// DefaultPwdReminders 默认密码过期提醒规则
+	DefaultPwdReminders = []model.ExpireReminder{
+		{Kind: model.ReminderKindPwd, Days: 14, Channels: model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindPwd, Days: 7, Channels: model.ChannelWework + "," + model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindPwd, Days: 3, Channels: model.ChannelWework + "," + model.ChannelEmail, Action: model.ActionNotify},
+		{Kind: model.ReminderKindPwd, Days: 1, Channels: model.ChannelWework + "," + model.ChannelEmail, Action: model.ActionNotify},
+	}
+)
+
+// FetchMaxPwdAge 查询域密码最长使用期限 返回0表示密码永不过期
+func FetchMaxPwdAge() (maxPwdAge time.Duration, err error) {
+	LdapConn, err := model.LdapPool.Get()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetLdapConn)
+		return
+	}
+	defer LdapConn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		model.LdapCfgs.BaseDn,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"maxPwdAge"},
+		nil,
+	)
+	sr, err := LdapConn.Search(searchRequest)
+	if err != nil {
+		return
+	}
+	if len(sr.Entries) != 1 {
+		err = errors.New("fail to fetch maxPwdAge")
+		return
+	}
+	// 以负的100纳秒为单位 最小值表示永不过期
+	raw, err := strconv.ParseInt(sr.Entries[0].GetAttributeValue("maxPwdAge"), 10, 64)
+	if err != nil || raw == math.MinInt64 {
+		return
+	}
+	maxPwdAge = time.Duration(-raw) * 100
+	return
+}
+
+// PwdExpireTime 计算用户密码过期时间 优先使用域控计算的过期时间 ok为false表示密码不会过期
+func PwdExpireTime(entry *ldap.Entry, maxPwdAge time.Duration) (expireTime time.Time, ok bool) {
+	uac, _ := strconv.Atoi(entry.GetEqualFoldAttributeValue("userAccountControl"))
+	if uac&uacAccountDisable != 0 || uac&uacDontExpirePassword != 0 {
+		return
+	}
+	if computed := entry.GetAttributeValue("msDS-UserPasswordExpiryTimeComputed"); computed != "" {
+		nt, err := strconv.ParseInt(computed, 10, 64)
+		// 0 表示下次登录须修改密码 最大值表示永不过期
+		if err != nil || nt == 0 || nt == math.MaxInt64 {
+			return
+		}
+		return util.NtToUnix(nt), true
+	}
+	pwdLastSet, _ := strconv.ParseInt(entry.GetAttributeValue("pwdLastSet"), 10, 64)
+	if pwdLastSet == 0 || maxPwdAge == 0 {
+		return
+	}
+	return util.NtToUnix(pwdLastSet).Add(maxPwdAge), true
+}
+
+// ScanPwdExpiringUsersManual 手动触发扫描密码即将过期的ldap用户
+func ScanPwdExpiringUsersManual() serializer.Response {
+	go func() {
+		ScanPwdExpiringUsers()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发扫描密码即将过期的ldap用户成功!"}
+}
+
+// ScanPwdExpiringUsers 扫描密码即将过期的ldap用户 按提醒规则发企微或邮件通知
+func ScanPwdExpiringUsers() {
+	reminders, err := model.FetchExpireReminders(model.ReminderKindPwd)
+	if err != nil {
+		log.Log.Error("读取密码过期提醒规则错误: ", err)
+		return
+	}
+	if len(reminders) == 0 {
+		return
+	}
+	maxPwdAge, err := FetchMaxPwdAge()
+	if err != nil {
+		log.Log.Warning("读取域密码最长使用期限错误: ", err)
+	}
+
+	currentTime := time.Now()
+	for _, u := range FetchLdapUsers(&LdapAttributes{}) {
+		expireTime, ok := PwdExpireTime(u, maxPwdAge)
+		if !ok {
+			continue
+		}
+		expireDays := util.SubDays(expireTime, currentTime)
+		for _, r := range reminders {
+			if r.Days != expireDays {
+				continue
+			}
+			HandlePwdExpiringUsers(newExpireUser(u), expireDays, r)
+			break
+		}
+	}
+	log.Log.Info("扫描密码即将过期的ldap用户完成!")
+}
+
+// HandlePwdExpiringUsers 按提醒规则的渠道发送密码即将过期提醒并记录
+func HandlePwdExpiringUsers(user *LdapAttributes, expireDays int, reminder model.ExpireReminder) {
+	channels, err := notifyExpire(user, expireDays, reminder, notify.EventPwdExpiring)
+	record := model.ExpireActionRecord{
+		Kind:     model.ReminderKindPwd,
+		Name:     user.DisplayName,
+		Eid:      user.Num,
+		Sam:      user.Sam,
+		Days:     expireDays,
+		Action:   model.ActionNotify,
+		Channels: channels,
+	}
+	if err != nil {
+		record.Result = err.Error()
+	}
+	model.CreateExpireActionRecord(record)
+}
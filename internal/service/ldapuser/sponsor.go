@@ -0,0 +1,212 @@
+package ldapuser
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/wework/card"
+)
+
+const (
+	renewalApplyExpire = 7 * 24 * time.Hour // 一键续期链接有效期
+	sponsorCardMaxRows = 8                  // 卡片描述长度有限 最多列出的账号数
+
+	CardSource        = "UUAP账号"   // 卡片来源
+	CardButtonRenew   = "renew"    // 续期按钮key
+	CardQuestionRenew = "accounts" // 确认续期卡片中账号多选的key
+)
+
+// sponsoredUser 即将过期的账号
+type sponsoredUser struct {
+	Sam  string
+	Days int
+}
+
+// NotifySponsors 按申请人与担保人汇总即将过期的账号 给每人发送确认续期卡片 勾选的账号直接续期
+func NotifySponsors(expiring []sponsoredUser) {
+	recipients := make(map[string][]model.RenewalApplyUser)
+	for _, e := range expiring {
+		s, err := model.FetchAccountSponsor(e.Sam)
+		if err != nil { // 无工单记录的账号
+			continue
+		}
+		u := model.RenewalApplyUser{Name: s.Name, Eid: s.Eid, Sam: s.Sam, Days: e.Days}
+		if s.Applicant != "" {
+			recipients[s.Applicant] = append(recipients[s.Applicant], u)
+		}
+		if s.SponsorEid == "" {
+			continue
+		}
+		sponsor, err := fetchWeworkUserid(s.SponsorEid)
+		if err != nil {
+			log.Log.Warning("未找到担保人工号【" + s.SponsorEid + "】的企业微信账号")
+			continue
+		}
+		if sponsor != s.Applicant {
+			recipients[sponsor] = append(recipients[sponsor], u)
+		}
+	}
+
+	for userid, users := range recipients {
+		if err := sendSponsorCards(userid, users); err != nil {
+			log.Log.Error("给申请人【"+userid+"】发送账号即将过期卡片错误: ", err)
+		}
+	}
+}
+
+// SendRenewalCard 给本人发送账号即将过期卡片 点击按钮后按续期策略直接续期 没有SAM账号的为企业微信账号
+func SendRenewalCard(userid string, u model.RenewalApplyUser) (err error) {
+	payload, _ := json.Marshal([]model.RenewalApplyUser{u})
+	task, err := model.CreateCardTask(model.CardKindRenewal, userid, payload)
+	if err != nil {
+		return
+	}
+	days := strconv.Itoa(model.RenewalCfg.RenewalDays())
+	account := u.Sam
+	if account == "" {
+		account = "企业微信账号"
+	}
+	c := card.Card{
+		Source:   CardSource,
+		Title:    "您的账号即将过期",
+		Desc:     "剩余" + strconv.Itoa(u.Days) + "天",
+		SubTitle: "如仍需使用，请点击续期" + days + "天；已多次续期的账号须申请人确认或提交账号续期审批",
+		TaskId:   task.TaskId,
+		Fields: []card.Field{
+			{Key: "姓名", Value: u.Name},
+			{Key: "账号", Value: account},
+			{Key: "过期日期", Value: time.Now().AddDate(0, 0, u.Days).Format("2006-01-02")},
+		},
+	}
+	_, err = model.CorpAPIMsg.MessageSend(card.Message(userid, model.WeworkUuapCfg.AppId, c.ButtonCard(card.Button{Text: "续期" + days + "天", Key: CardButtonRenew, Style: 1})))
+	if err != nil {
+		return errors.Wrap(err, serializer.ErrSendWeMsg)
+	}
+	log.Log.Info("企业微信回执消息:用户【" + userid + "】姓名【" + u.Name + "】账号【" + account + "】状态【一键续期卡片】")
+	return
+}
+
+// sendSponsorCards 给申请人或担保人发送确认续期卡片 每张卡片最多列出投票选项上限个账号 默认全部勾选
+func sendSponsorCards(userid string, users []model.RenewalApplyUser) error {
+	for start := 0; start < len(users); start += card.MaxOptions {
+		end := start + card.MaxOptions
+		if end > len(users) {
+			end = len(users)
+		}
+		if err := sendSponsorCard(userid, users[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendSponsorCard 发送确认续期卡片 选项id为账号在列表中的下标
+func sendSponsorCard(userid string, users []model.RenewalApplyUser) (err error) {
+	payload, _ := json.Marshal(users)
+	task, err := model.CreateCardTask(model.CardKindSponsor, userid, payload)
+	if err != nil {
+		return
+	}
+	options := make([]card.Option, 0, len(users))
+	for i, u := range users {
+		options = append(options, card.Option{Id: strconv.Itoa(i), Text: renewalRow(u), Checked: true})
+	}
+	c := card.Card{
+		Source:   CardSource,
+		Title:    "您申请的账号即将过期",
+		Desc:     strconv.Itoa(len(users)) + "个账号",
+		SubTitle: "请勾选仍需使用的账号，确认后续期" + strconv.Itoa(model.RenewalCfg.RenewalDays()) + "天",
+		TaskId:   task.TaskId,
+	}
+	_, err = model.CorpAPIMsg.MessageSend(card.Message(userid, model.WeworkUuapCfg.AppId, c.VoteCard(CardQuestionRenew, options, card.Button{Text: "确认续期", Key: CardButtonRenew})))
+	if err != nil {
+		return errors.Wrap(err, serializer.ErrSendWeMsg)
+	}
+	log.Log.Info("企业微信回执消息:用户【" + userid + "】状态【" + strconv.Itoa(len(users)) + "个申请的账号即将过期 确认续期卡片】")
+	return
+}
+
+// renewalRow 账号及剩余天数
+func renewalRow(u model.RenewalApplyUser) string {
+	if u.Days >= 0 {
+		return u.Name + "(" + u.Sam + ") 剩余" + strconv.Itoa(u.Days) + "天"
+	}
+	return u.Name + "(" + u.Sam + ") 已过期" + strconv.Itoa(-u.Days) + "天"
+}
+
+// SendRenewalApplyCard 发送账号续期审批卡片 链接点击后以接收人身份提交账号续期审批 用于不满足一键续期策略的账号
+func SendRenewalApplyCard(userid string, users []model.RenewalApplyUser) (err error) {
+	token, err := newRenewalToken()
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(model.RenewalApply{Userid: userid, Users: users})
+	if err = cache.SetEx(model.RenewalApplyPrefix+token, data, renewalApplyExpire); err != nil {
+		return
+	}
+
+	akitaBaseUrl, err := cache.HGet("third_party_cfgs", "akita_base_url")
+	if err != nil {
+		err = errors.New("读取三方系统-akita地址配置错误: " + err.Error())
+		return
+	}
+	var rows []string
+	for i, u := range users {
+		if i == sponsorCardMaxRows {
+			rows = append(rows, "等"+strconv.Itoa(len(users))+"个账号")
+			break
+		}
+		rows = append(rows, renewalRow(u))
+	}
+	description, err := notify.Render(notify.EventSponsorExpiring, model.ChannelWework,
+		notify.Data{"Count": strconv.Itoa(len(users)), "Rows": strings.Join(rows, "\n")})
+	if err != nil {
+		log.Log.Error("渲染企业微信消息模板错误: ", err)
+	}
+
+	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
+		"touser":  userid,
+		"msgtype": "textcard",
+		"agentid": model.WeworkUuapCfg.AppId,
+		"textcard": map[string]interface{}{
+			"title":       "您申请的账号即将过期",
+			"description": description,
+			"url":         oauthUrl(strings.TrimRight(akitaBaseUrl, "/") + "/api/v1/wework/renewal/page?token=" + token),
+			"btntxt":      "一键续期",
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrSendWeMsg)
+		return
+	}
+	log.Log.Info("企业微信回执消息:用户【" + userid + "】状态【" + strconv.Itoa(len(users)) + "个申请的账号即将过期】")
+	return
+}
+
+// oauthUrl 企微OAuth链接 认证后携带code跳转到redirect
+func oauthUrl(redirect string) string {
+	return "https://open.weixin.qq.com/connect/oauth2/authorize?appid=" + model.WeworkUuapCfg.CorpId +
+		"&redirect_uri=" + url.QueryEscape(redirect) + "&response_type=code&scope=snsapi_base" +
+		"&agentid=" + strconv.Itoa(model.WeworkUuapCfg.AppId) + "#wechat_redirect"
+}
+
+// newRenewalToken 生成一键续期链接token
+func newRenewalToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"sort"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+)
+
+const (
+	EventRobot                       = "robot"                          // 群机器人消息
+	EventHrChangeReport              = "hr_change_report"               // 人员变化报告
+	EventOffboardingChecklist        = "offboarding_checklist"          // 离职清单
+	EventPwdExpiring                 = "pwd_expiring"                   // 密码即将过期
+	EventUuapExpiring                = "uuap_expiring"                  // 账号即将过期
+	EventUuapExpired                 = "uuap_expired"                   // 账号已过期
+	EventUuapExpiredDisabled         = "uuap_expired_disabled"          // 账号已过期禁用
+	EventSponsorExpiring             = "sponsor_expiring"               // 申请的账号需提交续期审批 用于卡片描述
+	EventProbationEnd                = "probation_end"                  // 转正祝贺
+	EventPwdResetCode                = "pwd_reset_code"                 // 重置密码验证码
+	EventPwdRetrieve                 = "pwd_retrieve"                   // 密码找回工单
+	EventUuapRegister                = "uuap_register"                  // 账号注册工单 初始密码
+	EventUuapHrRegister              = "uuap_hr_register"               // HR新员工 初始密码
+	EventUuapRegisterErr             = "uuap_register_err"              // 账号注册工单失败
+	EventUuapUserDuplicateRegister   = "uuap_user_duplicate_register"   // UUAP账号重复注册
+	EventWeworkUserDuplicateRegister = "wework_user_duplicate_register" // 企业微信账号重复注册
+	EventUuapDisable                 = "uuap_disable"                   // 账号禁用工单
+	EventUuapRenewal                 = "uuap_renewal"                   // UUAP账号续期工单
+	EventWeworkRenewal               = "wework_renewal"                 // 企业微信账号续期工单
+	EventWeworkRenewalErr            = "wework_renewal_err"             // 企业微信账号续期失败
+	EventWeworkFindUserErr           = "wework_find_user_err"           // 工单中的人员未找到UUAP账号
+	EventC7nFindUserErr              = "c7n_find_user_err"              // 工单中的人员未找到C7N用户
+	EventC7nFindProjectErr           = "c7n_find_project_err"           // 工单中的C7N项目不存在
+	EventRenewalResult               = "renewal_result"                 // 一键续期结果回执
+)
+
+// Event 通知事件 模板按渠道取 wework_msg_templates 中的 wework_template_<Key> 和 email_templates 中的 email_template_<Key>
+type Event struct {
+	Key       string   `json:"key"`
+	Channels  []string `json:"channels"`  // 默认渠道
+	Subject   string   `json:"subject"`   // 邮件标题 参数中的Subject优先
+	Args      []string `json:"args"`      // 模板参数名 模板中以{{.参数名}}引用 旧模板迁移时按%s的顺序对应
+	Raw       bool     `json:"raw"`       // 无模板 内容为参数中的Content
+	Sensitive bool     `json:"sensitive"` // 含密码等敏感信息 发件箱不保存内容 失败不重试
+	Safe      bool     `json:"safe"`      // 企微保密消息 以文本发送 不可转发 带水印
+}
+
+var (
+	wework      = []string{model.ChannelWework}
+	weworkEmail = []string{model.ChannelWework, model.ChannelEmail}
+
+	events = map[string]Event{}
+)
+
+func init() {
+	for _, e := range []Event{
+		{Key: EventRobot, Channels: []string{model.ChannelRobot}, Raw: true},
+		{Key: EventHrChangeReport, Channels: []string{model.ChannelEmail}, Subject: "人员变化报告", Args: []string{"Date", "Rows"}},
+		{Key: EventOffboardingChecklist, Channels: []string{model.ChannelEmail}, Subject: "离职清单", Args: []string{"Name", "Eid", "Department", "Rows"}},
+		{Key: EventPwdExpiring, Channels: weworkEmail, Subject: "UUAP账号密码即将过期通知", Args: []string{"Name", "Sam", "Days"}},
+		{Key: EventUuapExpiring, Channels: weworkEmail, Subject: "UUAP账号即将过期通知", Args: []string{"Name", "Sam", "Days"}},
+		{Key: EventUuapExpired, Channels: weworkEmail, Subject: "UUAP账号已过期通知", Args: []string{"Name", "Sam", "Days"}},
+		{Key: EventUuapExpiredDisabled, Channels: weworkEmail, Subject: "UUAP账号已过期禁用通知", Args: []string{"Name", "Sam", "Days"}},
+		{Key: EventSponsorExpiring, Channels: wework, Args: []string{"Count", "Rows"}},
+		{Key: EventProbationEnd, Channels: wework, Args: []string{"Name", "StartDate"}},
+		{Key: EventPwdResetCode, Channels: wework, Args: []string{"Name", "Code", "Minutes"}, Sensitive: true},
+		{Key: EventPwdRetrieve, Channels: wework, Args: []string{"SpName", "DisplayName", "Sam", "Pwd"}, Sensitive: true},
+		{Key: EventUuapRegister, Channels: wework, Args: []string{"SpName", "Sam", "Pwd"}, Sensitive: true},
+		{Key: EventUuapHrRegister, Channels: wework, Args: []string{"Name", "Sam", "Pwd"}, Sensitive: true, Safe: true},
+		{Key: EventUuapRegisterErr, Channels: wework, Args: []string{"SpName", "DisplayName", "Err"}},
+		{Key: EventUuapUserDuplicateRegister, Channels: wework, Args: []string{"SpName", "DisplayName", "Sam"}},
+		{Key: EventWeworkUserDuplicateRegister, Channels: wework, Args: []string{"SpName", "DisplayName", "Sam"}},
+		{Key: EventUuapDisable, Channels: wework, Args: []string{"SpName", "DisplayName"}},
+		{Key: EventUuapRenewal, Channels: wework, Args: []string{"SpName", "DisplayName", "Days"}},
+		{Key: EventWeworkRenewal, Channels: wework, Args: []string{"SpName", "Name", "Days"}},
+		{Key: EventWeworkRenewalErr, Channels: wework, Args: []string{"SpName", "Name", "Eid"}},
+		{Key: EventWeworkFindUserErr, Channels: wework, Args: []string{"SpName", "DisplayName", "Name", "Eid"}},
+		{Key: EventC7nFindUserErr, Channels: wework, Args: []string{"SpName", "DisplayName", "Name", "Eid"}},
+		{Key: EventC7nFindProjectErr, Channels: wework, Args: []string{"SpName", "DisplayName", "Project"}},
+		{Key: EventRenewalResult, Channels: wework, Raw: true},
+	} {
+		events[e.Key] = e
+	}
+}
+
+// Events 全部通知事件 按事件名排序
+func Events() []Event {
+	list := make([]Event, 0, len(events))
+	for _, e := range events {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
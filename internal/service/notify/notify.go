@@ -0,0 +1,272 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/email"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+/*
+* 统一通知 按事件解析模板 按事件默认渠道、指定渠道和个人偏好选择渠道
+* 每个渠道先记录到发件箱再立即发送一次 失败的由定时任务NotifyDeliver按退避重试
+*
+ */
+
+const deliverBatch = 100 // 每次重试的最多消息数
+
+// Recipient 接收人 企微userid用于企微应用消息 邮箱用于邮件 群机器人无需接收人
+type Recipient struct {
+	Userid   string
+	Emails   []string
+	Channels []string // 指定渠道 如过期提醒规则的渠道 为空按事件默认渠道
+}
+
+// Data 模板参数 Subject为邮件标题 Content为无模板事件的内容
+type Data map[string]interface{}
+
+// Notify 渲染模板并按渠道记录到发件箱后立即发送 返回首次即送达的渠道 任一渠道失败时返回错误
+func Notify(r Recipient, eventKey string, data Data) (sent []string, err error) {
+	e, ok := events[eventKey]
+	if !ok {
+		return nil, errors.New("未知的通知事件[" + eventKey + "]")
+	}
+	var prefs []model.NotifyPreference
+	if r.Userid != "" {
+		prefs, _ = model.FetchNotifyPreferences(r.Userid)
+	}
+	channels := resolveChannels(e, r, prefs)
+	if len(channels) == 0 {
+		return nil, errors.New("通知事件[" + eventKey + "]没有可用的接收渠道")
+	}
+
+	var errs []string
+	for _, channel := range channels {
+		content, err := Render(eventKey, channel, data)
+		if err != nil {
+			errs = append(errs, channel+": "+err.Error())
+			continue
+		}
+		o := &model.NotifyOutbox{
+			EventKey:  eventKey,
+			Channel:   channel,
+			Target:    target(channel, r),
+			Subject:   subject(e, data),
+			Content:   content,
+			Sensitive: e.Sensitive,
+			Status:    model.NotifyPending,
+			NextAt:    time.Now().Add(model.NotifyCfg.NotifyBackoff(1)), // 立即发送未完成前不被重试
+		}
+		if e.Sensitive {
+			o.Content = ""
+		}
+		if err = model.CreateNotifyOutbox(o); err != nil {
+			log.Log.Error("记录通知["+eventKey+"]错误: ", err)
+		}
+		if err = attempt(o, content); err != nil {
+			errs = append(errs, channel+": "+err.Error())
+			continue
+		}
+		sent = append(sent, channel)
+	}
+	if len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
+	return
+}
+
+// Robot 发送群机器人消息 长消息按行拆分
+func Robot(content string) {
+	if _, err := Notify(Recipient{}, EventRobot, Data{"Content": content}); err != nil {
+		log.Log.Error("发送机器人消息错误: ", err)
+	}
+}
+
+// Render 渲染事件某渠道的消息内容
+func Render(eventKey, channel string, data Data) (string, error) {
+	e, ok := events[eventKey]
+	if !ok {
+		return "", errors.New("未知的通知事件[" + eventKey + "]")
+	}
+	if e.Raw {
+		content, _ := data["Content"].(string)
+		return content, nil
+	}
+	hash, key := templateKey(channel, eventKey)
+	if key == "" {
+		return "", errors.New("渠道[" + channel + "]没有消息模板")
+	}
+	tpl, err := cache.HGet(hash, key)
+	if err != nil {
+		return "", errors.Wrap(err, "读取消息模板["+key+"]错误")
+	}
+	return renderTemplate(tpl, e, data)
+}
+
+// templateKey 渠道对应的模板缓存与模板名
+func templateKey(channel, eventKey string) (hash, key string) {
+	switch channel {
+	case model.ChannelWework:
+		return "wework_msg_templates", "wework_template_" + eventKey
+	case model.ChannelEmail:
+		return "email_templates", "email_template_" + eventKey
+	}
+	return "", ""
+}
+
+// resolveChannels 选择渠道 指定渠道优先于事件默认渠道 个人偏好在事件支持的渠道中选择 最后去掉缺少接收人的渠道
+func resolveChannels(e Event, r Recipient, prefs []model.NotifyPreference) (channels []string) {
+	supported := e.Channels
+	if len(r.Channels) > 0 {
+		channels = r.Channels
+		if !e.Raw {
+			supported = union(e.Channels, r.Channels)
+		}
+	} else {
+		channels = e.Channels
+	}
+
+	var pref *model.NotifyPreference
+	for i := range prefs {
+		if prefs[i].EventKey == e.Key || prefs[i].EventKey == "" && pref == nil {
+			pref = &prefs[i]
+		}
+	}
+	if pref != nil {
+		channels = nil
+		for _, c := range strings.Split(pref.Channels, ",") {
+			if c = strings.TrimSpace(c); contains(supported, c) {
+				channels = append(channels, c)
+			}
+		}
+	}
+
+	var res []string
+	for _, c := range channels {
+		if contains(res, c) ||
+			c == model.ChannelWework && r.Userid == "" ||
+			c == model.ChannelEmail && len(r.Emails) == 0 {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// target 渠道的接收人
+func target(channel string, r Recipient) string {
+	switch channel {
+	case model.ChannelWework:
+		return r.Userid
+	case model.ChannelEmail:
+		return strings.Join(r.Emails, ",")
+	}
+	return ""
+}
+
+// subject 邮件标题
+func subject(e Event, data Data) string {
+	if s, ok := data["Subject"].(string); ok && s != "" {
+		return s
+	}
+	return e.Subject
+}
+
+// attempt 发送一次并记录结果 敏感消息或尝试次数用完时标记失败 否则按退避等待重试
+func attempt(o *model.NotifyOutbox, content string) error {
+	err := deliver(o, content)
+	now := time.Now()
+	o.Attempts++
+	if err == nil {
+		o.Status, o.LastError, o.SentAt = model.NotifySent, "", &now
+		log.Log.Info("通知[" + o.EventKey + "]渠道[" + o.Channel + "]接收人[" + o.Target + "]状态[已送达]")
+	} else {
+		o.LastError = err.Error()
+		if o.Sensitive || o.Attempts >= model.NotifyCfg.NotifyMaxAttempts() {
+			o.Status = model.NotifyFailed
+		} else {
+			o.NextAt = now.Add(model.NotifyCfg.NotifyBackoff(o.Attempts))
+		}
+		log.Log.Error("通知["+o.EventKey+"]渠道["+o.Channel+"]接收人["+o.Target+"]第"+fmt.Sprint(o.Attempts)+"次发送错误: ", err)
+	}
+	if o.ID != 0 {
+		model.UpdateNotifyOutbox(o)
+	}
+	return err
+}
+
+// deliver 按渠道发送
+func deliver(o *model.NotifyOutbox, content string) error {
+	switch o.Channel {
+	case model.ChannelWework:
+		msg := map[string]interface{}{
+			"touser":   o.Target,
+			"msgtype":  "markdown",
+			"agentid":  model.WeworkUuapCfg.AppId,
+			"markdown": map[string]interface{}{"content": content},
+		}
+		if events[o.EventKey].Safe {
+			msg = map[string]interface{}{
+				"touser":  o.Target,
+				"msgtype": "text",
+				"agentid": model.WeworkUuapCfg.AppId,
+				"text":    map[string]interface{}{"content": content},
+				"safe":    1,
+			}
+		}
+		_, err := model.CorpAPIMsg.MessageSend(msg)
+		return errors.Wrap(err, serializer.ErrSendWeMsg)
+	case model.ChannelEmail:
+		return email.SendMailHtml(strings.Split(o.Target, ","), o.Subject, content)
+	case model.ChannelRobot:
+		for _, m := range util.TruncateMsg(content, "\n") {
+			if err := util.SendRobotMsg(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("未知的通知渠道[" + o.Channel + "]")
+}
+
+// Deliver 重试到期的消息 并清理保留期之前已送达的消息
+func Deliver() {
+	outbox, err := model.FetchDueNotifyOutbox(deliverBatch)
+	if err != nil {
+		log.Log.Error("读取待重试通知错误: ", err)
+		return
+	}
+	for i := range outbox {
+		_ = attempt(&outbox[i], outbox[i].Content)
+	}
+	model.PurgeNotifyOutbox(time.Now().AddDate(0, 0, -model.NotifyCfg.NotifyRetentionDays()))
+}
+
+// union 合并渠道
+func union(a, b []string) []string {
+	res := append([]string{}, a...)
+	for _, c := range b {
+		if !contains(res, c) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// contains 渠道是否在列表中
+func contains(list []string, c string) bool {
+	for _, v := range list {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+)
+
+func TestResolveChannels(t *testing.T) {
+	e := events[EventUuapExpiring]
+	cases := []struct {
+		name  string
+		r     Recipient
+		prefs []model.NotifyPreference
+		want  []string
+	}{
+		{"默认渠道", Recipient{Userid: "u", Emails: []string{"a@b.c"}}, nil, []string{model.ChannelWework, model.ChannelEmail}},
+		{"缺少邮箱", Recipient{Userid: "u"}, nil, []string{model.ChannelWework}},
+		{"指定渠道", Recipient{Userid: "u", Emails: []string{"a@b.c"}, Channels: []string{model.ChannelEmail}}, nil, []string{model.ChannelEmail}},
+		{"全局偏好", Recipient{Userid: "u", Emails: []string{"a@b.c"}},
+			[]model.NotifyPreference{{EventKey: "", Channels: "email"}}, []string{model.ChannelEmail}},
+		{"事件偏好优先", Recipient{Userid: "u", Emails: []string{"a@b.c"}},
+			[]model.NotifyPreference{{EventKey: EventUuapExpiring, Channels: "wework"}, {EventKey: "", Channels: "email"}}, []string{model.ChannelWework}},
+		{"偏好不支持的渠道", Recipient{Userid: "u"},
+			[]model.NotifyPreference{{EventKey: EventUuapExpiring, Channels: "robot, wework"}}, []string{model.ChannelWework}},
+	}
+	for _, c := range cases {
+		if got := resolveChannels(e, c.r, c.prefs); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	e := events[EventUuapRenewal]
+	tpl := "{{.SpName}} {{.DisplayName}} {{.Days}}天"
+	got, err := renderTemplate(tpl, e, Data{"SpName": "工单", "DisplayName": "张三", "Days": "30"})
+	if err != nil || got != "工单 张三 30天" {
+		t.Errorf("got %q %v", got, err)
+	}
+	if _, err = renderTemplate(tpl, e, Data{"SpName": "工单"}); err == nil {
+		t.Error("缺少参数时应报错")
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	cases := []struct {
+		key, tpl string
+		ok       bool
+	}{
+		{"wework_template_uuap_register", "{{.SpName}} 账号{{.Sam}} 密码{{.Pwd}}", true},
+		{"wework_template_uuap_register", "{{if .Sam}}账号{{.Sam}}{{end}}", true},
+		{"email_template_hr_change_report", "{{range $i, $r := .Rows}}{{$.Date}}{{.}}{{end}}", true},
+		{"wework_template_uuap_register", "{{.SpName}} {{.Name}}", false},
+		{"email_template_hr_change_report", "{{with .Rows}}{{$.Eid}}{{end}}", false},
+		{"wework_template_uuap_register", "{{.SpName", false},
+		{"wework_template_uuap_register", "%s %s %s", false},
+		{"wework_template_robot", "{{.Content}}", false},
+		{"email_template_uuap_register", "{{.Sam}}", false},
+	}
+	for _, c := range cases {
+		if err := ValidateTemplate(c.key, c.tpl); (err == nil) != c.ok {
+			t.Errorf("%s %q: got %v", c.key, c.tpl, err)
+		}
+	}
+}
+
+func TestMigrateTemplate(t *testing.T) {
+	e := events[EventWeworkFindUserErr]
+	got, err := migrateTemplate(e, "工单%s: %s(%s %s)未找到 100%%")
+	if err != nil || got != "工单{{.SpName}}: {{.DisplayName}}({{.Name}} {{.Eid}})未找到 100%" {
+		t.Errorf("got %q %v", got, err)
+	}
+	if again, _ := migrateTemplate(e, got); again != got {
+		t.Errorf("已迁移的模板不应变化: %q", again)
+	}
+	if _, err = migrateTemplate(events[EventUuapDisable], "%s %s %s"); err == nil {
+		t.Error("占位符多于参数时应报错")
+	}
+}
+
+func TestNotifyBackoff(t *testing.T) {
+	cfg := model.NotifyConfig{BackoffSeconds: 60}
+	cases := map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 10: time.Hour}
+	for attempts, want := range cases {
+		if got := cfg.NotifyBackoff(attempts); got != want {
+			t.Errorf("attempts %d: got %v want %v", attempts, got, want)
+		}
+	}
+}
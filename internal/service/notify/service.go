@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"strings"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// OutboxService 发件箱 请求参数
+type OutboxService struct {
+	ID       uint   `form:"id" json:"ID"`
+	EventKey string `form:"event_key" json:"event_key"`
+	Status   string `form:"status" json:"status"` // pending sent failed
+}
+
+// PreferenceService 通知偏好 请求参数
+type PreferenceService struct {
+	model.NotifyPreference
+}
+
+// TemplateService 消息模板 请求参数
+type TemplateService struct {
+	Key   string `form:"key" json:"key"` // wework_template_<事件名> 或 email_template_<事件名>
+	Value string `json:"value"`
+}
+
+// templateInfo 消息模板及可用参数
+type templateInfo struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Args  []string `json:"args"`
+}
+
+// FetchEvents 查询全部通知事件及模板参数
+func FetchEvents() serializer.Response {
+	return serializer.Response{Data: Events()}
+}
+
+// Fetch 查询最近的消息 不返回内容
+func (s *OutboxService) Fetch() serializer.Response {
+	outbox, err := model.FetchNotifyOutbox(s.EventKey, s.Status, 100)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: outbox}
+}
+
+// Retry 将失败的消息重新置为待发送 敏感消息未保存内容 不能重试
+func (s *OutboxService) Retry() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少消息id", nil)
+	}
+	n, err := model.RetryNotifyOutbox(s.ID)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	if n == 0 {
+		return serializer.ParamErr("消息不存在、不是失败状态或为敏感消息", nil)
+	}
+	return serializer.Response{Data: s.ID, Msg: "已重新加入发送队列!"}
+}
+
+// Fetch 查询通知偏好 不带userid查询全部
+func (s *PreferenceService) Fetch() serializer.Response {
+	prefs, err := model.FetchNotifyPreferences(s.Userid)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: prefs}
+}
+
+// Save 校验事件和渠道后新增或修改通知偏好
+func (s *PreferenceService) Save() serializer.Response {
+	pref := s.NotifyPreference
+	if pref.Userid == "" {
+		return serializer.ParamErr("缺少企微userid", nil)
+	}
+	if _, ok := events[pref.EventKey]; pref.EventKey != "" && !ok {
+		return serializer.ParamErr("未知的通知事件["+pref.EventKey+"]", nil)
+	}
+	var channels []string
+	for _, c := range strings.Split(pref.Channels, ",") {
+		c = strings.TrimSpace(c)
+		if c != model.ChannelWework && c != model.ChannelEmail {
+			return serializer.ParamErr("未知的通知渠道["+c+"]", nil)
+		}
+		channels = append(channels, c)
+	}
+	pref.Channels = strings.Join(channels, ",")
+	if err := model.SaveNotifyPreference(&pref); err != nil {
+		return serializer.DBErr("保存通知偏好失败", err)
+	}
+	return serializer.Response{Data: pref, Msg: "保存成功!"}
+}
+
+// Delete 删除通知偏好 恢复按事件默认渠道
+func (s *PreferenceService) Delete() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少通知偏好id", nil)
+	}
+	if err := model.DeleteNotifyPreference(s.ID); err != nil {
+		return serializer.DBErr("删除通知偏好失败", err)
+	}
+	return serializer.Response{Data: s.ID, Msg: "删除成功!"}
+}
+
+// Fetch 查询消息模板及可用参数 不带key查询全部
+func (s *TemplateService) Fetch() serializer.Response {
+	var templates []templateInfo
+	add := func(key, value string) {
+		if s.Key != "" && key != s.Key {
+			return
+		}
+		info := templateInfo{Key: key, Value: value}
+		if _, e, ok := templateEvent(key); ok {
+			info.Args = e.Args
+		}
+		templates = append(templates, info)
+	}
+	weworkTemplates, err := model.FetchWeworkMsgTemplates()
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	for _, t := range weworkTemplates {
+		add(t.Key, t.Value)
+	}
+	emailTemplates, err := model.FetchEmailTemplates()
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	for _, t := range emailTemplates {
+		add(t.Key, t.Value)
+	}
+	return serializer.Response{Data: templates}
+}
+
+// Save 按事件参数校验后保存消息模板 并更新缓存
+func (s *TemplateService) Save() serializer.Response {
+	if err := ValidateTemplate(s.Key, s.Value); err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	hash, update := "wework_msg_templates", model.UpdateWeworkMsgTemplate
+	if channel, _, _ := templateEvent(s.Key); channel == model.ChannelEmail {
+		hash, update = "email_templates", model.UpdateEmailTemplate
+	}
+	if err := update(s.Key, s.Value); err != nil {
+		return serializer.DBErr("保存消息模板失败", err)
+	}
+	if _, err := cache.HSet(hash, s.Key, s.Value); err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, "更新消息模板缓存失败", err)
+	}
+	return serializer.Response{Data: s.Key, Msg: "保存成功!"}
+}
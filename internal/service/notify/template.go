@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+)
+
+/*
+* 消息模板 按参数名渲染 如{{.SpName}} 参数名见事件的Args
+* 保存时校验模板只引用事件声明的参数 启动时将旧的%s顺序模板迁移为参数名模板
+*
+ */
+
+// verbRe 旧模板中的占位符
+var verbRe = regexp.MustCompile(`%%|%[sdv]`)
+
+// templateEvent 模板名对应的渠道和事件
+func templateEvent(key string) (channel string, e Event, ok bool) {
+	switch {
+	case strings.HasPrefix(key, "wework_template_"):
+		channel, key = model.ChannelWework, strings.TrimPrefix(key, "wework_template_")
+	case strings.HasPrefix(key, "email_template_"):
+		channel, key = model.ChannelEmail, strings.TrimPrefix(key, "email_template_")
+	default:
+		return
+	}
+	e, ok = events[key]
+	if !ok || e.Raw || !contains(e.Channels, channel) {
+		return "", Event{}, false
+	}
+	return
+}
+
+// parseTemplate 解析模板 引用了事件未声明的参数时报错
+func parseTemplate(e Event, tpl string) (*template.Template, error) {
+	t, err := template.New(e.Key).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "模板语法错误")
+	}
+	var unknown []string
+	for _, tt := range t.Templates() {
+		if tt.Tree == nil {
+			continue
+		}
+		walkFields(tt.Tree.Root, true, func(name string) {
+			if !contains(e.Args, name) && !contains(unknown, name) {
+				unknown = append(unknown, name)
+			}
+		})
+	}
+	if len(unknown) > 0 {
+		return nil, errors.New("模板参数[" + strings.Join(unknown, "、") + "]不是事件[" + e.Key + "]的参数 可用参数: " + strings.Join(e.Args, "、"))
+	}
+	return t, nil
+}
+
+// walkFields 遍历模板中引用的参数名 root为false时.已不是参数(range、with内) 只检查$.参数
+func walkFields(node parse.Node, root bool, fn func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkFields(c, root, fn)
+		}
+	case *parse.ActionNode:
+		walkFields(n.Pipe, root, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			walkFields(c, root, fn)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkFields(a, root, fn)
+		}
+	case *parse.FieldNode:
+		if root {
+			fn(n.Ident[0])
+		}
+	case *parse.ChainNode:
+		walkFields(n.Node, root, fn)
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			fn(n.Ident[1])
+		}
+	case *parse.IfNode:
+		walkFields(n.Pipe, root, fn)
+		walkFields(n.List, root, fn)
+		walkFields(n.ElseList, root, fn)
+	case *parse.RangeNode:
+		walkFields(n.Pipe, root, fn)
+		walkFields(n.List, false, fn)
+		walkFields(n.ElseList, root, fn)
+	case *parse.WithNode:
+		walkFields(n.Pipe, root, fn)
+		walkFields(n.List, false, fn)
+		walkFields(n.ElseList, root, fn)
+	case *parse.TemplateNode:
+		walkFields(n.Pipe, root, fn)
+	}
+}
+
+// renderTemplate 按参数名渲染模板 缺少事件声明的参数时报错
+func renderTemplate(tpl string, e Event, data Data) (string, error) {
+	for _, name := range e.Args {
+		if _, ok := data[name]; !ok {
+			return "", errors.New("通知事件[" + e.Key + "]缺少模板参数[" + name + "]")
+		}
+	}
+	t, err := parseTemplate(e, tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err = t.Execute(&buf, map[string]interface{}(data)); err != nil {
+		return "", errors.Wrap(err, "渲染通知事件["+e.Key+"]模板错误")
+	}
+	return buf.String(), nil
+}
+
+// ValidateTemplate 校验模板名和内容
+func ValidateTemplate(key, tpl string) error {
+	_, e, ok := templateEvent(key)
+	if !ok {
+		return errors.New("未知的消息模板[" + key + "]")
+	}
+	if strings.TrimSpace(tpl) == "" {
+		return errors.New("模板内容为空")
+	}
+	if verbRe.MatchString(tpl) && !strings.Contains(tpl, "{{") {
+		return errors.New("模板应使用参数名如{{." + e.Args[0] + "}} 不再支持%s")
+	}
+	_, err := parseTemplate(e, tpl)
+	return err
+}
+
+// migrateTemplate 将旧模板中的%s按事件参数顺序替换为{{.参数名}} 已迁移的模板原样返回
+func migrateTemplate(e Event, tpl string) (string, error) {
+	if strings.Contains(tpl, "{{") || !verbRe.MatchString(tpl) {
+		return tpl, nil
+	}
+	i := 0
+	res := verbRe.ReplaceAllStringFunc(tpl, func(m string) string {
+		if m == "%%" {
+			return "%"
+		}
+		i++
+		if i > len(e.Args) {
+			return m
+		}
+		return "{{." + e.Args[i-1] + "}}"
+	})
+	if i > len(e.Args) {
+		return "", errors.Errorf("模板有%d个占位符 事件[%s]只有%d个参数", i, e.Key, len(e.Args))
+	}
+	if _, err := parseTemplate(e, res); err != nil {
+		return "", err
+	}
+	return res, nil
+}
+
+// MigrateTemplates 迁移数据库中的旧模板 缓存已存在时同步更新缓存 不存在时由缓存恢复从数据库读取
+func MigrateTemplates() {
+	weworkTemplates, _ := model.FetchWeworkMsgTemplates()
+	for _, t := range weworkTemplates {
+		migrate(t.Key, t.Value, "wework_msg_templates", model.UpdateWeworkMsgTemplate)
+	}
+	emailTemplates, _ := model.FetchEmailTemplates()
+	for _, t := range emailTemplates {
+		migrate(t.Key, t.Value, "email_templates", model.UpdateEmailTemplate)
+	}
+}
+
+// migrate 迁移一个模板
+func migrate(key, value, hash string, update func(key, value string) error) {
+	_, e, ok := templateEvent(key)
+	if !ok {
+		return
+	}
+	res, err := migrateTemplate(e, value)
+	if err != nil {
+		log.Log.Error("迁移消息模板["+key+"]错误: ", err)
+		return
+	}
+	if res == value {
+		return
+	}
+	if err = update(key, res); err != nil {
+		log.Log.Error("保存消息模板["+key+"]错误: ", err)
+		return
+	}
+	if exist, _ := cache.Exists(hash); exist {
+		cache.HSet(hash, key, res)
+	}
+	log.Log.Info("消息模板[" + key + "]已迁移为参数名模板")
+}
@@ -0,0 +1,324 @@
+package offboarding
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/internal/service/wework"
+	"gitee.com/RandolphCYG/akita/pkg/c7n"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+const defaultMaxAttempts = 5
+
+// stepFunc 执行单个步骤 返回结果说明 已无需处理的情况视为成功
+type stepFunc func(task *model.OffboardingTask, step *model.OffboardingStep) (string, error)
+
+var (
+	stepFuncs = map[string]stepFunc{
+		model.StepAdDisable:     adDisable,
+		model.StepAdGroups:      adGroups,
+		model.StepC7nDisable:    c7nDisable,
+		model.StepWeworkDisable: weworkDisable,
+		model.StepWeworkDelete:  weworkDelete,
+		model.StepReport:        report,
+	}
+	stepLabels = map[string]string{
+		model.StepAdDisable:     "禁用AD账号",
+		model.StepAdGroups:      "移出AD组",
+		model.StepC7nDisable:    "禁用C7N用户",
+		model.StepWeworkDisable: "禁用企业微信",
+		model.StepWeworkDelete:  "删除企业微信",
+		model.StepReport:        "离职清单",
+	}
+)
+
+// OffboardingService 离职任务查询与重试 请求参数
+type OffboardingService struct {
+	Id     uint   `form:"id" json:"id"`         // 任务id 查询时指定则返回步骤明细
+	Eid    string `form:"eid" json:"eid"`       // 工号
+	Status string `form:"status" json:"status"` // 状态 running done failed
+}
+
+// Fetch 查询离职任务 带id查询步骤明细
+func (s *OffboardingService) Fetch() serializer.Response {
+	if s.Id != 0 {
+		task, err := model.FetchOffboardingTask(s.Id)
+		if err != nil {
+			return serializer.DBErr("离职任务不存在", err)
+		}
+		return serializer.Response{Data: task}
+	}
+	tasks, err := model.FetchOffboardingTasks(s.Eid, s.Status, 100)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: tasks}
+}
+
+// Retry 重置重试耗尽的步骤并立即执行
+func (s *OffboardingService) Retry() serializer.Response {
+	ok, err := model.RetryOffboardingTask(s.Id)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	if !ok {
+		return serializer.ParamErr("离职任务没有失败的步骤", nil)
+	}
+	go func() {
+		Execute()
+	}()
+	return serializer.Response{Data: s.Id, Msg: "已重置失败步骤并开始执行!"}
+}
+
+// ExecuteManual 手动触发执行离职任务
+func ExecuteManual() serializer.Response {
+	go func() {
+		Execute()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发执行离职任务成功!"}
+}
+
+// Execute 先处理复职 再执行所有处理中的离职任务中已到期的步骤 失败的步骤下次重试 超过最大次数后标记失败
+func Execute() {
+	maxAttempts := model.OffboardingCfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	executeRehires(maxAttempts)
+
+	tasks, err := model.FetchRunningOffboardingTasks()
+	if err != nil {
+		log.Log.Error("读取离职任务错误: ", err)
+		return
+	}
+	for i := range tasks {
+		executeTask(&tasks[i], maxAttempts)
+	}
+	log.Log.Info("执行离职任务完成!")
+}
+
+// executeTask 按顺序执行任务中到期的步骤 并更新任务状态
+func executeTask(task *model.OffboardingTask, maxAttempts int) {
+	now := time.Now()
+	for i := range task.Steps {
+		step := &task.Steps[i]
+		if step.Status != model.StepPending || step.RunAt.After(now) {
+			continue
+		}
+		if step.Name == model.StepReport && !readyToReport(task) {
+			continue
+		}
+		fn, ok := stepFuncs[step.Name]
+		if !ok {
+			continue
+		}
+		step.Attempts++
+		result, err := fn(task, step)
+		if err != nil {
+			log.Log.Error("离职任务["+task.Name+task.Eid+"]步骤["+step.Name+"]第"+strconv.Itoa(step.Attempts)+"次执行错误: ", err)
+			step.Result = err.Error()
+			if step.Attempts >= maxAttempts {
+				step.Status = model.StepFailed
+			}
+		} else {
+			doneAt := time.Now()
+			step.Status = model.StepDone
+			step.Result = result
+			step.DoneAt = &doneAt
+			log.Log.Info("离职任务[", task.Name, task.Eid, "]步骤[", stepLabels[step.Name], "]完成: ", result)
+		}
+		model.UpdateOffboardingStep(step)
+	}
+
+	status := model.OffboardingDone
+	for _, s := range task.Steps {
+		if s.Status == model.StepPending {
+			return
+		}
+		if s.Status == model.StepFailed {
+			status = model.OffboardingFailed
+		}
+	}
+	model.UpdateOffboardingTaskStatus(task.ID, status)
+}
+
+// readyToReport 除保留期后的删除外 其余步骤均已完成或失败时发送清单
+func readyToReport(task *model.OffboardingTask) bool {
+	for _, s := range task.Steps {
+		if s.Name != model.StepReport && s.Name != model.StepWeworkDelete && s.Status == model.StepPending {
+			return false
+		}
+	}
+	return true
+}
+
+// isNotFound 账号不存在
+func isNotFound(err error) bool {
+	return errors.Cause(err).Error() == serializer.ErrLdapUserNotFound
+}
+
+// adDisable 禁用AD账号并移动到禁用OU
+func adDisable(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	dn, err := ldapuser.OffboardUser(task.Eid)
+	if err != nil {
+		if isNotFound(err) {
+			return "AD中没有该账号", nil
+		}
+		return "", err
+	}
+	model.SaveIdentity(task.Eid, map[string]interface{}{"ad_dn": dn, "state": model.IdentityLeft})
+	model.CreateLdapUserDepartRecord(task.Name, task.Eid, task.Department, util.DnToDeparts(model.LdapFields.BaseDnDisabled), "离职禁用")
+	return "已禁用并移动到[" + dn + "]", nil
+}
+
+// adGroups 移出所有AD组 移出的组累计保存在步骤数据中 以便复职时恢复
+func adGroups(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	var saved []string
+	if step.Data != "" {
+		_ = json.Unmarshal([]byte(step.Data), &saved)
+	}
+	groups, err := ldapuser.RemoveGroups(task.Eid)
+	if len(groups) > 0 {
+		b, _ := json.Marshal(append(saved, groups...))
+		step.Data = string(b)
+	}
+	if err != nil {
+		if isNotFound(err) {
+			return "AD中没有该账号", nil
+		}
+		return "", err
+	}
+	return "已移出" + strconv.Itoa(len(saved)+len(groups)) + "个组", nil
+}
+
+// c7nDisable 禁用C7N用户并移除所有项目角色 优先使用身份登记中的C7N用户id
+func c7nDisable(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	identity, _ := model.FetchIdentity(task.Eid)
+	userId := identity.C7nUserId
+	if userId == "" {
+		loginName := identity.AdSam
+		if loginName == "" {
+			loginName = task.Eid
+		}
+		user, err := c7n.FetchUser(task.Name, loginName)
+		if err != nil {
+			return "", err
+		}
+		if user.Id == "" {
+			return "C7N中没有该用户", nil
+		}
+		userId = user.Id
+	}
+	projects, err := c7n.RemoveUserProjectRoles(userId)
+	if err != nil {
+		return "", err
+	}
+	if err = c7n.DisableUser(userId); err != nil {
+		return "", err
+	}
+	if len(projects) == 0 {
+		return "已禁用", nil
+	}
+	return "已禁用 移除项目角色: " + strings.Join(projects, ","), nil
+}
+
+// weworkDisable 禁用企业微信账号
+func weworkDisable(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	user, err := wework.FetchUser(task.Eid)
+	if err != nil || user.Userid == "" {
+		return "企业微信中没有该账号", nil
+	}
+	if err = wework.DisableUser(user); err != nil {
+		return "", err
+	}
+	return "已禁用[" + user.Userid + "]", nil
+}
+
+// weworkDelete 保留期满后删除企业微信账号
+func weworkDelete(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	user, err := wework.FetchUser(task.Eid)
+	if err != nil || user.Userid == "" {
+		return "企业微信中没有该账号", nil
+	}
+	if err = wework.DeleteUser(user); err != nil {
+		return "", err
+	}
+	return "已删除[" + user.Userid + "]", nil
+}
+
+// reportData 离职清单步骤数据 记录机器人消息已发送 邮件失败重试时不重复发送
+type reportData struct {
+	RobotSent bool `json:"robot_sent"`
+}
+
+// report 向IT发送离职清单 机器人消息必发且只发一次 配置了收件人时同时发送邮件
+func report(task *model.OffboardingTask, step *model.OffboardingStep) (string, error) {
+	var data reportData
+	if step.Data != "" {
+		_ = json.Unmarshal([]byte(step.Data), &data)
+	}
+	if !data.RobotSent {
+		sendReportRobot(task)
+		data.RobotSent = true
+		b, _ := json.Marshal(data)
+		step.Data = string(b)
+	}
+
+	receivers, err := cache.HGet("third_party_cfgs", "offboarding_report_receivers")
+	if err != nil || receivers == "" {
+		return "已发送机器人消息", nil
+	}
+	var rows strings.Builder
+	for _, s := range task.Steps {
+		if s.Name == model.StepReport {
+			continue
+		}
+		rows.WriteString("<tr><td>" + stepLabels[s.Name] + "</td><td>" + s.Status + "</td><td>" + html.EscapeString(s.Result) + "</td></tr>")
+	}
+	_, err = notify.Notify(notify.Recipient{Emails: strings.Split(receivers, ",")}, notify.EventOffboardingChecklist,
+		notify.Data{"Subject": task.Name + task.Eid + "离职清单", "Name": task.Name, "Eid": task.Eid, "Department": task.Department, "Rows": rows.String()})
+	if err != nil {
+		return "", err
+	}
+	return "已发送机器人消息和邮件", nil
+}
+
+// sendReportRobot 离职清单机器人消息
+func sendReportRobot(task *model.OffboardingTask) {
+	title := fmt.Sprintf(`<font color="warning"> 离职清单 </font><font color="info"> %s </font>%s %s`, task.Name, task.Eid, task.Department)
+	msg := title
+	for i, s := range task.Steps {
+		if s.Name == model.StepReport {
+			continue
+		}
+		msg += "\n>" + strconv.Itoa(i+1) + ". " + stepLabels[s.Name] + " " + stepState(s)
+	}
+	notify.Robot(msg)
+}
+
+// stepState 步骤状态的机器人消息格式
+func stepState(s model.OffboardingStep) string {
+	switch {
+	case s.Status == model.StepDone:
+		return `<font color="info">完成</font> ` + s.Result
+	case s.Status == model.StepFailed:
+		return `<font color="warning">失败</font> ` + s.Result
+	case s.RunAt.After(time.Now()):
+		return `<font color="comment">` + s.RunAt.Format("2006-01-02") + `执行</font>`
+	default:
+		return `<font color="comment">待执行</font>`
+	}
+}
@@ -0,0 +1,203 @@
+package offboarding
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/wework"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// RehireService 复职记录查询 请求参数
+type RehireService struct {
+	Eid    string `form:"eid" json:"eid"`       // 工号
+	Status string `form:"status" json:"status"` // 状态 pending done failed
+}
+
+// Fetch 查询最近的复职记录
+func (s *RehireService) Fetch() serializer.Response {
+	records, err := model.FetchRehireRecords(s.Eid, s.Status, 100)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: records}
+}
+
+// DetectRehires 身份登记为离职而HR数据恢复在职的员工 创建复职记录 需在以HR数据更新身份登记前调用
+func DetectRehires(users []hr.User) {
+	left, err := model.FetchIdentityEidsByState(model.IdentityLeft)
+	if err != nil {
+		log.Log.Error("读取离职身份错误: ", err)
+		return
+	}
+	for _, u := range users {
+		eid := strings.TrimSpace(u.Eid)
+		if u.Stat == hr.StatLeft || !left[eid] {
+			continue
+		}
+		data, _ := json.Marshal(u)
+		r := &model.RehireRecord{Eid: eid, Name: u.Name, Department: u.Department, Data: string(data)}
+		if last, e := model.FetchLatestOffboardingTask(eid); e == nil {
+			r.OldDepartment = last.Department
+		}
+		if created, e := model.CreateRehireRecord(r); e != nil {
+			log.Log.Error("创建复职记录错误: ", e)
+		} else if created {
+			log.Log.Info(u.Name, eid, " 复职:部门[", u.Department, "]")
+		}
+	}
+}
+
+// executeRehires 处理待处理的复职记录 AD与企业微信分别完成 失败的部分下次重试
+func executeRehires(maxAttempts int) {
+	records, err := model.FetchPendingRehireRecords()
+	if err != nil {
+		log.Log.Error("读取复职记录错误: ", err)
+		return
+	}
+	for i := range records {
+		executeRehire(&records[i], maxAttempts)
+	}
+}
+
+// executeRehire 取消处理中的离职任务 恢复AD与企业微信账号 并重新发送初始密码
+func executeRehire(r *model.RehireRecord, maxAttempts int) {
+	var hrUser hr.User
+	if err := json.Unmarshal([]byte(r.Data), &hrUser); err != nil {
+		r.Status = model.RehireFailed
+		r.Result = err.Error()
+		model.UpdateRehireRecord(r)
+		return
+	}
+	model.CancelOffboardingTasks(r.Eid) // 避免保留期后删除企业微信账号
+
+	r.Attempts++
+	var errs []string
+	if r.AdResult == "" {
+		if result, err := rehireAd(r, hrUser); err != nil {
+			errs = append(errs, "AD: "+err.Error())
+		} else {
+			r.AdResult = result
+		}
+	}
+	if r.WeworkResult == "" {
+		if result, err := rehireWework(r, hrUser); err != nil {
+			errs = append(errs, "企业微信: "+err.Error())
+		} else {
+			r.WeworkResult = result
+		}
+	}
+
+	if len(errs) == 0 {
+		now := time.Now()
+		r.Status = model.RehireDone
+		r.Result = ""
+		r.DoneAt = &now
+		log.Log.Info(r.Name, r.Eid, " 复职处理完成: ", r.AdResult, " ", r.WeworkResult)
+	} else {
+		r.Result = strings.Join(errs, "; ")
+		log.Log.Error("复职["+r.Name+r.Eid+"]第", r.Attempts, "次处理错误: ", r.Result)
+		if r.Attempts >= maxAttempts {
+			r.Status = model.RehireFailed
+		}
+	}
+	model.UpdateRehireRecord(r)
+}
+
+// rehireAd 启用AD账号并移动到新部门 部门未变时恢复离职时移出的组 然后重置密码并保密发送
+func rehireAd(r *model.RehireRecord, hrUser hr.User) (string, error) {
+	user := ldapuser.HrToLdapUser(hrUser)
+	var groups []string
+	if r.OldDepartment != "" && r.OldDepartment == hrUser.Department {
+		groups = savedGroups(r.Eid)
+	}
+	dn, err := ldapuser.RehireUser(user, groups)
+	if err != nil {
+		if isNotFound(err) {
+			return "AD中没有该账号 由LDAP同步计划新建", nil
+		}
+		return "", err
+	}
+
+	entry, err := ldapuser.FetchUserByNum(r.Eid)
+	if err != nil {
+		return "", err
+	}
+	sam := entry.GetAttributeValue("sAMAccountName")
+	model.SaveIdentity(r.Eid, map[string]interface{}{"ad_dn": dn, "ad_sam": sam, "state": model.IdentityActive})
+	model.CreateLdapUserDepartRecord(r.Name, r.Eid, r.OldDepartment, hrUser.Department, "复职")
+	model.CreateLdapCredentialDelivery(model.LdapCredentialDelivery{
+		Sam:     sam,
+		Name:    r.Name,
+		Eid:     r.Eid,
+		Dn:      dn,
+		Company: hrUser.CompanyName,
+	})
+	result := "已启用并移动到[" + dn + "]"
+	if groups != nil {
+		result += " 恢复" + strconv.Itoa(len(groups)) + "个组"
+	}
+	return result, nil
+}
+
+// savedGroups 最近一次离职任务中移出的AD组
+func savedGroups(eid string) (groups []string) {
+	task, err := model.FetchLatestOffboardingTask(eid)
+	if err != nil {
+		return
+	}
+	for _, s := range task.Steps {
+		if s.Name == model.StepAdGroups && s.Data != "" {
+			_ = json.Unmarshal([]byte(s.Data), &groups)
+		}
+	}
+	return
+}
+
+// rehireWework 企业微信账号仍在保留期内则启用 已删除则以原userid重新创建
+func rehireWework(r *model.RehireRecord, hrUser hr.User) (string, error) {
+	if u, err := wework.FetchUser(r.Eid); err == nil && u.Userid != "" {
+		if err = wework.EnableUser(u); err != nil {
+			return "", err
+		}
+		model.SaveIdentity(r.Eid, map[string]interface{}{"wework_userid": u.Userid})
+		return "已启用[" + u.Userid + "]", nil
+	}
+
+	userid := model.FetchLastWeworkUserid(r.Eid)
+	if userid == "" {
+		userid = r.Eid
+	}
+	setting, ok := model.FetchCompanySettingByHrCode(hrUser.CompanyCode)
+	if !ok {
+		setting, _ = model.FetchCompanySetting(hrUser.CompanyName, false)
+	}
+	departId := setting.WeworkDepartId // 找不到对应部门时放入公司配置的默认部门
+	if dp, _ := wework.FetchDepart(hrUser.Department); dp.Name != "" {
+		departId = dp.Id
+	}
+	if departId == 0 {
+		return "", errors.New(serializer.ErrCompanySettingNotExists + hrUser.CompanyName)
+	}
+	user := &ldapuser.LdapAttributes{
+		Sam:            userid,
+		Num:            r.Eid,
+		DisplayName:    hrUser.Name,
+		Email:          strings.ToLower(hrUser.Mail),
+		Phone:          hrUser.Mobile,
+		WeworkDepartId: departId,
+	}
+	if err := wework.CreateUser(user); err != nil {
+		return "", err
+	}
+	model.CreateWeworkUserSyncRecord(userid, hrUser.Name, r.Eid, "复职重建")
+	return "已重建[" + userid + "]", nil
+}
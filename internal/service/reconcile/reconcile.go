@@ -0,0 +1,358 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xuri/excelize/v2"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/c7n"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+)
+
+/*
+* HR、AD、企业微信、C7N 身份核对
+ */
+
+const (
+	reportKey = "reconcile_report" // 最近一次核对报告 缓存键
+
+	// 不一致类别
+	KindLeftAdEnabled       = "HR离职但AD未禁用"
+	KindLeftWework          = "HR离职但企业微信未删除"
+	KindLeftC7n             = "HR离职但C7N未禁用"
+	KindMissingAd           = "HR在职但没有AD账号"
+	KindMissingWework       = "HR在职但没有企业微信账号"
+	KindWeworkWithoutEid    = "企业微信账号没有工号"
+	KindWeworkWithoutPerson = "企业微信工号在HR和AD中都不存在"
+	KindC7nWithoutAd        = "C7N用户没有AD账号"
+)
+
+// suggestions 各类别的建议处理方式
+var suggestions = map[string]string{
+	KindLeftAdEnabled:       "执行LDAP同步或离职流程 禁用AD账号并移到禁用OU",
+	KindLeftWework:          "执行企业微信过期扫描或离职流程 删除企业微信账号",
+	KindLeftC7n:             "禁用C7N用户并移除项目角色",
+	KindMissingAd:           "执行LDAP同步创建账号 或提交账号注册工单",
+	KindMissingWework:       "执行WeworkScanNewHrUsers创建企业微信账号",
+	KindWeworkWithoutEid:    "在企业微信通讯录中补充工号扩展属性",
+	KindWeworkWithoutPerson: "核实人员后修正工号或删除企业微信账号",
+	KindC7nWithoutAd:        "核实人员后禁用C7N用户",
+}
+
+// Mismatch 一条不一致记录
+type Mismatch struct {
+	Kind       string `json:"kind"`
+	Eid        string `json:"eid"`
+	Name       string `json:"name"`
+	Hr         string `json:"hr"`     // HR状态
+	Ad         string `json:"ad"`     // AD账号及状态
+	Wework     string `json:"wework"` // 企业微信userid及状态
+	C7n        string `json:"c7n"`    // C7N登录名及状态
+	Suggestion string `json:"suggestion"`
+}
+
+// Report 核对报告
+type Report struct {
+	CreatedAt  time.Time      `json:"created_at"`
+	Counts     map[string]int `json:"counts"`
+	Mismatches []Mismatch     `json:"mismatches"`
+}
+
+// adAccount AD账号
+type adAccount struct {
+	Sam     string
+	Dn      string
+	Enabled bool
+}
+
+// weworkAccount 企业微信账号
+type weworkAccount struct {
+	Userid string `json:"userid"`
+	Name   string `json:"name"`
+	Status int    `json:"status"` // 1 已激活 2 已禁用 4 未激活 5 退出企业
+}
+
+// ReportService 核对报告查询与下载 请求参数
+type ReportService struct {
+	Format string `form:"format" json:"format"` // 下载格式 csv xlsx
+}
+
+// Fetch 查询最近一次核对报告
+func (s *ReportService) Fetch() serializer.Response {
+	report, err := fetchReport()
+	if err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, "核对报告不存在，请先手动触发核对", err)
+	}
+	return serializer.Response{Data: report}
+}
+
+// Download 以csv或xlsx导出最近一次核对报告
+func (s *ReportService) Download() (filename string, data []byte, err error) {
+	report, err := fetchReport()
+	if err != nil {
+		return
+	}
+	rows := [][]string{{"类别", "工号", "姓名", "HR", "AD", "企业微信", "C7N", "建议"}}
+	for _, m := range report.Mismatches {
+		rows = append(rows, []string{m.Kind, m.Eid, m.Name, m.Hr, m.Ad, m.Wework, m.C7n, m.Suggestion})
+	}
+
+	filename = "reconcile_" + report.CreatedAt.Format("20060102150405")
+	switch s.Format {
+	case "", "csv":
+		var buf bytes.Buffer
+		buf.WriteString("\ufeff") // 带BOM 方便excel打开
+		w := csv.NewWriter(&buf)
+		if err = w.WriteAll(rows); err != nil {
+			return
+		}
+		return filename + ".csv", buf.Bytes(), nil
+	case "xlsx":
+		f := excelize.NewFile()
+		sheet := f.GetSheetName(0)
+		for i, row := range rows {
+			for j, col := range row {
+				cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+				f.SetCellValue(sheet, cell, col)
+			}
+		}
+		var buf *bytes.Buffer
+		if buf, err = f.WriteToBuffer(); err != nil {
+			return
+		}
+		return filename + ".xlsx", buf.Bytes(), nil
+	default:
+		err = errors.New("不支持的导出格式: " + s.Format)
+		return
+	}
+}
+
+// ReconcileManual 手动触发身份核对
+func ReconcileManual() serializer.Response {
+	go func() {
+		Reconcile()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发身份核对成功!"}
+}
+
+// Reconcile 以工号关联HR缓存、AD全量、企业微信缓存与C7N用户 生成分类的不一致报告并汇总通知
+func Reconcile() {
+	log.Log.Info("开始身份核对...")
+	report, err := BuildReport()
+	if err != nil {
+		log.Log.Error("身份核对错误: ", err)
+		return
+	}
+	raw, _ := json.Marshal(report)
+	if err = cache.Set(reportKey, raw); err != nil {
+		log.Log.Error("保存核对报告错误: ", err)
+		return
+	}
+	log.Log.Info("身份核对完成! 不一致", len(report.Mismatches), "项")
+
+	// 根据是否为节假日决定是否发消息
+	now := time.Now()
+	if isSilent, _ := util.IsHolidaySilentMode(now); isSilent || len(report.Mismatches) == 0 {
+		return
+	}
+	msg := `<font color="warning"> ` + now.Format("2006年01月02日") + ` </font>身份核对不一致` +
+		`<font color="warning"> ` + strconv.Itoa(len(report.Mismatches)) + ` </font>项：`
+	for _, kind := range kinds(report) {
+		msg += "\n>" + kind + `<font color="comment"> ` + strconv.Itoa(report.Counts[kind]) + ` </font>`
+	}
+	notify.Robot(msg + "\n>明细通过接口`/api/v1/reconcile/report/download`下载")
+}
+
+// BuildReport 生成核对报告
+func BuildReport() (report *Report, err error) {
+	hrUsers := make(map[string]hr.User)
+	rawHrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		return nil, errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
+	}
+	for _, v := range rawHrUsers {
+		var u hr.User
+		if json.Unmarshal([]byte(v), &u) == nil && u.Eid != "" {
+			hrUsers[strings.TrimSpace(u.Eid)] = u
+		}
+	}
+
+	adUsers := make(map[string]adAccount) // 工号->AD账号
+	adSams := make(map[string]string)     // SAM账号->工号
+	for _, e := range ldapuser.FetchLdapUsers(&ldapuser.LdapAttributes{}) {
+		num := e.GetAttributeValue("employeeNumber")
+		uac, _ := strconv.Atoi(e.GetEqualFoldAttributeValue("userAccountControl"))
+		a := adAccount{Sam: e.GetAttributeValue("sAMAccountName"), Dn: e.DN, Enabled: uac&0x2 == 0} // 0x2 账号已禁用
+		if num != "" {
+			adUsers[num] = a
+		}
+		adSams[strings.ToLower(a.Sam)] = num
+	}
+
+	weworkUsers := make(map[string]weworkAccount) // 工号->企业微信账号
+	rawWeworkUsers, _ := cache.HGetAll("wework_users")
+	for eid, v := range rawWeworkUsers {
+		var u weworkAccount
+		if json.Unmarshal([]byte(v), &u) == nil {
+			weworkUsers[eid] = u
+		}
+	}
+	invalidWeworkUsers, _ := cache.HGetAll("wework_users_invalid")
+
+	c7nUsers, c7nErr := c7n.FetchUsers()
+	if c7nErr != nil {
+		log.Log.Error("查询C7N用户错误 本次不核对C7N: ", c7nErr)
+	}
+	c7nByEid := make(map[string]c7n.UserFields) // 通过AD账号关联的工号->C7N用户
+	for _, u := range c7nUsers {
+		if num, ok := adSams[strings.ToLower(u.LoginName)]; ok && num != "" {
+			c7nByEid[num] = u
+		}
+	}
+	saveIdentities(adUsers, c7nByEid, c7nErr == nil)
+
+	report = &Report{CreatedAt: time.Now(), Counts: make(map[string]int)}
+	add := func(kind, eid, name string) {
+		m := Mismatch{Kind: kind, Eid: eid, Name: name, Suggestion: suggestions[kind]}
+		if u, ok := hrUsers[eid]; ok {
+			m.Hr = u.Stat
+		}
+		if a, ok := adUsers[eid]; ok {
+			m.Ad = a.Sam + accountState(a.Enabled)
+		}
+		if w, ok := weworkUsers[eid]; ok {
+			m.Wework = w.Userid + weworkState(w.Status)
+		}
+		if c, ok := c7nByEid[eid]; ok {
+			m.C7n = c.LoginName + accountState(c.Enabled)
+		}
+		report.Mismatches = append(report.Mismatches, m)
+		report.Counts[kind]++
+	}
+
+	for eid, u := range hrUsers {
+		a, inAd := adUsers[eid]
+		_, inWework := weworkUsers[eid]
+		c, inC7n := c7nByEid[eid]
+		if u.Stat == hr.StatLeft {
+			if inAd && a.Enabled {
+				add(KindLeftAdEnabled, eid, u.Name)
+			}
+			if inWework {
+				add(KindLeftWework, eid, u.Name)
+			}
+			if inC7n && c.Enabled {
+				add(KindLeftC7n, eid, u.Name)
+			}
+			continue
+		}
+		if !inAd {
+			add(KindMissingAd, eid, u.Name)
+		}
+		if _, ok := model.FetchCompanySettingByHrCode(u.CompanyCode); !inWework && ok { // 只为配置了HR公司代码的公司员工自动创建企业微信账号
+			add(KindMissingWework, eid, u.Name)
+		}
+	}
+	for eid, w := range weworkUsers {
+		_, inHr := hrUsers[eid]
+		_, inAd := adUsers[eid]
+		if !inHr && !inAd {
+			add(KindWeworkWithoutPerson, eid, w.Name)
+		}
+	}
+	for userid, v := range invalidWeworkUsers {
+		var w weworkAccount
+		_ = json.Unmarshal([]byte(v), &w)
+		report.Mismatches = append(report.Mismatches, Mismatch{Kind: KindWeworkWithoutEid, Name: w.Name,
+			Wework: userid + weworkState(w.Status), Suggestion: suggestions[KindWeworkWithoutEid]})
+		report.Counts[KindWeworkWithoutEid]++
+	}
+	for _, u := range c7nUsers {
+		if _, ok := adSams[strings.ToLower(u.LoginName)]; !ok && u.Ldap && u.Enabled {
+			report.Mismatches = append(report.Mismatches, Mismatch{Kind: KindC7nWithoutAd, Name: u.RealName,
+				C7n: u.LoginName + accountState(u.Enabled), Suggestion: suggestions[KindC7nWithoutAd]})
+			report.Counts[KindC7nWithoutAd]++
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		if report.Mismatches[i].Kind != report.Mismatches[j].Kind {
+			return report.Mismatches[i].Kind < report.Mismatches[j].Kind
+		}
+		return report.Mismatches[i].Eid < report.Mismatches[j].Eid
+	})
+	return
+}
+
+// fetchReport 读取最近一次核对报告
+func fetchReport() (report Report, err error) {
+	raw, err := cache.GetString(reportKey)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &report)
+	return
+}
+
+// kinds 报告中出现的类别 按名称排序
+func kinds(report *Report) (res []string) {
+	for k := range report.Counts {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return
+}
+
+// accountState 账号状态描述
+func accountState(enabled bool) string {
+	if enabled {
+		return "(启用)"
+	}
+	return "(禁用)"
+}
+
+// weworkState 企业微信账号状态描述
+func weworkState(status int) string {
+	switch status {
+	case 1:
+		return "(已激活)"
+	case 2:
+		return "(已禁用)"
+	case 4:
+		return "(未激活)"
+	case 5:
+		return "(退出企业)"
+	default:
+		return fmt.Sprintf("(%d)", status)
+	}
+}
+
+// saveIdentities 以核对时读取的账号刷新身份登记 C7N查询失败时不更新C7N用户id
+func saveIdentities(adUsers map[string]adAccount, c7nByEid map[string]c7n.UserFields, withC7n bool) {
+	rows := make([]model.Identity, 0, len(adUsers))
+	for eid, a := range adUsers {
+		rows = append(rows, model.Identity{Eid: eid, AdDn: a.Dn, AdSam: a.Sam, C7nUserId: c7nByEid[eid].Id})
+	}
+	columns := []string{"ad_dn", "ad_sam"}
+	if withC7n {
+		columns = append(columns, "c7n_user_id")
+	}
+	if err := model.SaveIdentities(rows, columns...); err != nil {
+		log.Log.Error("登记AD身份错误: ", err)
+	}
+}
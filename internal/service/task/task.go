@@ -8,20 +8,33 @@ import (
 	"gitee.com/RandolphCYG/akita/internal/model"
 	"gitee.com/RandolphCYG/akita/internal/service/hruser"
 	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/internal/service/offboarding"
+	"gitee.com/RandolphCYG/akita/internal/service/reconcile"
 	"gitee.com/RandolphCYG/akita/internal/service/wework"
 	"gitee.com/RandolphCYG/akita/pkg/c7n"
 	"gitee.com/RandolphCYG/akita/pkg/serializer"
 )
 
 var (
-	HrCacheUsers           = hruser.CacheUsers
-	WeworkCacheUsers       = wework.CacheUsers
-	LdapSyncUsers          = ldapuser.SyncUsers
-	LdapScanExpiredUsers   = ldapuser.ScanExpiredUsers
-	WeworkScanExpiredUsers = wework.ScanExpiredUsers
-	WeworkScanNewHrUsers   = wework.ScanNewHrUsers
-	C7nCacheProjects       = c7n.CacheProjects
-	C7nUpdateUsers         = c7n.SyncUsers
+	HrCacheUsers             = hruser.CacheUsers
+	HrSendChangeReport       = hruser.SendChangeReport
+	WeworkCacheUsers         = wework.CacheUsersScheduled
+	LdapSyncUsers            = ldapuser.SyncUsers
+	LdapScanExpiredUsers     = ldapuser.ScanExpiredUsers
+	LdapScanPwdExpiringUsers = ldapuser.ScanPwdExpiringUsers
+	LdapDeliverCredentials   = ldapuser.DeliverCredentials
+	WeworkScanExpiredUsers   = wework.ScanExpiredUsers
+	WeworkScanNewHrUsers     = wework.ScanNewHrUsers
+	C7nCacheProjects         = c7n.CacheProjects
+	C7nUpdateUsers           = c7n.SyncUsers
+	Reconcile                = reconcile.Reconcile
+	OffboardingExecute       = offboarding.Execute
+	WeworkSyncDeparts        = wework.SyncDeparts
+	WeworkSyncUsers          = wework.SyncUsers
+	WeworkScanProbation      = wework.ScanProbation
+	WeworkApplyTagRules      = wework.ApplyTagRules
+	NotifyDeliver            = notify.Deliver
 )
 
 // crontab表达式检查 https://crontab.guru/
@@ -43,7 +56,12 @@ func init() {
 		Cron: "20 2,8,14,20 * * *",
 		Func: HrCacheUsers,
 	}
-	// 更新企业微信用户缓存【频繁】
+	// 对比HR快照发送人员变化报告【每天一次】 依赖HR缓存
+	model.AllTasks["HrSendChangeReport"] = model.JobWrapper{
+		Cron: "30 9 * * *",
+		Func: HrSendChangeReport,
+	}
+	// 更新企业微信用户缓存【频繁】 配置通讯录回调后每天只全量刷新一次
 	model.AllTasks["WeworkCacheUsers"] = model.JobWrapper{
 		Cron: "10 7-22 * * *",
 		Func: WeworkCacheUsers,
@@ -53,22 +71,67 @@ func init() {
 		Cron: "30 * * * *",
 		Func: C7nCacheProjects,
 	}
+	// 同步HR部门结构到企业微信【每天一次】 依赖HR缓存和企业微信缓存 需早于为新员工创建企业微信账号
+	model.AllTasks["WeworkSyncDeparts"] = model.JobWrapper{
+		Cron: "15 9 * * *",
+		Func: WeworkSyncDeparts,
+	}
+	// 以HR数据同步企业微信用户的部门、职务、邮箱、手机和负责人标识【每天一次】 依赖部门同步
+	model.AllTasks["WeworkSyncUsers"] = model.JobWrapper{
+		Cron: "20 9 * * *",
+		Func: WeworkSyncUsers,
+	}
+	// 试用期届满的员工移除试用期标签并发送祝贺消息【每天一次】 依赖HR缓存和企业微信缓存
+	model.AllTasks["WeworkScanProbation"] = model.JobWrapper{
+		Cron: "45 9 * * *",
+		Func: WeworkScanProbation,
+	}
+	// 按标签规则更新企业微信标签成员【每天一次】 依赖HR缓存和企业微信缓存
+	model.AllTasks["WeworkApplyTagRules"] = model.JobWrapper{
+		Cron: "50 9 * * *",
+		Func: WeworkApplyTagRules,
+	}
+	// 重试发送失败的通知【频繁】
+	model.AllTasks["NotifyDeliver"] = model.JobWrapper{
+		Cron: "* * * * *",
+		Func: NotifyDeliver,
+	}
 	// 全量为内部新用户创建企业微信账号【每天 工作时间】 依赖HR缓存和企业微信缓存
 	model.AllTasks["WeworkScanNewHrUsers"] = model.JobWrapper{
 		Cron: "25 9-17 * * *",
 		Func: WeworkScanNewHrUsers,
 	}
-	// 扫描过期ldap用户并发通知【每天一次】
+	// 为已有企业微信账号的新员工发送UUAP初始密码【每天 工作时间】 依赖企业微信缓存
+	model.AllTasks["LdapDeliverCredentials"] = model.JobWrapper{
+		Cron: "35 9-17 * * *",
+		Func: LdapDeliverCredentials,
+	}
+	// 扫描密码即将过期的ldap用户并发通知【每天一次】 需早于扫描过期ldap用户 以便汇总通知
+	model.AllTasks["LdapScanPwdExpiringUsers"] = model.JobWrapper{
+		Cron: "00 9 * * *",
+		Func: LdapScanPwdExpiringUsers,
+	}
+	// 扫描过期ldap用户 通知或禁用后发汇总通知【每天一次】
 	model.AllTasks["LdapScanExpiredUsers"] = model.JobWrapper{
 		Cron: "10 9 * * *",
 		Func: LdapScanExpiredUsers,
 	}
-	// 扫描过期企业微信用户并发汇总通知【每天一次】
+	// 扫描过期企业微信用户【每天一次】 人员变化见HR人员变化报告
 	model.AllTasks["WeworkScanExpiredUsers"] = model.JobWrapper{
 		Cron: "00 17 * * *",
 		Func: WeworkScanExpiredUsers,
 	}
-	// 全量更新ldap用户信息并发汇总通知【慢 每天一次】
+	// HR、AD、企业微信、C7N身份核对【每天一次】 依赖HR缓存和企业微信缓存
+	model.AllTasks["Reconcile"] = model.JobWrapper{
+		Cron: "40 9 * * 1-5",
+		Func: Reconcile,
+	}
+	// 执行离职任务中到期的步骤 失败的步骤下次重试【频繁】
+	model.AllTasks["OffboardingExecute"] = model.JobWrapper{
+		Cron: "*/10 * * * *",
+		Func: OffboardingExecute,
+	}
+	// 全量更新ldap用户信息并通知变更计划执行结果【慢 每天一次】
 	model.AllTasks["LdapSyncUsers"] = model.JobWrapper{
 		Cron: "5 17 * * *",
 		Func: LdapSyncUsers,
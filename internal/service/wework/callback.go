@@ -0,0 +1,190 @@
+package wework
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/wework/callback"
+)
+
+// CallbackService 企业微信回调 请求参数
+type CallbackService struct {
+	MsgSignature string `form:"msg_signature"`
+	Timestamp    string `form:"timestamp"`
+	Nonce        string `form:"nonce"`
+	Echostr      string `form:"echostr"`
+}
+
+// newCrypt 以应用的回调配置创建加解密
+func newCrypt(cfg model.WeworkCfg) (*callback.Crypt, error) {
+	if cfg.CallbackToken == "" || cfg.CallbackAesKey == "" {
+		return nil, errors.New("未配置应用[" + cfg.AppName + "]的回调Token和EncodingAESKey")
+	}
+	return callback.NewCrypt(cfg.CallbackToken, cfg.CallbackAesKey, cfg.CorpId)
+}
+
+// verify 校验回调地址 返回解密后的echostr
+func (s *CallbackService) verify(cfg model.WeworkCfg) (string, error) {
+	c, err := newCrypt(cfg)
+	if err != nil {
+		return "", err
+	}
+	echo, err := c.VerifyURL(s.MsgSignature, s.Timestamp, s.Nonce, s.Echostr)
+	return string(echo), err
+}
+
+// decrypt 校验签名并解密消息
+func (s *CallbackService) decrypt(cfg model.WeworkCfg, body []byte) ([]byte, error) {
+	c, err := newCrypt(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.DecryptMsg(s.MsgSignature, s.Timestamp, s.Nonce, body)
+}
+
+// VerifyContact 校验通讯录管理应用的回调地址
+func (s *CallbackService) VerifyContact() (string, error) {
+	return s.verify(model.WeworkUserManageCfg)
+}
+
+// HandleContact 解密通讯录变更事件后异步处理 企业微信要求5秒内应答
+func (s *CallbackService) HandleContact(body []byte) error {
+	plain, err := s.decrypt(model.WeworkUserManageCfg, body)
+	if err != nil {
+		return err
+	}
+	event, err := callback.ParseContactEvent(plain)
+	if err != nil {
+		return err
+	}
+	if event.Event != "change_contact" {
+		return nil
+	}
+	go handleContactEvent(event)
+	return nil
+}
+
+// VerifyApp 校验UUAP公告应用的回调地址
+func (s *CallbackService) VerifyApp() (string, error) {
+	return s.verify(model.WeworkUuapCfg)
+}
+
+// HandleApp 解密UUAP公告应用的事件后异步处理 目前只处理模板卡片点击
+func (s *CallbackService) HandleApp(body []byte) error {
+	plain, err := s.decrypt(model.WeworkUuapCfg, body)
+	if err != nil {
+		return err
+	}
+	event, err := callback.ParseTemplateCardEvent(plain)
+	if err != nil {
+		return err
+	}
+	if event.Event != "template_card_event" {
+		return nil
+	}
+	go handleTemplateCardEvent(event)
+	return nil
+}
+
+// handleContactEvent 更新成员缓存与身份登记 成员或部门被手动修改且与HR不一致时提示
+func handleContactEvent(e callback.ContactEvent) {
+	log.Log.Info("企业微信通讯录变更: ", e.ChangeType, " ", e.UserID, e.NewUserID, " ", e.Id)
+	switch e.ChangeType {
+	case "create_user", "update_user":
+		userid := e.UserID
+		if e.NewUserID != "" && e.NewUserID != e.UserID { // 修改了userid
+			RemoveCachedUser(e.UserID)
+			userid = e.NewUserID
+		}
+		if err := RefreshUser(userid); err != nil {
+			log.Log.Error("更新企业微信成员["+userid+"]缓存错误: ", err)
+			return
+		}
+		if e.ChangeType == "update_user" {
+			flagUserConflicts(userid)
+		}
+	case "delete_user":
+		if eid := RemoveCachedUser(e.UserID); eid != "" {
+			model.SaveIdentity(eid, map[string]interface{}{"wework_userid": ""})
+		}
+	case "delete_party":
+		if err := model.DeleteWeworkDepartMappingsByDepartId(e.Id); err != nil {
+			log.Log.Error("删除企业微信部门对应关系错误: ", err)
+		}
+	case "update_party":
+		mappings, _ := model.FetchWeworkDepartMappingsByDepartId(e.Id)
+		for _, m := range mappings {
+			sendConflictMsg("部门[" + m.Path + "]在企业微信中被手动修改 下次部门同步将按HR部门结构恢复")
+		}
+	}
+}
+
+// flagUserConflicts 成员被手动修改后与HR数据不一致时记录并提示 下次属性同步将按HR覆盖
+func flagUserConflicts(userid string) {
+	u, eid, ok := fetchCachedUser(userid)
+	if !ok {
+		return
+	}
+	h, ok := fetchHrUser(eid)
+	if !ok || h.Stat == hr.StatLeft || !hasHrCompanySetting(h.CompanyCode) {
+		return
+	}
+	var departId int
+	if m, err := model.FetchWeworkDepartMapping(strings.TrimSpace(h.Department)); err == nil {
+		departId = m.DepartId
+	}
+	_, changes := diffUser(u, h, departId, nil)
+	if len(changes) == 0 {
+		return
+	}
+	var diffs []string
+	for _, c := range changes {
+		diffs = append(diffs, c.Kind+" 企业微信["+c.Old+"] HR["+c.New+"]")
+	}
+	model.CreateWeworkUserSyncRecord(userid, u.Name, eid, "手动修改与HR不一致 "+strings.Join(diffs, "; "))
+	sendConflictMsg(u.Name + eid + " 在企业微信中被手动修改 与HR不一致 下次属性同步将按HR覆盖\n>" + strings.Join(diffs, "\n>"))
+}
+
+// fetchCachedUser 按userid在缓存中查找成员及工号
+func fetchCachedUser(userid string) (u UserDetails, eid string, ok bool) {
+	users, _ := cache.HGetAll("wework_users")
+	for k, v := range users {
+		if json.Unmarshal([]byte(v), &u) == nil && u.Userid == userid {
+			return u, k, true
+		}
+	}
+	return UserDetails{}, "", false
+}
+
+// fetchHrUser 按工号在HR缓存中查找员工
+func fetchHrUser(eid string) (h hr.User, ok bool) {
+	users, _ := cache.HGetAll("hr_users")
+	for _, v := range users {
+		if json.Unmarshal([]byte(v), &h) == nil && strings.TrimSpace(h.Eid) == eid {
+			return h, true
+		}
+	}
+	return hr.User{}, false
+}
+
+// sendConflictMsg 发送手动修改提示
+func sendConflictMsg(msg string) {
+	notify.Robot(`<font color="warning"> 企业微信手动修改 </font>` + msg)
+}
+
+// CacheUsersScheduled 定时刷新企业微信成员缓存 配置了通讯录回调后缓存由回调实时更新 每天只在7点全量刷新一次
+func CacheUsersScheduled() {
+	if model.WeworkUserManageCfg.CallbackToken != "" && time.Now().Hour() != 7 {
+		log.Log.Info("已配置通讯录回调 跳过企微用户缓存刷新")
+		return
+	}
+	CacheUsers()
+}
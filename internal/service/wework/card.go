@@ -0,0 +1,211 @@
+package wework
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/util"
+	"gitee.com/RandolphCYG/akita/pkg/wework/callback"
+	"gitee.com/RandolphCYG/akita/pkg/wework/card"
+)
+
+const weworkUserDisabled = 2 // 企业微信成员状态 已禁用
+
+// renewalResult 单个账号的续期结果
+type renewalResult struct {
+	User      model.RenewalApplyUser
+	Msg       string
+	Renewed   bool
+	NeedApply bool // 不满足一键续期策略 需提交账号续期审批
+}
+
+// handleTemplateCardEvent 处理模板卡片点击 同一张卡片只处理一次
+func handleTemplateCardEvent(e callback.TemplateCardEvent) {
+	task, err := model.FetchCardTask(e.TaskId)
+	if err != nil {
+		log.Log.Warning("未找到模板卡片任务[" + e.TaskId + "]")
+		return
+	}
+	if task.Userid != e.FromUserName {
+		log.Log.Warning("模板卡片任务[" + e.TaskId + "]接收人[" + task.Userid + "]与点击人[" + e.FromUserName + "]不一致")
+		return
+	}
+	if e.EventKey != ldapuser.CardButtonRenew || !model.ClaimCardTask(&task) {
+		return
+	}
+
+	var users []model.RenewalApplyUser
+	if err = json.Unmarshal([]byte(task.Payload), &users); err != nil {
+		finishCardTask(&task, err.Error())
+		return
+	}
+	self := task.Kind == model.CardKindRenewal
+	if !self { // 只续期勾选的账号
+		var selected []model.RenewalApplyUser
+		for _, id := range e.Options(ldapuser.CardQuestionRenew) {
+			if i, err := strconv.Atoi(id); err == nil && i >= 0 && i < len(users) {
+				selected = append(selected, users[i])
+			}
+		}
+		users = selected
+	}
+
+	var results []renewalResult
+	var needApply []model.RenewalApplyUser
+	renewed := 0
+	for _, u := range users {
+		r := renewAccount(u, self)
+		results = append(results, r)
+		if r.Renewed {
+			renewed++
+		}
+		if r.NeedApply {
+			needApply = append(needApply, u)
+		}
+	}
+	if len(needApply) > 0 {
+		if err = ldapuser.SendRenewalApplyCard(task.Userid, needApply); err != nil {
+			log.Log.Error("给用户【"+task.Userid+"】发送账号续期审批卡片错误: ", err)
+		}
+	}
+
+	replaceName := "已续期"
+	switch {
+	case len(users) == 0:
+		replaceName = "未选择账号"
+	case renewed == 0:
+		replaceName = "未续期"
+	case renewed < len(users):
+		replaceName = "部分续期"
+	}
+	if _, err = model.CorpAPIMsg.MessageUpdateTemplateCard(card.Update(task.Userid, model.WeworkUuapCfg.AppId, e.ResponseCode, replaceName)); err != nil {
+		log.Log.Error("更新模板卡片["+task.TaskId+"]错误: ", err)
+	}
+
+	var lines []string
+	for _, r := range results {
+		lines = append(lines, r.Msg)
+	}
+	finishCardTask(&task, strings.Join(lines, "; "))
+	if len(lines) > 0 {
+		sendRenewalResultMsg(task.Userid, lines)
+	}
+}
+
+// renewAccount 按续期策略续期 有SAM账号的续期UUAP账号 否则续期企业微信账号 成功或失败都记录过期处理
+func renewAccount(u model.RenewalApplyUser, self bool) (r renewalResult) {
+	r.User = u
+	account := u.Name + "(" + u.Sam + ")"
+	now := time.Now()
+
+	var ldapUser *ldapuser.LdapAttributes
+	var weworkUser UserDetails
+	var expireAt time.Time
+	var disabled bool
+	if u.Sam != "" {
+		entries := ldapuser.FetchLdapUsers(&ldapuser.LdapAttributes{Sam: u.Sam})
+		if len(entries) == 0 {
+			r.Msg = account + " 未找到账号"
+			return
+		}
+		ldapUser, _ = ldapuser.NewUser(entries[0])
+		if ldapUser.Expire == 0 || ldapUser.Expire == math.MaxInt64 {
+			r.Msg = account + " 账号永不过期 无需续期"
+			return
+		}
+		expireAt, disabled = util.NtToUnix(ldapUser.Expire), ldapUser.IsDisabled()
+	} else {
+		account = u.Name + "(企业微信)"
+		var err error
+		if weworkUser, err = FetchUser(u.Eid); err != nil || userExpireDate(weworkUser) == "" {
+			r.Msg = account + " 未找到有过期日期的企业微信账号"
+			return
+		}
+		expireAt, disabled = util.ExpireStrToTime(userExpireDate(weworkUser)), weworkUser.Status == weworkUserDisabled
+	}
+	expireDays := util.SubDays(expireAt, now)
+
+	var renewedTimes int64
+	if self {
+		renewedTimes = model.CountExpireActions(u.Eid, u.Sam, model.ActionRenewSelf, now.AddDate(-1, 0, 0))
+	}
+	if reason, needApply := checkRenewal(model.RenewalCfg, expireDays, disabled, self, renewedTimes); reason != "" {
+		r.Msg, r.NeedApply = account+" "+reason, needApply
+		return
+	}
+
+	if expireAt.Before(now) {
+		expireAt = now
+	}
+	newExpireAt := expireAt.AddDate(0, 0, model.RenewalCfg.RenewalDays())
+	var err error
+	if ldapUser != nil {
+		ldapUser.Expire = util.UnixToNt(newExpireAt)
+		err = ldapUser.Renewal()
+	} else if err = weworkUser.Renewal(u.Eid, util.SubDays(newExpireAt, now)); err == nil {
+		_ = RefreshUser(weworkUser.Userid)
+	}
+
+	record := model.ExpireActionRecord{
+		Kind:     model.ReminderKindAccount,
+		Name:     u.Name,
+		Eid:      u.Eid,
+		Sam:      u.Sam,
+		Days:     expireDays,
+		Action:   model.ActionRenewSponsor,
+		Channels: model.ChannelWework,
+	}
+	if self {
+		record.Action = model.ActionRenewSelf
+	}
+	if err != nil {
+		log.Log.Error("一键续期【"+account+"】错误: ", err)
+		record.Result = err.Error()
+		model.CreateExpireActionRecord(record)
+		r.Msg = account + " 续期失败"
+		return
+	}
+	model.CreateExpireActionRecord(record)
+	log.Log.Info("一键续期:账号【" + account + "】状态【续期至" + newExpireAt.Format("2006-01-02") + "】")
+	r.Msg, r.Renewed = account+" 已续期至"+newExpireAt.Format("2006-01-02"), true
+	return
+}
+
+// checkRenewal 一键续期策略 返回不能续期的原因及是否需提交账号续期审批
+// 已禁用的账号须提交审批；距离过期超过提前天数的暂不续期；本人只能在过期前续期 且一年内次数有限
+func checkRenewal(cfg model.RenewalConfig, expireDays int, disabled, self bool, renewedTimes int64) (reason string, needApply bool) {
+	switch {
+	case disabled:
+		return "账号已禁用 需提交账号续期审批", true
+	case expireDays > cfg.RenewalAheadDays():
+		return "剩余" + strconv.Itoa(expireDays) + "天 暂无需续期", false
+	case self && expireDays < 0:
+		return "账号已过期 需申请人确认或提交账号续期审批", true
+	case self && renewedTimes >= int64(cfg.RenewalMaxTimes()):
+		return "一年内已自助续期" + strconv.FormatInt(renewedTimes, 10) + "次 需申请人确认或提交账号续期审批", true
+	}
+	return "", false
+}
+
+// finishCardTask 记录卡片处理结果 失败时任务停留在处理中 需人工核对
+func finishCardTask(task *model.CardTask, result string) {
+	if err := model.FinishCardTask(task, result); err != nil {
+		log.Log.Error("记录卡片任务["+task.TaskId+"]结果错误: ", err)
+	}
+}
+
+// sendRenewalResultMsg 回执续期结果
+func sendRenewalResultMsg(userid string, lines []string) {
+	_, err := notify.Notify(notify.Recipient{Userid: userid}, notify.EventRenewalResult,
+		notify.Data{"Content": "账号续期结果\n>" + strings.Join(lines, "\n>")})
+	if err != nil {
+		log.Log.Error(err)
+	}
+}
@@ -0,0 +1,33 @@
+package wework
+
+import (
+	"testing"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+)
+
+func TestCheckRenewal(t *testing.T) {
+	cfg := model.RenewalConfig{MaxTimes: 2, AheadDays: 14}
+	cases := []struct {
+		name         string
+		expireDays   int
+		disabled     bool
+		self         bool
+		renewedTimes int64
+		allowed      bool
+		needApply    bool
+	}{
+		{"本人即将过期", 7, false, true, 1, true, false},
+		{"本人次数用完", 7, false, true, 2, false, true},
+		{"本人已过期", -1, false, true, 0, false, true},
+		{"担保人确认已过期", -3, false, false, 5, true, false},
+		{"已禁用", 3, true, false, 0, false, true},
+		{"尚早", 20, false, false, 0, false, false},
+	}
+	for _, c := range cases {
+		reason, needApply := checkRenewal(cfg, c.expireDays, c.disabled, c.self, c.renewedTimes)
+		if (reason == "") != c.allowed || needApply != c.needApply {
+			t.Errorf("%s: got %q %v", c.name, reason, needApply)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package wework
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+const (
+	DepartCreate = "create" // 新建部门
+	DepartUpdate = "update" // 改名或移动
+	DepartAdopt  = "adopt"  // 上级下已有同名部门 只保存对应关系
+	DepartRemap  = "remap"  // HR路径变化但企业微信部门无需修改 只更新对应关系
+	DepartDelete = "delete" // HR中已不存在且没有成员
+	DepartKeep   = "keep"   // HR中已不存在但仍有成员 保留
+	DepartUnmap  = "unmap"  // 企业微信中已删除 只删除对应关系
+
+	defaultRootDepartId = 1
+)
+
+// DepartSyncService 企业微信部门同步 请求参数
+type DepartSyncService struct {
+	DryRun bool `form:"dry_run" json:"dry_run"` // 只返回变更 不执行
+}
+
+// DepartAction 单个部门的变更
+type DepartAction struct {
+	Action   string `json:"action"`
+	Path     string `json:"path"`               // HR部门路径
+	OldPath  string `json:"old_path,omitempty"` // 改名或移动前的HR部门路径
+	Name     string `json:"name"`
+	Id       int    `json:"id"`        // 企业微信部门id 新建前为负数占位
+	ParentId int    `json:"parent_id"` // 上级企业微信部门id 上级待新建时为负数占位
+	Result   string `json:"result,omitempty"`
+}
+
+// departState 生成部门变更所需的数据
+type departState struct {
+	hrMembers     map[string]map[string]bool // HR部门路径->部门及下级的在职工号
+	departs       map[int]Depart             // 企业微信部门
+	weworkMembers map[int]map[string]bool    // 企业微信部门id->部门及下级成员工号
+	otherMembers  map[int]int                // 企业微信部门id->部门及下级没有工号的成员数
+	mappings      map[string]int             // 已保存的HR部门路径->企业微信部门id
+	rootId        int                        // HR一级部门所在的企业微信部门
+}
+
+// Sync 同步HR部门到企业微信 dry_run时只返回变更
+func (s *DepartSyncService) Sync() serializer.Response {
+	actions, err := BuildDepartPlan()
+	if err != nil {
+		return serializer.Err(serializer.CodeParamErr, "生成部门变更失败", err)
+	}
+	if !s.DryRun {
+		applyDeparts(actions)
+	}
+	return serializer.Response{Data: actions}
+}
+
+// SyncDeparts 将HR部门结构同步到企业微信 有变更时发机器人消息
+func SyncDeparts() {
+	actions, err := BuildDepartPlan()
+	if err != nil {
+		log.Log.Error("生成部门变更错误: ", err)
+		return
+	}
+	applyDeparts(actions)
+
+	counts := make(map[string]int)
+	var failed []string
+	for _, a := range actions {
+		counts[a.Action]++
+		if a.Action != DepartKeep && a.Result != "" && a.Result != "成功" {
+			failed = append(failed, ">"+a.Action+" "+a.Path+` <font color="warning">`+a.Result+`</font>`)
+		}
+	}
+	if counts[DepartCreate]+counts[DepartUpdate]+counts[DepartDelete]+len(failed) == 0 {
+		log.Log.Info("企业微信部门无变化!")
+		return
+	}
+	msg := fmt.Sprintf(`<font color="warning"> 企业微信部门同步 </font>新建%d 改名或移动%d 删除%d 保留%d`,
+		counts[DepartCreate], counts[DepartUpdate], counts[DepartDelete], counts[DepartKeep])
+	if len(failed) > 0 {
+		msg += "\n" + strings.Join(failed, "\n")
+	}
+	notify.Robot(msg)
+	log.Log.Info("企业微信部门同步完成!")
+}
+
+// BuildDepartPlan 对比HR部门结构、企业微信部门与已保存的对应关系 生成变更
+func BuildDepartPlan() (actions []DepartAction, err error) {
+	s := departState{
+		hrMembers:     make(map[string]map[string]bool),
+		departs:       make(map[int]Depart),
+		weworkMembers: make(map[int]map[string]bool),
+		otherMembers:  make(map[int]int),
+		mappings:      make(map[string]int),
+		rootId:        model.WeworkDepartCfg.RootId,
+	}
+	if s.rootId <= 0 {
+		s.rootId = defaultRootDepartId
+	}
+
+	rawHrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		return nil, errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
+	}
+	for _, v := range rawHrUsers {
+		var u hr.User
+		if json.Unmarshal([]byte(v), &u) != nil || u.Stat == hr.StatLeft || strings.TrimSpace(u.Department) == "" {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(u.Department), ".")
+		for i := range parts {
+			addMember(s.hrMembers, strings.Join(parts[:i+1], "."), strings.TrimSpace(u.Eid))
+		}
+	}
+
+	departsMsg, err := FetchDeparts()
+	if err != nil {
+		return
+	}
+	for _, d := range departsMsg.Department {
+		s.departs[d.Id] = d
+	}
+
+	// 成员计入所在部门及其所有上级 没有工号的成员只计数 判断部门是否为空时一并计入
+	rawWeworkUsers, err := cache.HGetAll("wework_users")
+	if err != nil {
+		return nil, errors.Wrap(err, "查询企微用户缓存错误")
+	}
+	for eid, v := range rawWeworkUsers {
+		var u UserDetails
+		if json.Unmarshal([]byte(v), &u) != nil {
+			continue
+		}
+		s.eachAncestor(u.Department, func(id int) {
+			if s.weworkMembers[id] == nil {
+				s.weworkMembers[id] = make(map[string]bool)
+			}
+			s.weworkMembers[id][eid] = true
+		})
+	}
+	rawInvalidUsers, err := cache.HGetAll("wework_users_invalid")
+	if err != nil {
+		return nil, errors.Wrap(err, "查询企微用户缓存错误")
+	}
+	for _, v := range rawInvalidUsers {
+		var u UserDetails
+		if json.Unmarshal([]byte(v), &u) != nil {
+			continue
+		}
+		s.eachAncestor(u.Department, func(id int) { s.otherMembers[id]++ })
+	}
+
+	mappings, err := model.FetchWeworkDepartMappings()
+	if err != nil {
+		return
+	}
+	for _, m := range mappings {
+		s.mappings[m.Path] = m.DepartId
+	}
+	return planDeparts(s), nil
+}
+
+// eachAncestor 遍历成员所在部门及其所有上级 多个部门的共同上级只遍历一次
+func (s departState) eachAncestor(departIds []int, fn func(id int)) {
+	seen := make(map[int]bool)
+	for _, id := range departIds {
+		for ; id != 0 && !seen[id]; id = s.departs[id].Parentid {
+			seen[id] = true
+			fn(id)
+		}
+	}
+}
+
+// addMember 将工号计入部门
+func addMember(members map[string]map[string]bool, path, eid string) {
+	if members[path] == nil {
+		members[path] = make(map[string]bool)
+	}
+	members[path][eid] = true
+}
+
+// planDeparts 按层级从上到下生成变更 优先沿用上级下的同名部门 其次按成员重合度识别改名或移动 最后新建
+func planDeparts(s departState) (actions []DepartAction) {
+	resolved := make(map[string]int) // HR部门路径->企业微信部门id
+	claimed := make(map[int]bool)    // 已对应HR部门的企业微信部门
+	var vanished []string            // HR中已不存在的路径
+	mapped := make([]string, 0, len(s.mappings))
+	for path := range s.mappings {
+		mapped = append(mapped, path)
+	}
+	sort.Strings(mapped)
+	for _, path := range mapped {
+		id := s.mappings[path]
+		if _, ok := s.departs[id]; !ok {
+			actions = append(actions, DepartAction{Action: DepartUnmap, Path: path, Id: id})
+			continue
+		}
+		claimed[id] = true
+		if _, ok := s.hrMembers[path]; ok {
+			resolved[path] = id
+		} else {
+			vanished = append(vanished, path)
+		}
+	}
+
+	paths := make([]string, 0, len(s.hrMembers))
+	for path := range s.hrMembers {
+		paths = append(paths, path)
+	}
+	sortByDepth(paths, false)
+
+	placeholder := 0
+	for _, path := range paths {
+		name, parentPath := splitDepartPath(path)
+		parentId := s.rootId
+		if parentPath != "" {
+			parentId = resolved[parentPath]
+		}
+
+		if id, ok := resolved[path]; ok { // 已对应 名称或上级被改动时修正
+			if d := s.departs[id]; d.Name != name || d.Parentid != parentId {
+				actions = append(actions, DepartAction{Action: DepartUpdate, Path: path, Name: name, Id: id, ParentId: parentId})
+			}
+			continue
+		}
+
+		action := DepartAction{Path: path, Name: name, ParentId: parentId}
+		if id := findChildDepart(s.departs, claimed, parentId, name); id != 0 {
+			action.Action, action.Id = DepartAdopt, id
+		} else if i := bestVanished(s, vanished, path); i >= 0 {
+			action.OldPath, action.Id = vanished[i], s.mappings[vanished[i]]
+			action.Action = DepartUpdate
+			if d := s.departs[action.Id]; d.Name == name && d.Parentid == parentId {
+				action.Action = DepartRemap
+			}
+			vanished = append(vanished[:i], vanished[i+1:]...)
+		} else {
+			placeholder--
+			action.Action, action.Id = DepartCreate, placeholder
+		}
+		claimed[action.Id] = true
+		resolved[path] = action.Id
+		actions = append(actions, action)
+	}
+
+	// 下级先删除
+	sortByDepth(vanished, true)
+	for _, path := range vanished {
+		id := s.mappings[path]
+		action := DepartAction{Action: DepartDelete, Path: path, Name: s.departs[id].Name, Id: id, ParentId: s.departs[id].Parentid}
+		if n := len(s.weworkMembers[id]) + s.otherMembers[id]; n > 0 {
+			action.Action = DepartKeep
+			action.Result = "仍有" + strconv.Itoa(n) + "名成员"
+		}
+		actions = append(actions, action)
+	}
+	return
+}
+
+// splitDepartPath 拆分出部门名称与上级路径
+func splitDepartPath(path string) (name, parentPath string) {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[i+1:], path[:i]
+	}
+	return path, ""
+}
+
+// sortByDepth 按层级排序 同级按路径排序
+func sortByDepth(paths []string, deepestFirst bool) {
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := strings.Count(paths[i], "."), strings.Count(paths[j], ".")
+		if di != dj {
+			return (di < dj) != deepestFirst
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// findChildDepart 查找上级下未对应HR部门的同名部门
+func findChildDepart(departs map[int]Depart, claimed map[int]bool, parentId int, name string) int {
+	if parentId <= 0 {
+		return 0
+	}
+	for id, d := range departs {
+		if d.Parentid == parentId && d.Name == name && !claimed[id] {
+			return id
+		}
+	}
+	return 0
+}
+
+// bestVanished 在HR中已不存在的路径里 找企业微信成员与新路径HR成员重合过半的部门 视为改名或移动
+func bestVanished(s departState, vanished []string, path string) int {
+	members := s.hrMembers[path]
+	best, bestCount := -1, 0
+	for i, old := range vanished {
+		count := 0
+		for eid := range s.weworkMembers[s.mappings[old]] {
+			if members[eid] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	if bestCount*2 <= len(members) {
+		return -1
+	}
+	return best
+}
+
+// applyDeparts 按顺序执行部门变更 结果写入Result
+func applyDeparts(actions []DepartAction) {
+	created := make(map[int]int) // 占位id->新建的部门id
+	realId := func(id int) int {
+		if id < 0 {
+			return created[id]
+		}
+		return id
+	}
+
+	for i := range actions {
+		a := &actions[i]
+		var err error
+		switch a.Action {
+		case DepartCreate, DepartUpdate:
+			parentId := realId(a.ParentId)
+			if parentId == 0 {
+				a.Result = "上级部门未创建"
+				continue
+			}
+			if a.Action == DepartCreate {
+				var res map[string]interface{}
+				if res, err = model.CorpAPIUserManager.DepartmentCreate(map[string]interface{}{"name": a.Name, "parentid": parentId}); err == nil {
+					id, _ := res["id"].(float64)
+					created[a.Id], a.Id = int(id), int(id)
+				}
+			} else {
+				_, err = model.CorpAPIUserManager.DepartmentUpdate(map[string]interface{}{"id": a.Id, "name": a.Name, "parentid": parentId})
+			}
+			a.ParentId = parentId
+			if err == nil {
+				err = saveDepartMapping(a)
+			}
+		case DepartAdopt, DepartRemap:
+			err = saveDepartMapping(a)
+		case DepartDelete:
+			if _, err = model.CorpAPIUserManager.DepartmentDelete(map[string]interface{}{"id": strconv.Itoa(a.Id)}); err == nil {
+				err = model.DeleteWeworkDepartMapping(a.Path)
+			}
+		case DepartUnmap:
+			err = model.DeleteWeworkDepartMapping(a.Path)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Log.Error("企业微信部门["+a.Action+"]["+a.Path+"]错误: ", err)
+			a.Result = err.Error()
+		} else {
+			a.Result = "成功"
+		}
+	}
+}
+
+// saveDepartMapping 保存变更后的对应关系 改名或移动时删除原路径
+func saveDepartMapping(a *DepartAction) error {
+	if a.OldPath != "" {
+		if err := model.DeleteWeworkDepartMapping(a.OldPath); err != nil {
+			return err
+		}
+	}
+	return model.SaveWeworkDepartMapping(a.Path, a.Id, a.Name)
+}
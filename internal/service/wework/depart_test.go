@@ -0,0 +1,82 @@
+package wework
+
+import (
+	"testing"
+)
+
+func members(eids ...string) map[string]bool {
+	m := make(map[string]bool)
+	for _, eid := range eids {
+		m[eid] = true
+	}
+	return m
+}
+
+func TestPlanDeparts(t *testing.T) {
+	s := departState{
+		hrMembers: map[string]map[string]bool{
+			"集团":          members("1", "2", "3", "4"),
+			"集团.研发中心":     members("1", "2", "3"),
+			"集团.研发中心.平台部": members("1", "2"),
+			"集团.市场部":      members("4"),
+		},
+		departs: map[int]Depart{
+			1:  {Id: 1, Name: "企业", Parentid: 0},
+			10: {Id: 10, Name: "集团", Parentid: 1},
+			11: {Id: 11, Name: "研发部", Parentid: 10},
+			12: {Id: 12, Name: "平台部", Parentid: 11},
+			13: {Id: 13, Name: "行政部", Parentid: 10},
+			14: {Id: 14, Name: "旧部门", Parentid: 10},
+			15: {Id: 15, Name: "外包部", Parentid: 10},
+		},
+		weworkMembers: map[int]map[string]bool{
+			10: members("1", "2", "3", "5"),
+			11: members("1", "2", "3"),
+			12: members("1", "2"),
+			13: members("5"),
+		},
+		otherMembers: map[int]int{10: 1, 15: 1},
+		mappings: map[string]int{
+			"集团.研发部":     11,
+			"集团.研发部.平台部": 12,
+			"集团.行政部":     13,
+			"集团.财务部":     14,
+			"集团.外包部":     15,
+			"集团.已删除":     99,
+		},
+		rootId: 1,
+	}
+
+	got := make(map[string]DepartAction)
+	for _, a := range planDeparts(s) {
+		got[a.Path] = a
+	}
+	want := map[string]struct {
+		action string
+		id     int
+	}{
+		"集团.已删除":      {DepartUnmap, 99},
+		"集团":          {DepartAdopt, 10},
+		"集团.研发中心":     {DepartUpdate, 11}, // 改名
+		"集团.研发中心.平台部": {DepartRemap, 12},  // 随上级改名 部门本身不变
+		"集团.市场部":      {DepartCreate, -1},
+		"集团.行政部":      {DepartKeep, 13}, // 仍有成员
+		"集团.财务部":      {DepartDelete, 14},
+		"集团.外包部":      {DepartKeep, 15}, // 只有没有工号的成员
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d actions, want %d: %+v", len(got), len(want), got)
+	}
+	for path, w := range want {
+		a := got[path]
+		if a.Action != w.action || a.Id != w.id {
+			t.Errorf("%s: got %s %d, want %s %d", path, a.Action, a.Id, w.action, w.id)
+		}
+	}
+	if a := got["集团.研发中心"]; a.OldPath != "集团.研发部" || a.Name != "研发中心" || a.ParentId != 10 {
+		t.Errorf("rename: got %+v", a)
+	}
+	if a := got["集团.市场部"]; a.ParentId != 10 {
+		t.Errorf("create parent: got %d, want 10", a.ParentId)
+	}
+}
@@ -13,10 +13,10 @@ import (
 	"gitee.com/RandolphCYG/akita/internal/model"
 	"gitee.com/RandolphCYG/akita/internal/service/ldapconn"
 	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
 	"gitee.com/RandolphCYG/akita/pkg/serializer"
 
 	"gitee.com/RandolphCYG/akita/pkg/c7n"
-	"gitee.com/RandolphCYG/akita/pkg/cache"
 	"gitee.com/RandolphCYG/akita/pkg/util"
 )
 
@@ -130,12 +130,12 @@ func fetchLatestCompanyType() (err error) {
 
 // handleOrderAccountsRegister 账号注册 工单
 func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
-	// 支持处理多个申请者
+	// 支持处理多个申请者 单个申请者失败时记录并继续处理其他申请者
+	var failed []string
 	for _, applicant := range o.Users {
 		var expire int64
 		var isOutsideComp bool
 		var sam, dn, weworkExpireStr string
-		var weworkDepartId, probationFlag int
 		displayName := []rune(applicant.DisplayName)
 		cn := string(displayName) + applicant.Eid
 
@@ -157,25 +157,32 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 			if v, ok := companyTypes[applicant.Company]; ok {
 				isOutsideComp = v.IsOuter
 			} else {
-				err = errors.Wrap(err, serializer.ErrCompanyNotExists)
-				return
+				log.Log.Error("账号注册:申请者[" + applicant.DisplayName + applicant.Eid + "]" + serializer.ErrCompanyNotExists + applicant.Company)
+				failed = append(failed, applicant.DisplayName+applicant.Eid+":"+serializer.ErrCompanyNotExists+applicant.Company)
+				continue
 			}
 		}
 
+		// 企业微信部门、标签、C7N默认项目和有效期按公司配置
+		setting, ok := model.FetchCompanySetting(applicant.Company, isOutsideComp)
+		if !ok {
+			log.Log.Error("账号注册:申请者[" + applicant.DisplayName + applicant.Eid + "]" + serializer.ErrCompanySettingNotExists + applicant.Company)
+			failed = append(failed, applicant.DisplayName+applicant.Eid+":"+serializer.ErrCompanySettingNotExists+applicant.Company)
+			continue
+		}
+
 		// 不同公司个性化用户名与OU
 		if isOutsideComp {
 			sam = companyTypes[applicant.Company].Prefix + applicant.Eid // 用户名带前缀
 			dn = "CN=" + cn + ",OU=" + applicant.Company + "," + model.LdapFields.BaseDnOuter
-			expire = util.ExpireTime(int64(90)) // 90天过期
-			weworkExpireStr = util.ExpireStr(90)
-			weworkDepartId = 79 // 外部公司企业微信部门为合作伙伴
-			probationFlag = 0
 		} else { // 公司内部人员默认放到待分配区 后面每天程序自动将用户架构刷新
 			sam = applicant.Eid
 			dn = "CN=" + cn + "," + model.LdapFields.BaseDnToBeAssigned
-			expire = util.ExpireTime(int64(-1)) // 永不过期
-			weworkDepartId = 69                 // 本公司企业微信部门为待分配
-			probationFlag = 1
+		}
+		expire = util.ExpireTime(int64(-1)) // 永不过期
+		if setting.ExpireDays > 0 {
+			expire = util.ExpireTime(int64(setting.ExpireDays))
+			weworkExpireStr = util.ExpireStr(setting.ExpireDays)
 		}
 		// 组装LDAP用户数据
 		userInfos := &ldapuser.LdapAttributes{
@@ -192,8 +199,9 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 			Phone:          applicant.Mobile,
 			Company:        applicant.Company,
 			WeworkExpire:   weworkExpireStr,
-			WeworkDepartId: weworkDepartId,
-			ProbationFlag:  probationFlag,
+			WeworkDepartId: setting.WeworkDepartId,
+			WeworkTagId:    setting.WeworkTagId,
+			WeworkTagName:  setting.WeworkTagName,
 		}
 
 		// 将平台切片转为map 用于判断是否存在某平台
@@ -208,6 +216,20 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 			err = ldapuser.CreateLdapUser(o, userInfos)
 			if err != nil {
 				log.Log.Error(err)
+			} else {
+				// 记录申请人与担保人 账号即将过期时通知
+				model.SaveAccountSponsor(model.AccountSponsor{
+					Sam:        userInfos.Sam,
+					Eid:        applicant.Eid,
+					Name:       userInfos.DisplayName,
+					Company:    applicant.Company,
+					Applicant:  o.Userid,
+					SponsorEid: applicant.SponsorEid,
+					SpNo:       o.SpNo,
+				})
+				if applicant.SponsorEid != "" {
+					model.SaveIdentity(userInfos.Num, map[string]interface{}{"sponsor_eid": applicant.SponsorEid})
+				}
 			}
 		}
 
@@ -217,7 +239,8 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 				err := handleWeworkDuplicateRegister(o, userInfos)
 				if err != nil {
 					log.Log.Error("Fail to handle wework duplication register, ", err)
-					return err
+					failed = append(failed, applicant.DisplayName+applicant.Eid+":"+err.Error())
+					continue
 				}
 			} else {
 				// 执行生成 企业微信账号 操作
@@ -227,9 +250,9 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 					model.CreateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, "自动创建失败, "+err.Error())
 				}
 
-				recordMsg := "新用户 工单公司[" + userInfos.Company + "]分配至企微部门[" + strconv.Itoa(userInfos.WeworkDepartId) + "]"
-				if userInfos.ProbationFlag == 1 {
-					recordMsg += " Tag:[试用期员工]"
+				recordMsg := "新用户 工单公司[" + userInfos.Company + "]分配至企微部门[" + strconv.Itoa(userInfos.WeworkDepartId) + setting.WeworkDepartName + "]"
+				if userInfos.WeworkTagId != 0 {
+					recordMsg += " Tag:[" + userInfos.WeworkTagName + "]"
 				}
 				model.CreateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg)
 				log.Log.Info(recordMsg)
@@ -246,14 +269,22 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 			}
 
 			// 执行初始化 猪齿鱼 操作
-			c7n.SyncUsers()                                                     // 更新ldap用户
-			c7nUser, _ := c7n.FetchUser(applicant.DisplayName, applicant.Eid)   // 将新ldap用户添加到默认空项目
-			role, _ := c7n.FetchRole("项目成员")                                    // 获取项目成员角色的ID
-			err = c7n.AssignUserProjectRole("4", c7nUser.Id, []string{role.Id}) // 分配角色
-			if err != nil {
-				err = errors.Wrap(err, serializer.ErrAssignUserC7nDefaultProject)
-				log.Log.Error(err)
-				return
+			c7n.SyncUsers()                                                        // 更新ldap用户
+			c7nUser, c7nErr := c7n.FetchUser(applicant.DisplayName, applicant.Eid) // 将新ldap用户添加到公司配置的默认项目
+			if c7nErr != nil || c7nUser.Id == "" {
+				log.Log.Error("账号注册:申请者["+applicant.DisplayName+applicant.Eid+"]查询猪齿鱼用户错误: ", c7nErr)
+			} else {
+				model.SaveIdentity(userInfos.Num, map[string]interface{}{"c7n_user_id": c7nUser.Id})
+			}
+			if setting.C7nProjectId != "" {
+				role, _ := c7n.FetchRole("项目成员")                                                     // 获取项目成员角色的ID
+				err = c7n.AssignUserProjectRole(setting.C7nProjectId, c7nUser.Id, []string{role.Id}) // 分配角色
+				if err != nil {
+					err = errors.Wrap(err, serializer.ErrAssignUserC7nDefaultProject)
+					log.Log.Error(err)
+					failed = append(failed, applicant.DisplayName+applicant.Eid+":"+err.Error())
+					continue
+				}
 			}
 		}
 
@@ -269,16 +300,14 @@ func handleOrderAccountsRegister(o model.AccountsRegister) (err error) {
 			// TODO 执行初始化 UVPN 操作
 		}
 	}
+	if len(failed) > 0 {
+		err = errors.New("账号注册失败" + strconv.Itoa(len(failed)) + "人: " + strings.Join(failed, "; "))
+	}
 	return
 }
 
 // handleWeworkDuplicateRegister 处理企业微信用户重复注册
 func handleWeworkDuplicateRegister(o model.AccountsRegister, user *ldapuser.LdapAttributes) (err error) {
-	duplicateRegisterWeworkUserWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_wework_user_duplicate_register")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-
 	// 获取连接
 	LdapConn, err := model.LdapPool.Get()
 	if err != nil {
@@ -293,16 +322,9 @@ func handleWeworkDuplicateRegister(o model.AccountsRegister, user *ldapuser.Ldap
 	}
 	sam := entry.GetAttributeValue("sAMAccountName")
 
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(duplicateRegisterWeworkUserWeworkMsgTemplate, o.SpName, user.DisplayName, sam),
-		},
-	})
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventWeworkUserDuplicateRegister,
+		notify.Data{"SpName": o.SpName, "DisplayName": user.DisplayName, "Sam": sam})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单【" + o.SpName + "】用户【" + o.Userid + "】姓名【" + user.DisplayName + "】工号【" + user.Num + "】状态【已注册过的企业微信用户】")
@@ -322,20 +344,9 @@ func handleOrderUuapPwdRetrieve(o model.UuapPwdRetrieve) (err error) {
 	}
 
 	// 创建成功发送企业微信消息
-	retrieveUuapPwdWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_pwd_retrieve")
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventPwdRetrieve,
+		notify.Data{"SpName": o.SpName, "DisplayName": user.DisplayName, "Sam": sam, "Pwd": newPwd})
 	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(retrieveUuapPwdWeworkMsgTemplate, o.SpName, user.DisplayName, sam, newPwd),
-		},
-	})
-	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + o.DisplayName + "]工号[" + o.Eid + "]状态[密码找回]")
@@ -356,20 +367,9 @@ func handleOrderUuapDisable(o model.UuapDisable) (err error) {
 	}
 
 	// 续期成功发送企业微信消息
-	renewalUuapWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_uuap_disable")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(renewalUuapWeworkMsgTemplate, o.SpName, user.DisplayName),
-		},
-	})
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventUuapDisable,
+		notify.Data{"SpName": o.SpName, "DisplayName": user.DisplayName})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + o.DisplayName + "]工号[" + o.Eid + "]状态[注销]")
@@ -424,20 +424,9 @@ func RenewalUuap(o model.AccountsRenewal, applicant model.RenewalApplicant) (err
 	}
 
 	// 续期成功发送企业微信消息
-	renewalUuapWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_uuap_renewal")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(renewalUuapWeworkMsgTemplate, o.SpName, user.DisplayName, applicant.Days),
-		},
-	})
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventUuapRenewal,
+		notify.Data{"SpName": o.SpName, "DisplayName": user.DisplayName, "Days": applicant.Days})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + applicant.DisplayName + "]工号[" + applicant.Eid + "]状态[续期" + applicant.Days + "天]")
@@ -468,22 +457,9 @@ func RenewalWework(o model.AccountsRenewal, applicant model.RenewalApplicant) (e
 
 // RenewalWeworkErrMsg 企微用户续期错误回执消息
 func RenewalWeworkErrMsg(spName, userid, name, eid string) {
-	renewalNotifyWeworkMsgErrTemplate, err := cache.HGet("wework_msg_templates", "wework_template_wework_renewal_err")
-	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-
-	msg := map[string]interface{}{
-		"touser":  userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(renewalNotifyWeworkMsgErrTemplate, spName, name, eid),
-		},
-	}
-	_, err = model.CorpAPIMsg.MessageSend(msg)
+	_, err := notify.Notify(notify.Recipient{Userid: userid}, notify.EventWeworkRenewalErr,
+		notify.Data{"SpName": spName, "Name": name, "Eid": eid})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:企业微信用户【" + userid + "】姓名【" + name + "】状态【企微续期-未找到用户错误】")
@@ -491,23 +467,9 @@ func RenewalWeworkErrMsg(spName, userid, name, eid string) {
 
 // RenewalWeworkSuccessMsg 企微用户续期成功回执消息
 func RenewalWeworkSuccessMsg(o model.AccountsRenewal, user UserDetails, applicant model.RenewalApplicant) (err error) {
-	renewalWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_wework_renewal")
-	if err != nil {
-		//err = errors.New("读取企业微信消息模板错误: " + err.Error())
-		//err = errors.WithStack(err)
-		err = errors.WithMessage(err, "读取企业微信消息模板错误")
-		return
-	}
-	_, err = model.CorpAPIMsg.MessageSend(map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(renewalWeworkMsgTemplate, o.SpName, user.Name, applicant.Days),
-		},
-	})
+	_, err = notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventWeworkRenewal,
+		notify.Data{"SpName": o.SpName, "Name": user.Name, "Days": applicant.Days})
 	if err != nil {
-		err = errors.New("Fail to send wework msg, err: " + err.Error())
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + applicant.DisplayName + "]工号[" + applicant.Eid + "]状态[续期" + applicant.Days + "天]")
@@ -516,18 +478,9 @@ func RenewalWeworkSuccessMsg(o model.AccountsRenewal, user UserDetails, applican
 
 // handleWeworkOrderFindUserErr 处理未找到企微用户错误
 func handleWeworkOrderFindUserErr(o model.AccountsRenewal, name, eid string) {
-	c7nFindProjectErrMsgTemplate, _ := cache.HGet("wework_msg_templates", "wework_template_wework_find_user_err")
-	msg := map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(c7nFindProjectErrMsgTemplate, o.SpName, name, name, eid),
-		},
-	}
-	_, err := model.CorpAPIMsg.MessageSend(msg)
+	_, err := notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventWeworkFindUserErr,
+		notify.Data{"SpName": o.SpName, "DisplayName": name, "Name": name, "Eid": eid})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + name + "]工号[" + eid + "]状态[c7n项目权限|未找到企微用户,姓名: " + name + " 工号: " + eid + "]")
@@ -535,18 +488,9 @@ func handleWeworkOrderFindUserErr(o model.AccountsRenewal, name, eid string) {
 
 // handleC7nOrderFindUserErr 处理未找到c7n用户错误
 func handleC7nOrderFindUserErr(o model.C7nAuthority, name, eid string) {
-	c7nFindProjectErrMsgTemplate, _ := cache.HGet("wework_msg_templates", "wework_template_c7n_find_user_err")
-	msg := map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(c7nFindProjectErrMsgTemplate, o.SpName, o.DisplayName, name, eid),
-		},
-	}
-	_, err := model.CorpAPIMsg.MessageSend(msg)
+	_, err := notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventC7nFindUserErr,
+		notify.Data{"SpName": o.SpName, "DisplayName": o.DisplayName, "Name": name, "Eid": eid})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + o.DisplayName + "]工号[" + o.Eid + "]状态[c7n项目权限|未找到c7n用户,姓名: " + name + " 工号: " + eid + "]")
@@ -554,18 +498,9 @@ func handleC7nOrderFindUserErr(o model.C7nAuthority, name, eid string) {
 
 // handleC7nOrderFindProjectErr 处理未找到c7n项目错误
 func handleC7nOrderFindProjectErr(o model.C7nAuthority, p string) {
-	c7nFindProjectErrMsgTemplate, _ := cache.HGet("wework_msg_templates", "wework_template_c7n_find_project_err")
-	msg := map[string]interface{}{
-		"touser":  o.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(c7nFindProjectErrMsgTemplate, o.SpName, o.DisplayName, p),
-		},
-	}
-	_, err := model.CorpAPIMsg.MessageSend(msg)
+	_, err := notify.Notify(notify.Recipient{Userid: o.Userid}, notify.EventC7nFindProjectErr,
+		notify.Data{"SpName": o.SpName, "DisplayName": o.DisplayName, "Project": p})
 	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
 		return
 	}
 	log.Log.Info("企业微信回执消息:工单[" + o.SpName + "]用户[" + o.Userid + "]姓名[" + o.DisplayName + "]工号[" + o.Eid + "]状态[c7n项目权限|未找到c7n项目: " + p + " ]")
@@ -624,6 +559,7 @@ func ParseRawOrder(rawInfo interface{}) (orderData map[string]interface{}, err e
 
 	// 清洗工单
 	orderData = make(map[string]interface{})
+	orderData["spNo"] = weworkOrder.SpNo
 	orderData["spName"] = weworkOrder.SpName
 	orderData["partyid"] = weworkOrder.Applyer.Partyid
 	orderData["userid"] = weworkOrder.Applyer.Userid
@@ -724,6 +660,7 @@ func RawToAccountsRegister(weworkOrder map[string]interface{}) (orderDetails mod
 		}
 		// 将单转多
 		orderDetails.Partyid = temp.Partyid
+		orderDetails.SpNo = temp.SpNo
 		orderDetails.SpName = temp.SpName
 		orderDetails.Userid = temp.Userid
 		orderDetails.Users = append(orderDetails.Users, model.Applicant{
@@ -733,6 +670,7 @@ func RawToAccountsRegister(weworkOrder map[string]interface{}) (orderDetails mod
 			Mail:          temp.Mail,
 			Company:       temp.Company,
 			InitPlatforms: temp.InitPlatforms,
+			SponsorEid:    temp.SponsorEid,
 		})
 	} else {
 		if err := mapstructure.Decode(weworkOrder, &orderDetails); err != nil {
@@ -0,0 +1,188 @@
+package wework
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// ProbationService 试用期记录查询 请求参数
+type ProbationService struct {
+	Eid    string `form:"eid" json:"eid"`       // 工号
+	Status string `form:"status" json:"status"` // 状态 probation ended left
+}
+
+// TagUsersMsg 获取标签成员消息
+type TagUsersMsg struct {
+	Userlist []User `json:"userlist"`
+	Errcode  int    `json:"errcode"`
+	Errmsg   string `json:"errmsg"`
+}
+
+// Fetch 查询最近的试用期记录
+func (s *ProbationService) Fetch() serializer.Response {
+	records, err := model.FetchProbationRecords(s.Eid, s.Status, 100)
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: records}
+}
+
+// ScanProbationManual 手动触发扫描试用期员工
+func ScanProbationManual() serializer.Response {
+	go func() {
+		ScanProbation()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发扫描试用期员工成功!"}
+}
+
+// ScanProbation 补建试用期记录 转正的员工移除试用期标签并发送祝贺消息
+// 配置了试用期HR状态时以HR状态判断转正 否则按试用期月数
+func ScanProbation() {
+	hrUsers := make(map[string]hr.User)
+	rawHrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		log.Log.Error(serializer.ErrFetchLDAPUserCache, err)
+		return
+	}
+	for _, v := range rawHrUsers {
+		var u hr.User
+		if json.Unmarshal([]byte(v), &u) == nil {
+			hrUsers[strings.TrimSpace(u.Eid)] = u
+		}
+	}
+	if len(hrUsers) == 0 { // 缓存为空时无法判断离职和转正
+		log.Log.Error("HR用户缓存为空 不扫描试用期员工")
+		return
+	}
+
+	backfillProbationRecords()
+
+	records, err := model.FetchActiveProbationRecords()
+	if err != nil {
+		log.Log.Error("读取试用期记录错误: ", err)
+		return
+	}
+	now := time.Now()
+	for i := range records {
+		r := &records[i]
+		u, ok := hrUsers[r.Eid]
+		if !ok { // HR缓存中没有 可能是缓存不完整 下次再判断
+			continue
+		}
+		if u.Stat == hr.StatLeft { // 离职由离职流程处理 不再移除标签
+			r.Status, r.Result, r.DoneAt = model.ProbationLeft, "HR离职", &now
+			model.UpdateProbationRecord(r)
+			continue
+		}
+		var reason string
+		if stat := model.ProbationCfg.Stat; stat != "" {
+			if u.Stat == stat {
+				continue
+			}
+			reason = "HR状态[" + u.Stat + "]"
+		} else {
+			if now.Before(r.EndAt) {
+				continue
+			}
+			reason = "试用期" + strconv.Itoa(model.ProbationCfg.ProbationMonths()) + "个月届满"
+		}
+		endProbation(r, reason)
+	}
+	log.Log.Info("扫描试用期员工完成!")
+}
+
+// backfillProbationRecords 为有试用期标签但没有记录的员工补建记录 以创建企业微信账号的时间为试用期开始
+func backfillProbationRecords() {
+	eids := make(map[string]string) // 企业微信userid->工号
+	weworkUsers, _ := cache.HGetAll("wework_users")
+	for eid, v := range weworkUsers {
+		var u UserDetails
+		if json.Unmarshal([]byte(v), &u) == nil {
+			eids[u.Userid] = eid
+		}
+	}
+
+	settings, err := model.FetchCompanySettings()
+	if err != nil {
+		log.Log.Error("读取公司配置错误: ", err)
+		return
+	}
+	seen := make(map[int]bool)
+	for _, s := range settings {
+		if s.WeworkTagId == 0 || seen[s.WeworkTagId] {
+			continue
+		}
+		seen[s.WeworkTagId] = true
+		members, err := FetchTagUsers(s.WeworkTagId)
+		if err != nil {
+			log.Log.Error("读取企业微信标签["+s.WeworkTagName+"]成员错误: ", err)
+			continue
+		}
+		for _, m := range members {
+			eid, ok := eids[m.Userid]
+			if !ok {
+				continue
+			}
+			r := &model.ProbationRecord{Eid: eid, Name: m.Name, Userid: m.Userid, TagId: s.WeworkTagId, TagName: s.WeworkTagName}
+			if t, ok := model.FetchFirstWeworkUserSyncTime(eid); ok {
+				r.StartAt = t
+			}
+			if _, err = model.CreateProbationRecord(r); err != nil {
+				log.Log.Error("创建试用期记录错误: ", err)
+			}
+		}
+	}
+}
+
+// endProbation 移除试用期标签 记录并发送祝贺消息 移除失败下次重试
+func endProbation(r *model.ProbationRecord, reason string) {
+	_, err := model.CorpAPIUserManager.TagDeleteUser(map[string]interface{}{
+		"tagid":    r.TagId,
+		"userlist": []string{r.Userid},
+	})
+	if err != nil {
+		log.Log.Error("移除["+r.Name+r.Userid+"]试用期标签错误: ", err)
+		r.Result = err.Error()
+		model.UpdateProbationRecord(r)
+		return
+	}
+	now := time.Now()
+	r.Status, r.Result, r.DoneAt = model.ProbationEnded, reason, &now
+	model.UpdateProbationRecord(r)
+	model.CreateWeworkUserSyncRecord(r.Userid, r.Name, r.Eid, "转正 移除标签["+r.TagName+"] "+reason)
+	log.Log.Info(r.Name, r.Eid, " 转正 移除标签[", r.TagName, "] ", reason)
+
+	if err = sendProbationEndMsg(r); err != nil {
+		log.Log.Error("发送转正祝贺消息错误: ", err)
+	}
+}
+
+// sendProbationEndMsg 发送转正祝贺消息 模板参数为{{.Name}}、{{.StartDate}}
+func sendProbationEndMsg(r *model.ProbationRecord) error {
+	_, err := notify.Notify(notify.Recipient{Userid: r.Userid}, notify.EventProbationEnd,
+		notify.Data{"Name": r.Name, "StartDate": r.StartAt.Format("2006-01-02")})
+	return err
+}
+
+// FetchTagUsers 获取标签成员
+func FetchTagUsers(tagId int) (users []User, err error) {
+	res, err := model.CorpAPIUserManager.TagGetUser(map[string]interface{}{"tagid": strconv.Itoa(tagId)})
+	if err != nil {
+		return
+	}
+	var msg TagUsersMsg
+	b, _ := json.Marshal(res)
+	if err = json.Unmarshal(b, &msg); err != nil {
+		return
+	}
+	return msg.Userlist, nil
+}
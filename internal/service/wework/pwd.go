@@ -0,0 +1,264 @@
+package wework
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/ldapuser"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+const (
+	pwdSessionPrefix  = "wework_pwd_session:"       // 自助修改密码会话
+	pwdResetPrefix    = "wework_pwd_reset_code:"    // 重置密码验证码 按企微userid
+	pwdTrialsPrefix   = "wework_pwd_reset_trials:"  // 验证码尝试次数 按企微userid 重新发送不清零
+	pwdSendPrefix     = "wework_pwd_reset_send:"    // 发送验证码限频 按企微userid
+	pwdModifyPrefix   = "wework_pwd_modify_trials:" // 原密码尝试次数 按企微userid
+	pwdSessionExpire  = 10 * time.Minute
+	pwdResetExpire    = 5 * time.Minute
+	pwdTrialsExpire   = 30 * time.Minute // 尝试次数的统计周期
+	pwdSendInterval   = time.Minute      // 两次发送验证码的最小间隔
+	pwdResetMaxTrials = 5                // 统计周期内验证码、原密码最多尝试次数
+)
+
+// PwdService 企微自助修改/重置密码 请求参数
+type PwdService struct {
+	Code       string `json:"code"`        // 企微OAuth回调的code
+	Token      string `json:"token"`       // 会话token
+	OldPwd     string `json:"old_pwd"`     // 原密码
+	NewPwd     string `json:"new_pwd"`     // 新密码
+	VerifyCode string `json:"verify_code"` // 企微消息验证码
+}
+
+// pwdSession 自助修改密码会话 缓存在redis中
+type pwdSession struct {
+	Userid  string `json:"userid"`
+	Name    string `json:"name"`
+	Eid     string `json:"eid"`
+	Sam     string `json:"sam"`
+	Dn      string `json:"dn"`
+	Company string `json:"company"`
+}
+
+// Auth 企微OAuth认证 通过code获取企微用户 并通过工号映射到AD账号
+func (s *PwdService) Auth() serializer.Response {
+	userid, err := oauthUserid(s.Code)
+	if err != nil {
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrWeworkOAuth, err)
+	}
+
+	weworkUser, err := FetchUserById(userid)
+	if err != nil {
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrWeworkOAuth, err)
+	}
+	if len(weworkUser.Extattr.Attrs) < 1 || weworkUser.Extattr.Attrs[0].Name != "工号" || weworkUser.Extattr.Attrs[0].Value == "" {
+		return serializer.Err(serializer.CodeNotFound, "企业微信账号未维护工号，请联系管理员！", nil)
+	}
+	eid := weworkUser.Extattr.Attrs[0].Value
+
+	entry, err := ldapuser.FetchUserByNum(eid)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, serializer.ErrLdapUserNotFound, err)
+	}
+
+	session := pwdSession{
+		Userid:  userid,
+		Name:    weworkUser.Name,
+		Eid:     eid,
+		Sam:     entry.GetAttributeValue("sAMAccountName"),
+		Dn:      entry.DN,
+		Company: entry.GetAttributeValue("company"),
+	}
+	token, err := newToken()
+	if err != nil {
+		return serializer.Err(serializer.CodeEncryptError, "生成会话失败", err)
+	}
+	data, _ := json.Marshal(session)
+	if err = cache.SetEx(pwdSessionPrefix+token, data, pwdSessionExpire); err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, "生成会话失败", err)
+	}
+
+	return serializer.Response{Data: map[string]string{
+		"token": token,
+		"name":  session.Name,
+		"sam":   session.Sam,
+	}, Msg: "认证成功!"}
+}
+
+// Modify 自助修改密码 需校验原密码
+func (s *PwdService) Modify() serializer.Response {
+	session, err := fetchPwdSession(s.Token)
+	if err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, serializer.ErrPwdSessionExpired, err)
+	}
+
+	// 先原子计数再校验原密码 避免暴力尝试或故意锁定AD账号
+	trials, err := cache.IncrEx(pwdModifyPrefix+session.Userid, pwdTrialsExpire)
+	if err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, serializer.ErrOldPwd, err)
+	}
+	if trials > pwdResetMaxTrials {
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrOldPwdTrials, nil)
+	}
+	user := &ldapuser.LdapAttributes{Dn: session.Dn}
+	if err = user.CheckPwd(s.OldPwd); err != nil {
+		log.Log.Warning("自助修改密码:用户[" + session.Name + "]账号[" + session.Sam + "]原密码错误")
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrOldPwd, err)
+	}
+	_, _ = cache.Del(pwdModifyPrefix + session.Userid)
+
+	return s.setPwd(session)
+}
+
+// SendResetCode 通过企微应用消息发送重置密码验证码
+func (s *PwdService) SendResetCode() serializer.Response {
+	session, err := fetchPwdSession(s.Token)
+	if err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, serializer.ErrPwdSessionExpired, err)
+	}
+
+	ok, err := cache.SetNX(pwdSendPrefix+session.Userid, 1, pwdSendInterval)
+	if err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, "生成验证码失败", err)
+	}
+	if !ok {
+		return serializer.Err(serializer.CodeParamErr, serializer.ErrVerifyCodeFrequent, nil)
+	}
+
+	code, err := newVerifyCode()
+	if err != nil {
+		return serializer.Err(serializer.CodeEncryptError, "生成验证码失败", err)
+	}
+	if err = cache.SetEx(pwdResetPrefix+session.Userid, code, pwdResetExpire); err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, "生成验证码失败", err)
+	}
+
+	_, err = notify.Notify(notify.Recipient{Userid: session.Userid}, notify.EventPwdResetCode,
+		notify.Data{"Name": session.Name, "Code": code, "Minutes": strconv.Itoa(int(pwdResetExpire.Minutes()))})
+	if err != nil {
+		return serializer.Err(serializer.CodeCallbackError, serializer.ErrSendWeMsg, err)
+	}
+	log.Log.Info("企业微信回执消息:用户[" + session.Userid + "]姓名[" + session.Name + "]状态[重置密码验证码]")
+	return serializer.Response{Msg: "验证码已发送至企业微信!"}
+}
+
+// Reset 校验企微消息验证码后重置密码
+func (s *PwdService) Reset() serializer.Response {
+	session, err := fetchPwdSession(s.Token)
+	if err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, serializer.ErrPwdSessionExpired, err)
+	}
+
+	// 先原子计数再校验 并发请求也不能超过尝试次数 超过则作废验证码
+	trials, err := cache.IncrEx(pwdTrialsPrefix+session.Userid, pwdTrialsExpire)
+	if err != nil {
+		return serializer.Err(serializer.CodeCacheOperation, serializer.ErrVerifyCode, err)
+	}
+	if trials > pwdResetMaxTrials {
+		_, _ = cache.Del(pwdResetPrefix + session.Userid)
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrVerifyCodeTrials, nil)
+	}
+	code, err := cache.GetString(pwdResetPrefix + session.Userid)
+	if err != nil || s.VerifyCode == "" || code != s.VerifyCode {
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrVerifyCode, err)
+	}
+
+	res := s.setPwd(session)
+	if res.Code == 0 {
+		_, _ = cache.Del(pwdResetPrefix+session.Userid, pwdTrialsPrefix+session.Userid)
+	}
+	return res
+}
+
+// setPwd 按公司密码策略校验新密码并修改
+func (s *PwdService) setPwd(session pwdSession) serializer.Response {
+	if err := model.LdapFields.PwdPolicy(session.Company).Check(s.NewPwd); err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+
+	user := &ldapuser.LdapAttributes{Dn: session.Dn}
+	if err := user.ModifyPwd(s.NewPwd); err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "修改密码失败，新密码可能不满足域控密码历史策略！", err)
+	}
+	_, _ = cache.Del(pwdSessionPrefix + s.Token) // 修改成功后会话作废
+
+	log.Log.Info("自助修改密码:用户[" + session.Name + "]工号[" + session.Eid + "]账号[" + session.Sam + "]状态[修改成功]")
+	return serializer.Response{Msg: "密码修改成功，约五分钟内新旧密码均可使用!"}
+}
+
+// oauthUserid 通过企微OAuth回调的code获取企微userid
+func oauthUserid(code string) (string, error) {
+	res, err := model.CorpAPIMsg.GetUserInfoByCode(map[string]interface{}{
+		"code": code,
+	})
+	if err != nil {
+		return "", err
+	}
+	userid, _ := res["UserId"].(string)
+	if userid == "" { // 非企业成员
+		return "", errors.New("非企业成员")
+	}
+	return userid, nil
+}
+
+// fetchPwdSession 查询自助修改密码会话
+func fetchPwdSession(token string) (session pwdSession, err error) {
+	if token == "" {
+		err = errors.New(serializer.ErrPwdSessionExpired)
+		return
+	}
+	raw, err := cache.GetString(pwdSessionPrefix + token)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &session)
+	return
+}
+
+// FetchUserById 根据企微userid实时查询用户详情
+func FetchUserById(userid string) (userDetails UserDetails, err error) {
+	res, err := model.CorpAPIUserManager.UserGet(map[string]interface{}{
+		"userid": userid,
+	})
+	if err != nil {
+		return
+	}
+	b, _ := json.Marshal(res)
+	err = json.Unmarshal(b, &userDetails)
+	if err != nil {
+		return
+	}
+	if userDetails.Errcode != 0 {
+		err = errors.New(userDetails.Errmsg)
+	}
+	return
+}
+
+// newToken 生成随机会话token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newVerifyCode 生成6位数字验证码
+func newVerifyCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
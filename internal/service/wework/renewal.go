@@ -0,0 +1,126 @@
+package wework
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// RenewalApplyService 一键续期 请求参数
+type RenewalApplyService struct {
+	Token string `form:"token" json:"token"` // 卡片链接中的token
+	Code  string `json:"code"`               // 企微OAuth回调的code
+}
+
+// Fetch 查询链接中待续期的账号 仅展示 不提交审批
+func (s *RenewalApplyService) Fetch() serializer.Response {
+	apply, err := fetchRenewalApply(s.Token)
+	if err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, serializer.ErrRenewalApplyExpired, err)
+	}
+	return serializer.Response{Data: apply.Users}
+}
+
+// Apply 企微OAuth认证为卡片接收人本人后 以其身份提交账号续期审批 审批通过后由工单流程完成续期
+func (s *RenewalApplyService) Apply() serializer.Response {
+	apply, err := fetchRenewalApply(s.Token)
+	if err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, serializer.ErrRenewalApplyExpired, err)
+	}
+	userid, err := oauthUserid(s.Code)
+	if err != nil {
+		return serializer.Err(serializer.CodeCredentialInvalid, serializer.ErrWeworkOAuth, err)
+	}
+	if userid != apply.Userid {
+		log.Log.Warning("一键续期:用户[" + userid + "]尝试使用[" + apply.Userid + "]的续期链接")
+		return serializer.Err(serializer.CodeCredentialInvalid, "续期链接仅限卡片接收人本人使用！", nil)
+	}
+
+	rawCfg, err := cache.HGet("third_party_cfgs", "wework_renewal_apply")
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "读取三方系统-账号续期审批配置错误", err)
+	}
+	var cfg model.RenewalApplyCfg
+	if err = json.Unmarshal([]byte(rawCfg), &cfg); err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "读取三方系统-账号续期审批配置错误", err)
+	}
+
+	res, err := model.CorpAPIOrder.ApplyEvent(renewalApplyEvent(apply, cfg))
+	if err != nil {
+		return serializer.Err(serializer.CodeCallbackError, "提交账号续期审批失败", errors.Wrap(err, apply.Userid))
+	}
+	_, _ = cache.Del(model.RenewalApplyPrefix + s.Token) // 提交后链接作废
+
+	spNo, _ := res["sp_no"].(string)
+	log.Log.Info("一键续期:用户[" + apply.Userid + "]审批编号[" + spNo + "]状态[已提交账号续期审批]")
+	return serializer.Response{Data: spNo, Msg: "账号续期审批已提交，审批通过后自动续期!"}
+}
+
+// fetchRenewalApply 读取链接token对应的一键续期申请
+func fetchRenewalApply(token string) (apply model.RenewalApply, err error) {
+	if token == "" {
+		err = errors.New("缺少token")
+		return
+	}
+	raw, err := cache.GetString(model.RenewalApplyPrefix + token)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &apply)
+	return
+}
+
+// renewalApplyEvent 组装账号续期审批申请数据 控件与账号续期工单的待申请人员明细一致
+func renewalApplyEvent(apply model.RenewalApply, cfg model.RenewalApplyCfg) map[string]interface{} {
+	text := func(id, value string) map[string]interface{} {
+		return map[string]interface{}{
+			"control": "Text",
+			"id":      id,
+			"value":   map[string]interface{}{"text": value},
+		}
+	}
+
+	children := make([]map[string]interface{}, 0, len(apply.Users))
+	for _, u := range apply.Users {
+		children = append(children, map[string]interface{}{
+			"list": []map[string]interface{}{
+				text(cfg.NameId, u.Name),
+				text(cfg.EidId, u.Eid),
+				{
+					"control": "Selector",
+					"id":      cfg.PlatformId,
+					"value": map[string]interface{}{
+						"selector": map[string]interface{}{
+							"type":    "multi",
+							"options": []map[string]interface{}{{"key": cfg.PlatformKey}},
+						},
+					},
+				},
+				text(cfg.DaysId, cfg.Days),
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"creator_userid":        apply.Userid,
+		"template_id":           cfg.TemplateId,
+		"use_template_approver": 1,
+		"apply_data": map[string]interface{}{
+			"contents": []map[string]interface{}{
+				{
+					"control": "Table",
+					"id":      cfg.TableId,
+					"value":   map[string]interface{}{"children": children},
+				},
+			},
+		},
+		"summary_list": []map[string]interface{}{
+			{"summary_info": []map[string]interface{}{{"text": "账号续期", "lang": "zh_CN"}}},
+		},
+	}
+}
@@ -0,0 +1,323 @@
+package wework
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/internal/service/notify"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+const tagUsersBatch = 1000 // 增删标签成员每次最多1000人
+
+// TagRuleService 标签规则 请求参数
+type TagRuleService struct {
+	model.TagRule
+	DryRun bool `form:"dry_run" json:"dry_run"` // 只返回变化 不执行
+}
+
+// TagChange 单个标签的成员变化
+type TagChange struct {
+	TagId   int      `json:"tag_id"`
+	TagName string   `json:"tag_name"`
+	Add     []string `json:"add"`            // 待加入的企业微信userid
+	Remove  []string `json:"remove"`         // 待移出的企业微信userid
+	Held    string   `json:"held,omitempty"` // 移出人数超过阈值的原因 只加入不移出
+	Result  string   `json:"result,omitempty"`
+}
+
+// Fetch 查询全部标签规则
+func (s *TagRuleService) Fetch() serializer.Response {
+	rules, err := model.FetchTagRules()
+	if err != nil {
+		return serializer.DBErr("", err)
+	}
+	return serializer.Response{Data: rules}
+}
+
+// Create 校验后新增标签规则
+func (s *TagRuleService) Create() serializer.Response {
+	s.ID = 0
+	return s.save("增加成功!")
+}
+
+// Update 校验后修改标签规则
+func (s *TagRuleService) Update() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少标签规则id", nil)
+	}
+	return s.save("修改成功!")
+}
+
+// Delete 删除标签规则 标签成员保持不变
+func (s *TagRuleService) Delete() serializer.Response {
+	if s.ID == 0 {
+		return serializer.ParamErr("缺少标签规则id", nil)
+	}
+	if err := model.DeleteTagRule(s.ID); err != nil {
+		return serializer.DBErr("删除标签规则失败", err)
+	}
+	return serializer.Response{Data: s.ID, Msg: "删除成功!"}
+}
+
+// save 校验HR属性、匹配方式和企业微信标签 试用期标签由试用期流程维护 不能配置规则
+func (s *TagRuleService) save(msg string) serializer.Response {
+	rule := s.TagRule
+	if _, ok := hr.FieldValue(hr.User{}, rule.Field); !ok {
+		return serializer.ParamErr("未知的HR属性["+rule.Field+"]", nil)
+	}
+	if rule.Op != model.TagRuleEq && rule.Op != model.TagRulePrefix && rule.Op != model.TagRuleContains {
+		return serializer.ParamErr("未知的匹配方式["+rule.Op+"]", nil)
+	}
+	if rule.Value == "" {
+		return serializer.ParamErr("缺少匹配值", nil)
+	}
+	settings, _ := model.FetchCompanySettings()
+	for _, c := range settings {
+		if c.WeworkTagId != 0 && c.WeworkTagId == rule.TagId {
+			return serializer.ParamErr("标签["+c.WeworkTagName+"]是公司["+c.Company+"]的试用期标签", nil)
+		}
+	}
+	tagsMsg, err := FetchTags()
+	if err != nil {
+		return serializer.Err(serializer.CodeParamErr, "查询企业微信标签失败", err)
+	}
+	rule.TagName = ""
+	for _, t := range tagsMsg.Taglist {
+		if t.Tagid == rule.TagId {
+			rule.TagName = t.Tagname
+		}
+	}
+	if rule.TagName == "" {
+		return serializer.ParamErr("企业微信标签["+strconv.Itoa(rule.TagId)+"]不存在", nil)
+	}
+	if err = model.SaveTagRule(&rule); err != nil {
+		return serializer.DBErr("保存标签规则失败", err)
+	}
+	return serializer.Response{Data: rule, Msg: msg}
+}
+
+// Apply 按标签规则更新标签成员 dry_run时只返回变化
+func (s *TagRuleService) Apply() serializer.Response {
+	changes, err := BuildTagChanges()
+	if err != nil {
+		return serializer.Err(serializer.CodeParamErr, "生成标签变化失败", err)
+	}
+	if !s.DryRun {
+		applyTagChanges(changes)
+	}
+	return serializer.Response{Data: changes}
+}
+
+// ApplyTagRules 按标签规则更新标签成员 有变化时发机器人消息
+func ApplyTagRules() {
+	changes, err := BuildTagChanges()
+	if err != nil {
+		log.Log.Error("生成标签变化错误: ", err)
+		return
+	}
+	if len(changes) == 0 {
+		log.Log.Info("标签成员无变化!")
+		return
+	}
+	applyTagChanges(changes)
+
+	msg := `<font color="warning"> 企业微信标签规则 </font>`
+	for _, c := range changes {
+		msg += fmt.Sprintf("\n>%s 加入%d 移出%d", c.TagName, len(c.Add), len(c.Remove))
+		if c.Result != "成功" {
+			msg += ` <font color="warning">` + c.Result + `</font>`
+		}
+	}
+	notify.Robot(msg)
+	log.Log.Info("按标签规则更新标签成员完成!")
+}
+
+// BuildTagChanges 对比标签规则匹配的HR在职员工与企业微信标签现有成员 生成变化
+func BuildTagChanges() (changes []TagChange, err error) {
+	rules, err := model.FetchTagRules()
+	if err != nil {
+		return
+	}
+	// 缓存为空(如redis重启、刷新失败)时所有标签都会被清空 不生成变化
+	rawHrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		return nil, errors.Wrap(err, serializer.ErrFetchLDAPUserCache)
+	}
+	if len(rawHrUsers) == 0 {
+		return nil, errors.New("HR用户缓存为空")
+	}
+	var hrUsers []hr.User
+	for _, v := range rawHrUsers {
+		var u hr.User
+		if json.Unmarshal([]byte(v), &u) == nil {
+			hrUsers = append(hrUsers, u)
+		}
+	}
+	userids := make(map[string]string) // 工号->企业微信userid
+	rawWeworkUsers, err := cache.HGetAll("wework_users")
+	if err != nil {
+		return nil, errors.Wrap(err, "读取企业微信用户缓存错误")
+	}
+	if len(rawWeworkUsers) == 0 {
+		return nil, errors.New("企业微信用户缓存为空")
+	}
+	for eid, v := range rawWeworkUsers {
+		var u UserDetails
+		if json.Unmarshal([]byte(v), &u) == nil {
+			userids[eid] = u.Userid
+		}
+	}
+
+	want := matchTagRules(rules, hrUsers, userids)
+	current := make(map[int]map[string]bool, len(want))
+	for tagId := range want {
+		members, err := FetchTagUsers(tagId)
+		if err != nil {
+			return nil, errors.Wrap(err, "读取企业微信标签["+strconv.Itoa(tagId)+"]成员错误")
+		}
+		current[tagId] = make(map[string]bool, len(members))
+		for _, m := range members {
+			current[tagId][m.Userid] = true
+		}
+	}
+	changes = diffTagMembers(rules, want, current)
+	holdTagRemovals(changes, current, model.TagRuleCfg)
+	return changes, nil
+}
+
+// matchTagRules 标签id->满足该标签任一启用规则且有企业微信账号的HR在职员工userid 只包含有启用规则的标签
+func matchTagRules(rules []model.TagRule, hrUsers []hr.User, userids map[string]string) map[int]map[string]bool {
+	want := make(map[int]map[string]bool)
+	for _, r := range rules {
+		if !r.Disabled && want[r.TagId] == nil {
+			want[r.TagId] = make(map[string]bool)
+		}
+	}
+	for _, u := range hrUsers {
+		userid, ok := userids[strings.TrimSpace(u.Eid)]
+		if !ok || u.Stat == hr.StatLeft {
+			continue
+		}
+		for _, r := range rules {
+			if !r.Disabled && matchTagRule(r, u) {
+				want[r.TagId][userid] = true
+			}
+		}
+	}
+	return want
+}
+
+// matchTagRule HR属性是否满足规则
+func matchTagRule(r model.TagRule, u hr.User) bool {
+	v, ok := hr.FieldValue(u, r.Field)
+	if !ok {
+		return false
+	}
+	v = strings.TrimSpace(v)
+	switch r.Op {
+	case model.TagRuleEq:
+		return v == r.Value
+	case model.TagRulePrefix: // 部门路径按层级匹配 避免"研发部"匹配到"研发部二"
+		return v == r.Value || strings.HasPrefix(v, r.Value) && (r.Field != "org_all" || strings.HasPrefix(v[len(r.Value):], "."))
+	case model.TagRuleContains:
+		return strings.Contains(v, r.Value)
+	}
+	return false
+}
+
+// diffTagMembers 对比应有成员与现有成员 按标签id排序
+func diffTagMembers(rules []model.TagRule, want, current map[int]map[string]bool) (changes []TagChange) {
+	names := make(map[int]string)
+	for _, r := range rules {
+		names[r.TagId] = r.TagName
+	}
+	for tagId, members := range want {
+		c := TagChange{TagId: tagId, TagName: names[tagId]}
+		for userid := range members {
+			if !current[tagId][userid] {
+				c.Add = append(c.Add, userid)
+			}
+		}
+		for userid := range current[tagId] {
+			if !members[userid] {
+				c.Remove = append(c.Remove, userid)
+			}
+		}
+		if len(c.Add)+len(c.Remove) == 0 {
+			continue
+		}
+		sort.Strings(c.Add)
+		sort.Strings(c.Remove)
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].TagId < changes[j].TagId })
+	return
+}
+
+// holdTagRemovals 移出人数占现有成员的比例超过阈值时不移出 避免缓存不完整时清空标签
+func holdTagRemovals(changes []TagChange, current map[int]map[string]bool, cfg model.TagRuleConfig) {
+	maxPercent := cfg.TagMaxRemovePercent()
+	if maxPercent < 0 {
+		return
+	}
+	for i := range changes {
+		c := &changes[i]
+		total := len(current[c.TagId])
+		if len(c.Remove) <= cfg.TagMinRemoveGuarded() || len(c.Remove)*100 <= maxPercent*total {
+			continue
+		}
+		c.Held = fmt.Sprintf("移出%d人 占现有%d人的%d%%超过阈值%d%% 未移出", len(c.Remove), total, len(c.Remove)*100/total, maxPercent)
+	}
+}
+
+// applyTagChanges 分批增删标签成员 结果写入Result
+func applyTagChanges(changes []TagChange) {
+	for i := range changes {
+		c := &changes[i]
+		var errs []string
+		for _, batch := range batches(c.Add) {
+			if _, err := model.CorpAPIUserManager.TagAddUser(map[string]interface{}{"tagid": c.TagId, "userlist": batch}); err != nil {
+				errs = append(errs, "加入: "+err.Error())
+			}
+		}
+		var remove []string
+		if c.Held == "" {
+			remove = c.Remove
+		} else {
+			errs = append(errs, c.Held)
+		}
+		for _, batch := range batches(remove) {
+			if _, err := model.CorpAPIUserManager.TagDeleteUser(map[string]interface{}{"tagid": c.TagId, "userlist": batch}); err != nil {
+				errs = append(errs, "移出: "+err.Error())
+			}
+		}
+		c.Result = "成功"
+		if len(errs) > 0 {
+			c.Result = strings.Join(errs, "; ")
+			log.Log.Error("更新企业微信标签["+c.TagName+"]成员错误: ", c.Result)
+		}
+		log.Log.Info("企业微信标签[", c.TagName, "] 加入", c.Add, " 移出", remove)
+	}
+}
+
+// batches 按每批最多人数拆分
+func batches(userids []string) (res [][]string) {
+	for len(userids) > tagUsersBatch {
+		res = append(res, userids[:tagUsersBatch])
+		userids = userids[tagUsersBatch:]
+	}
+	if len(userids) > 0 {
+		res = append(res, userids)
+	}
+	return
+}
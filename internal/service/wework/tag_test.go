@@ -0,0 +1,66 @@
+package wework
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+)
+
+func TestTagRules(t *testing.T) {
+	rules := []model.TagRule{
+		{Field: "org_all", Op: model.TagRulePrefix, Value: "集团.研发部", TagId: 1, TagName: "研发"},
+		{Field: "zmplans", Op: model.TagRuleContains, Value: "测试", TagId: 1, TagName: "研发"},
+		{Field: "company_code", Op: model.TagRuleEq, Value: "2700", TagId: 2, TagName: "子公司"},
+		{Field: "company_code", Op: model.TagRuleEq, Value: "2600", TagId: 3, TagName: "停用", Disabled: true},
+	}
+	hrUsers := []hr.User{
+		{Eid: "1", Department: "集团.研发部.平台组", CompanyCode: "2600"},
+		{Eid: "2", Department: "集团.研发部二", Title: "测试工程师", CompanyCode: "2700"},
+		{Eid: "3", Department: "集团.研发部二", CompanyCode: "2600"},
+		{Eid: "4", Department: "集团.研发部", Stat: hr.StatLeft},
+		{Eid: "5", Department: "集团.研发部"}, // 没有企业微信账号
+	}
+	userids := map[string]string{"1": "u1", "2": "u2", "3": "u3", "4": "u4"}
+
+	want := matchTagRules(rules, hrUsers, userids)
+	if !reflect.DeepEqual(want, map[int]map[string]bool{
+		1: {"u1": true, "u2": true},
+		2: {"u2": true},
+	}) {
+		t.Fatalf("got %v", want)
+	}
+
+	current := map[int]map[string]bool{
+		1: {"u1": true, "u3": true},
+		2: {"u2": true},
+	}
+	changes := diffTagMembers(rules, want, current)
+	if !reflect.DeepEqual(changes, []TagChange{{TagId: 1, TagName: "研发", Add: []string{"u2"}, Remove: []string{"u3"}}}) {
+		t.Errorf("got %+v", changes)
+	}
+}
+
+func TestHoldTagRemovals(t *testing.T) {
+	current := map[int]map[string]bool{1: {}, 2: {}}
+	for i := 0; i < 20; i++ {
+		current[1]["a"+strconv.Itoa(i)] = true
+		current[2]["b"+strconv.Itoa(i)] = true
+	}
+	changes := []TagChange{
+		{TagId: 1, Remove: []string{"a0", "a1", "a2", "a3"}},                   // 不超过5人不校验
+		{TagId: 2, Remove: []string{"b0", "b1", "b2", "b3", "b4", "b5", "b6"}}, // 35%
+	}
+	holdTagRemovals(changes, current, model.TagRuleConfig{})
+	if changes[0].Held != "" || changes[1].Held == "" {
+		t.Errorf("got %+v", changes)
+	}
+
+	changes[1].Held = ""
+	holdTagRemovals(changes, current, model.TagRuleConfig{MaxRemovePercent: -1})
+	if changes[1].Held != "" {
+		t.Errorf("负数不限制: got %+v", changes[1])
+	}
+}
@@ -2,9 +2,9 @@ package wework
 
 import (
 	"encoding/json"
-	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,6 +18,11 @@ import (
 	"gitee.com/RandolphCYG/akita/pkg/util"
 )
 
+const (
+	cacheWorkers    = 8     // 并发获取部门成员的数量
+	errUserNotFound = 60111 // 企业微信错误码 userid不存在
+)
+
 type Msg struct {
 	Errcode int    `json:"errcode"`
 	Errmsg  string `json:"errmsg"`
@@ -56,13 +61,6 @@ type User struct {
 	Department []int  `json:"department"`
 }
 
-// UsersMsg 获取用户列表消息
-type UsersMsg struct {
-	Userlist []User `json:"userlist"`
-	Errcode  int    `json:"errcode"`
-	Errmsg   string `json:"errmsg"`
-}
-
 // Depart 部门
 type Depart struct {
 	Id       int    `json:"id"`
@@ -78,6 +76,19 @@ type DepartsMsg struct {
 	Errmsg     string   `json:"errmsg"`
 }
 
+// Tag 标签
+type Tag struct {
+	Tagid   int    `json:"tagid"`
+	Tagname string `json:"tagname"`
+}
+
+// TagsMsg 获取标签列表消息
+type TagsMsg struct {
+	Taglist []Tag  `json:"taglist"`
+	Errcode int    `json:"errcode"`
+	Errmsg  string `json:"errmsg"`
+}
+
 // CacheUsersManual 手动触发缓存企微用户
 func CacheUsersManual() serializer.Response {
 	go func() {
@@ -86,60 +97,193 @@ func CacheUsersManual() serializer.Response {
 	return serializer.Response{Data: 0, Msg: "手动触发缓存企微用户成功!"}
 }
 
-// CacheUsers 缓存企业微信用户
+// CacheUsers 按部门并发获取成员详情 写入带版本的新键后用RENAME原子替换wework_users和wework_users_invalid
+// 任一部门获取失败时保留原缓存
 func CacheUsers() {
 	log.Log.Info("开始更新企微用户缓存...")
-	var usersMsg UsersMsg
-	res, err := model.CorpAPIUserManager.UserSimpleList(map[string]interface{}{
-		"department_id": "1",
-		"fetch_child":   "1",
-	})
+	users, err := fetchAllUsers()
 	if err != nil {
-		log.Log.Error("Fail to get wework user list:", err)
+		log.Log.Error("获取企业微信成员错误 保留原缓存: ", err)
+		return
+	}
+
+	valid := make(map[string]interface{})   // 工号->成员详情
+	invalid := make(map[string]interface{}) // 没有工号扩展属性的成员 userid->成员详情 供身份核对
+	var identities []model.Identity
+	for userid, raw := range users {
+		var u UserDetails
+		if json.Unmarshal(raw, &u) != nil {
+			continue
+		}
+		if eid := userEid(u); eid != "" {
+			valid[eid] = []byte(raw)
+			identities = append(identities, model.Identity{Eid: eid, Name: u.Name, WeworkUserid: userid})
+		} else {
+			invalid[userid] = []byte(raw)
+		}
 	}
 
-	temp, _ := json.Marshal(res)
-	err = json.Unmarshal(temp, &usersMsg)
+	version := time.Now().Format("20060102150405")
+	for key, data := range map[string]map[string]interface{}{"wework_users": valid, "wework_users_invalid": invalid} {
+		if err = replaceHash(key, key+":"+version, data); err != nil {
+			log.Log.Error("替换企微用户缓存["+key+"]错误: ", err)
+		}
+	}
+	if len(identities) > 0 {
+		if err = model.SaveIdentities(identities, "wework_userid"); err != nil {
+			log.Log.Error("登记企业微信userid错误: ", err)
+		}
+	}
+	log.Log.Info("更新企微用户缓存完成! 有工号", len(valid), "人 无工号", len(invalid), "人")
+}
+
+// fetchAllUsers 按部门并发调用user/list 不递归子部门 同一成员在多个部门时只保留一份 返回userid->成员详情json
+func fetchAllUsers() (users map[string]json.RawMessage, err error) {
+	departsMsg, err := FetchDeparts()
 	if err != nil {
 		return
 	}
 
-	if usersMsg.Errcode != 0 {
-		err = errors.Wrap(err, serializer.ErrFetchWeUserList+usersMsg.Errmsg)
-		return
+	users = make(map[string]json.RawMessage)
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	ids := make(chan int)
+	for i := 0; i < cacheWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				list, e := fetchDepartUsers(id)
+				mu.Lock()
+				if e != nil && firstErr == nil {
+					firstErr = errors.Wrap(e, "部门["+strconv.Itoa(id)+"]")
+				}
+				for userid, raw := range list {
+					users[userid] = raw
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, d := range departsMsg.Department {
+		ids <- d.Id
 	}
+	close(ids)
+	wg.Wait()
+	return users, firstErr
+}
 
-	// 先清空缓存
-	_, err = cache.HDel("wework_users")
+// fetchDepartUsers 获取部门的直属成员详情
+func fetchDepartUsers(departId int) (users map[string]json.RawMessage, err error) {
+	res, err := model.CorpAPIUserManager.UserList(map[string]interface{}{
+		"department_id": strconv.Itoa(departId),
+		"fetch_child":   "0",
+	})
 	if err != nil {
-		log.Log.Error("Fail to clean wework users cache,:", err)
+		return
+	}
+	b, _ := json.Marshal(res)
+	var msg struct {
+		Userlist []json.RawMessage `json:"userlist"`
+	}
+	if err = json.Unmarshal(b, &msg); err != nil {
+		return
 	}
+	users = make(map[string]json.RawMessage, len(msg.Userlist))
+	for _, raw := range msg.Userlist {
+		var u struct {
+			Userid string `json:"userid"`
+		}
+		if json.Unmarshal(raw, &u) == nil && u.Userid != "" {
+			users[u.Userid] = raw
+		}
+	}
+	return
+}
 
-	done := make(chan int, 20) // 带 20 个缓存
-	for i, userInfo := range usersMsg.Userlist {
-		go func(i int, userInfo User) {
-			var userDetails UserDetails
-			getUserDetailRes, err := model.CorpAPIUserManager.UserGet(map[string]interface{}{
-				"userid": userInfo.Userid,
-			})
-			if err != nil {
-				log.Log.Error(err)
-			}
+// replaceHash 写入新键后原子替换 数据为空时直接删除原键
+func replaceHash(key, newKey string, data map[string]interface{}) (err error) {
+	if len(data) == 0 {
+		_, err = cache.Del(key)
+		return
+	}
+	if _, err = cache.HMSet(newKey, data); err != nil {
+		cache.Del(newKey)
+		return
+	}
+	if err = cache.Rename(newKey, key); err != nil {
+		cache.Del(newKey)
+	}
+	return
+}
+
+// userEid 成员的工号扩展属性 不符合规范的返回空
+func userEid(u UserDetails) string {
+	if len(u.Extattr.Attrs) >= 1 && u.Extattr.Attrs[0].Name == "工号" {
+		return u.Extattr.Attrs[0].Value
+	}
+	return ""
+}
 
-			temp, _ := json.Marshal(getUserDetailRes)
-			json.Unmarshal(temp, &userDetails)
+// userExpireDate 外部员工扩展属性中的过期日期 本公司员工为空
+func userExpireDate(u UserDetails) string {
+	if len(u.Extattr.Attrs) >= 2 && u.Extattr.Attrs[1].Name == "过期日期" {
+		return u.Extattr.Attrs[1].Value
+	}
+	return ""
+}
 
-			if len(userDetails.Extattr.Attrs) >= 1 && userDetails.Extattr.Attrs[0].Name == "工号" { // 忽略不符合规范的用户
-				_, err = cache.HSet("wework_users", userDetails.Extattr.Attrs[0].Value, temp) // 缓存用户
-				if err != nil {
-					log.Log.Error("Fail to cache wework user,:", err)
-				}
-			}
-			<-done
-		}(i, userInfo)
-		done <- 1
+// RefreshUser 通讯录变更回调时增量更新单个成员的缓存 成员已不存在时从缓存中移除
+func RefreshUser(userid string) (err error) {
+	res, err := model.CorpAPIUserManager.UserGet(map[string]interface{}{"userid": userid})
+	if err != nil {
+		if code, _ := res["errcode"].(float64); code == errUserNotFound {
+			RemoveCachedUser(userid)
+			return nil
+		}
+		return
+	}
+	raw, _ := json.Marshal(res)
+	var u UserDetails
+	if err = json.Unmarshal(raw, &u); err != nil {
+		return
+	}
+	RemoveCachedUser(userid) // 工号可能已修改 先移除旧的
+	if eid := userEid(u); eid != "" {
+		_, err = cache.HSet("wework_users", eid, raw)
+		if e := model.SaveIdentity(eid, map[string]interface{}{"wework_userid": userid}); e != nil {
+			log.Log.Error("登记企业微信userid["+userid+"]错误: ", e)
+		}
+	} else {
+		_, err = cache.HSet("wework_users_invalid", userid, raw)
+	}
+	return
+}
+
+// RemoveCachedUser 从缓存中移除成员 返回其工号 工号由身份登记的企业微信userid反查 缓存中的userid一致时才删除
+func RemoveCachedUser(userid string) (eid string) {
+	if _, err := cache.HDelFields("wework_users_invalid", userid); err != nil {
+		log.Log.Error("移除企微用户["+userid+"]缓存错误: ", err)
+	}
+	identities, err := model.FetchIdentities(model.Identity{WeworkUserid: userid})
+	if err != nil {
+		log.Log.Error("查询企微用户["+userid+"]身份错误: ", err)
+		return
 	}
-	log.Log.Info("更新企微用户缓存完成!")
+	for _, identity := range identities {
+		if u, err := FetchUser(identity.Eid); err != nil || u.Userid != userid { // 不在缓存或工号已属于其他成员
+			continue
+		}
+		if _, err = cache.HDelFields("wework_users", identity.Eid); err != nil {
+			log.Log.Error("移除企微用户["+userid+"]缓存错误: ", err)
+			continue
+		}
+		eid = identity.Eid
+	}
+	return
 }
 
 // FetchUser 根据工号查找用户
@@ -155,8 +299,11 @@ func FetchUser(eid string) (userDetails UserDetails, err error) {
 	return
 }
 
-// FetchDepart 通过HR部门名称及父部门名称获取唯一部门
+// FetchDepart 优先按部门同步保存的对应关系查找 否则通过HR部门名称及父部门名称获取唯一部门
 func FetchDepart(hrDepartName string) (depart Depart, err error) {
+	if m, e := model.FetchWeworkDepartMapping(strings.TrimSpace(hrDepartName)); e == nil {
+		return Depart{Id: m.DepartId, Name: m.Name}, nil
+	}
 	var departName, parentDepartName string
 	if len(strings.Split(hrDepartName, ".")) >= 1 {
 		departName = strings.Split(hrDepartName, ".")[len(strings.Split(hrDepartName, "."))-1]
@@ -240,6 +387,17 @@ func FetchDeparts() (departsMsg DepartsMsg, err error) {
 	return
 }
 
+// FetchTags 获取标签列表
+func FetchTags() (tagsMsg TagsMsg, err error) {
+	res, err := model.CorpAPIUserManager.TagGetList(map[string]interface{}{})
+	if err != nil {
+		return
+	}
+	b, _ := json.Marshal(res)
+	err = json.Unmarshal(b, &tagsMsg)
+	return
+}
+
 // CreateUser 创建企业微信用户
 func CreateUser(user *ldapuser.LdapAttributes) (err error) {
 	weworkUserInfos := map[string]interface{}{
@@ -283,12 +441,14 @@ func CreateUser(user *ldapuser.LdapAttributes) (err error) {
 	json.Unmarshal(b, &msg)
 	if msg.Errcode != 0 {
 		err = errors.New(msg.Errmsg)
+	} else {
+		model.SaveIdentity(user.Num, map[string]interface{}{"wework_userid": user.Sam})
 	}
 
 	// 打标签
-	if user.ProbationFlag == 1 {
+	if user.WeworkTagId != 0 {
 		weworkUserTagInfos := map[string]interface{}{
-			"tagid":    36,
+			"tagid":    user.WeworkTagId,
 			"userlist": []string{user.Sam},
 		}
 		var WeworkMsgTag Msg
@@ -297,7 +457,8 @@ func CreateUser(user *ldapuser.LdapAttributes) (err error) {
 		bTagRes, _ := json.Marshal(tagRes)
 		json.Unmarshal(bTagRes, &WeworkMsgTag)
 		if WeworkMsgTag.Errcode == 0 && WeworkMsgTag.Errmsg == "ok" {
-			log.Log.Info("已为[", user.DisplayName, "]打上[试用期员工]标签!")
+			log.Log.Info("已为[", user.DisplayName, "]打上[", user.WeworkTagName, "]标签!")
+			model.CreateProbationRecord(&model.ProbationRecord{Eid: user.Num, Name: user.DisplayName, Userid: user.Sam, TagId: user.WeworkTagId, TagName: user.WeworkTagName})
 		}
 	}
 
@@ -325,8 +486,9 @@ func ScanNewHrUsers() {
 	for _, hu := range hrUsers {
 		var hrUser hr.User
 		json.Unmarshal([]byte(hu), &hrUser) // 反序列化
-		// 判断如果企业微信没这个本公司用户，则进行创建，并记录到数据库这个操作
-		if hrUser.CompanyCode == "2600" && hrUser.Stat != "离职" {
+		// 判断如果企业微信没这个公司配置了HR公司代码的用户，则进行创建，并记录到数据库这个操作
+		setting, ok := model.FetchCompanySettingByHrCode(hrUser.CompanyCode)
+		if ok && hrUser.Stat != "离职" {
 			u, _ := FetchUser(strings.TrimSpace(hrUser.Eid)) // HR数据中有少数工号错误地加了空格 这里进行去除
 			if u.Name == "" {                                // 本公司新人
 				dp, _ := FetchDepart(hrUser.Department)
@@ -339,9 +501,10 @@ func ScanNewHrUsers() {
 						DisplayName:    hrUser.Name,
 						Email:          strings.ToLower(hrUser.Mail),
 						Phone:          hrUser.Mobile,
-						WeworkExpire:   "",
+						WeworkExpire:   expireStr(setting),
 						WeworkDepartId: dp.Id,
-						ProbationFlag:  1,
+						WeworkTagId:    setting.WeworkTagId,
+						WeworkTagName:  setting.WeworkTagName,
 					}
 					err = CreateUser(userInfos)
 					if err != nil {
@@ -359,23 +522,24 @@ func ScanNewHrUsers() {
 						DisplayName:    hrUser.Name,
 						Email:          strings.ToLower(hrUser.Mail),
 						Phone:          hrUser.Mobile,
-						WeworkExpire:   "",
-						WeworkDepartId: 69,
-						ProbationFlag:  1,
+						WeworkExpire:   expireStr(setting),
+						WeworkDepartId: setting.WeworkDepartId,
+						WeworkTagId:    setting.WeworkTagId,
+						WeworkTagName:  setting.WeworkTagName,
 					}
-					log.Log.Warning("未找到与该新用户[" + userInfos.DisplayName + "]的HR数据部门对应的同名企业微信部门！将用户暂存在待分配~")
-					recordMsg := "HR数据部门[" + hrUser.Department + "]分配至企业微信部门[69新加入待分配]"
+					log.Log.Warning("未找到与该新用户[" + userInfos.DisplayName + "]的HR数据部门对应的同名企业微信部门！将用户暂存在[" + setting.WeworkDepartName + "]~")
+					recordMsg := "HR数据部门[" + hrUser.Department + "]分配至企业微信部门[" + strconv.Itoa(setting.WeworkDepartId) + setting.WeworkDepartName + "]"
 					model.CreateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg)
 					err = CreateUser(userInfos)
 					if err != nil {
 						log.Log.Error("Fail to create wework automatically, ", err)
-						model.UpdateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, "HR数据部门["+hrUser.Department+"]分配至企微部门[69新加入待分配]", "自动创建失败, "+err.Error())
+						model.UpdateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg, "自动创建失败, "+err.Error())
 						break
 					}
 					// 消息自定义
-					if userInfos.ProbationFlag == 1 {
-						model.UpdateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg, "新用户 "+recordMsg+" Tag:[试用期员工]")
-						log.Log.Info("新用户 " + recordMsg + " Tag:[试用期员工]")
+					if userInfos.WeworkTagId != 0 {
+						model.UpdateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg, "新用户 "+recordMsg+" Tag:["+userInfos.WeworkTagName+"]")
+						log.Log.Info("新用户 " + recordMsg + " Tag:[" + userInfos.WeworkTagName + "]")
 					} else {
 						model.UpdateWeworkUserSyncRecord(userInfos.Sam, userInfos.DisplayName, userInfos.Num, recordMsg, "新用户 "+recordMsg)
 						log.Log.Info("新用户 " + recordMsg)
@@ -395,6 +559,14 @@ func ScanNewHrUsers() {
 	}
 }
 
+// expireStr 按公司配置的有效天数生成企业微信过期日期 永不过期为空
+func expireStr(setting model.CompanySetting) string {
+	if setting.ExpireDays <= 0 {
+		return ""
+	}
+	return util.ExpireStr(setting.ExpireDays)
+}
+
 // ScanExpiredUsersManual 手动触发扫描企业微信过期用户
 func ScanExpiredUsersManual() serializer.Response {
 	go func() {
@@ -419,9 +591,18 @@ func ScanExpiredUsers() {
 			var hrUser hr.User
 			json.Unmarshal([]byte(u), &hrUser) // 反序列化
 			if hrUser.Stat == "离职" {
-				weworkUser, _ := FetchUser(strings.TrimSpace(hrUser.Eid))
-				if weworkUser.Userid != "" { // 若发现HR数据中离职的用户 企业微信账号则干掉
-					DeleteUser(weworkUser) // 删除操作
+				eid := strings.TrimSpace(hrUser.Eid)
+				weworkUser, _ := FetchUser(eid)
+				if weworkUser.Userid == "" {
+					continue
+				}
+				// AD账号仍启用的由LDAP同步计划发起离职流程 以免绕过计划审批
+				if enabled, e := ldapuser.IsEnabled(eid); e != nil || enabled {
+					continue
+				}
+				// 若发现HR数据中离职的用户 企业微信账号进入离职流程 禁用并在保留期后删除
+				if _, e := model.CreateOffboardingTask(eid, hrUser.Name, hrUser.Department, "企业微信扫描"); e != nil {
+					log.Log.Error("创建离职任务错误: ", e)
 				}
 			}
 		}
@@ -451,65 +632,13 @@ func ScanExpiredUsers() {
 	_, _ = <-done, <-done
 	log.Log.Info("扫描内外部公司过期企业微信用户完成!")
 
-	// 汇总通知
-	now := time.Now()
-	// 若是周一 则将周末的处理结果一并发出
-	var weworkUserSyncRecords []model.WeworkUserSyncRecord
-	if util.IsMonday(now) {
-		weworkUserSyncRecords, _ = model.FetchWeworkUserSyncRecord(-2, 1)
-	} else {
-		weworkUserSyncRecords, _ = model.FetchWeworkUserSyncRecord(0, 1)
-	}
-
-	// 发消息
-	today := now.Format("2006年01月02日")
-	tempTitle := `<font color="warning"> ` + today + ` </font>企业微信用户变化：`
-	temp := `>%s. <font color="warning"> %s </font>账号<font color="comment"> %s </font>变化类别<font color="info"> %s </font>`
-	var msgs string
-	for i, u := range weworkUserSyncRecords {
-		if i != len(weworkUserSyncRecords) {
-			msgs += "\n\n"
-		}
-		msgs += fmt.Sprintf(temp, strconv.Itoa(i+1), u.Name, u.UserId, u.SyncKind)
-	}
-
-	// 根据是否为节假日决定是否发消息
-	if isSilent, _ := util.IsHolidaySilentMode(now); isSilent {
-		// 消息静默
-	} else {
-		// 工作日正常发送通知
-		if len(weworkUserSyncRecords) == 0 {
-			util.SendRobotMsg(`<font color="warning"> ` + today + ` </font>企业微信用户无变化`)
-		} else {
-			// 消息过长 作剪裁处理
-			msgs := util.TruncateMsg(tempTitle+msgs, "\n\n")
-			for _, m := range msgs {
-				util.SendRobotMsg(m)
-			}
-		}
-	}
-
-	log.Log.Info("汇总通知发送成功!")
 }
 
-// SendWeworkOuterUserExpiredMsg 给企业微信即将过期用户发送续期通知
+// SendWeworkOuterUserExpiredMsg 给企业微信即将过期用户发送带一键续期按钮的卡片
 func SendWeworkOuterUserExpiredMsg(user UserDetails, remainingDays int) {
-	renewalNotifyWeworkMsgTemplate, err := cache.HGet("wework_msg_templates", "wework_template_wework_renewal_notify")
+	err := ldapuser.SendRenewalCard(user.Userid, model.RenewalApplyUser{Name: user.Name, Eid: userEid(user), Days: remainingDays})
 	if err != nil {
-		log.Log.Error("读取企业微信消息模板错误: ", err)
-	}
-
-	msg := map[string]interface{}{
-		"touser":  user.Userid,
-		"msgtype": "markdown",
-		"agentid": model.WeworkUuapCfg.AppId,
-		"markdown": map[string]interface{}{
-			"content": fmt.Sprintf(renewalNotifyWeworkMsgTemplate, user.Name, strconv.Itoa(remainingDays)),
-		},
-	}
-	_, err = model.CorpAPIMsg.MessageSend(msg)
-	if err != nil {
-		err = errors.Wrap(err, serializer.ErrSendWeMsg)
+		log.Log.Error("给企业微信用户【"+user.Userid+"】发送即将过期卡片错误: ", err)
 		return
 	}
 	log.Log.Info("企业微信回执消息:企业微信用户【" + user.Userid + "】姓名【" + user.Name + "】状态【即将过期】")
@@ -534,6 +663,9 @@ func DisableUser(u UserDetails) (err error) {
 		log.Log.Error(err)
 		return
 	}
+	if msg.Errcode != 0 {
+		return errors.New(msg.Errmsg)
+	}
 	// 此处将禁用企业微信用户的记录保存下
 	if len(u.Extattr.Attrs) >= 1 && u.Extattr.Attrs[0].Name == "工号" {
 		model.CreateWeworkUserSyncRecord(u.Userid, u.Name, u.Extattr.Attrs[0].Value, "禁用")
@@ -543,6 +675,37 @@ func DisableUser(u UserDetails) (err error) {
 	return
 }
 
+// EnableUser 启用企业微信用户
+func EnableUser(u UserDetails) (err error) {
+	weworkUserInfos := map[string]interface{}{
+		"userid": u.Userid,
+		"enable": 1,
+	}
+	// 更新用户
+	var msg Msg
+	res, err := model.CorpAPIUserManager.UserUpdate(weworkUserInfos)
+	if err != nil {
+		return
+	}
+
+	b, err := json.Marshal(res)
+	err = json.Unmarshal(b, &msg)
+	if err != nil {
+		log.Log.Error(err)
+		return
+	}
+	if msg.Errcode != 0 {
+		return errors.New(msg.Errmsg)
+	}
+	// 此处将启用企业微信用户的记录保存下
+	if len(u.Extattr.Attrs) >= 1 && u.Extattr.Attrs[0].Name == "工号" {
+		model.CreateWeworkUserSyncRecord(u.Userid, u.Name, u.Extattr.Attrs[0].Value, "复职启用")
+	}
+
+	log.Log.Info("Success to enable wework user: " + u.Name + " " + u.Userid)
+	return
+}
+
 // DeleteUser 删除企业微信用户
 func DeleteUser(u UserDetails) (err error) {
 	weworkUserInfos := map[string]interface{}{
@@ -561,9 +724,13 @@ func DeleteUser(u UserDetails) (err error) {
 		log.Log.Error(err)
 		return
 	}
+	if msg.Errcode != 0 {
+		return errors.New(msg.Errmsg)
+	}
 	// 此处将删除企业微信用户的记录保存下
 	if len(u.Extattr.Attrs) >= 1 && u.Extattr.Attrs[0].Name == "工号" {
 		model.CreateWeworkUserSyncRecord(u.Userid, u.Name, u.Extattr.Attrs[0].Value, "删除")
+		model.SaveIdentity(u.Extattr.Attrs[0].Value, map[string]interface{}{"wework_userid": ""})
 	}
 
 	log.Log.Info("Success to delete wework user: " + u.Name + " " + u.Userid)
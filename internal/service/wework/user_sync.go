@@ -0,0 +1,204 @@
+package wework
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gitee.com/RandolphCYG/akita/internal/middleware/log"
+	"gitee.com/RandolphCYG/akita/internal/model"
+	"gitee.com/RandolphCYG/akita/pkg/cache"
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// 企业微信用户属性变化类别 记录在企微用户变化记录中
+const (
+	ChangeDepart   = "部门调整"
+	ChangePosition = "职务变更"
+	ChangeEmail    = "邮箱变更"
+	ChangeMobile   = "手机变更"
+	ChangeLeader   = "部门负责人变更"
+)
+
+// userChange 单个属性的变化
+type userChange struct {
+	Kind string
+	Old  string
+	New  string
+}
+
+// SyncUsersManual 手动触发同步企业微信用户属性
+func SyncUsersManual() serializer.Response {
+	go func() {
+		CacheUsers() // 更新企业微信缓存
+		SyncUsers()
+	}()
+	return serializer.Response{Data: 0, Msg: "手动触发同步企业微信用户属性成功!"}
+}
+
+// SyncUsers 以HR数据更新已有企业微信用户的部门、职务、邮箱、手机和部门负责人标识
+func SyncUsers() {
+	hrUsers, err := cache.HGetAll("hr_users")
+	if err != nil {
+		log.Log.Error(serializer.ErrFetchLDAPUserCache, err)
+		return
+	}
+
+	departIds := make(map[string]int) // HR部门路径->企业微信部门id 只按部门同步的对应关系调整部门
+	mappings, err := model.FetchWeworkDepartMappings()
+	if err != nil {
+		log.Log.Error("读取企业微信部门对应关系错误: ", err)
+		return
+	}
+	for _, m := range mappings {
+		departIds[m.Path] = m.DepartId
+	}
+
+	departNames := make(map[string]string) // 企业微信部门id->名称 用于变化记录
+	if departsMsg, e := FetchDeparts(); e == nil {
+		for _, d := range departsMsg.Department {
+			departNames[strconv.Itoa(d.Id)] = d.Name
+		}
+	}
+
+	var leaderTitles []string
+	if titles, _ := cache.HGet("third_party_cfgs", "wework_leader_titles"); titles != "" {
+		leaderTitles = strings.Split(titles, ",")
+	}
+
+	updated := 0
+	for _, hu := range hrUsers {
+		var hrUser hr.User
+		if json.Unmarshal([]byte(hu), &hrUser) != nil || !hasHrCompanySetting(hrUser.CompanyCode) || hrUser.Stat == hr.StatLeft {
+			continue
+		}
+		eid := strings.TrimSpace(hrUser.Eid)
+		u, err := FetchUser(eid)
+		if err != nil || u.Userid == "" {
+			continue
+		}
+
+		args, changes := diffUser(u, hrUser, departIds[strings.TrimSpace(hrUser.Department)], leaderTitles)
+		if len(changes) == 0 {
+			continue
+		}
+		args["userid"] = u.Userid
+		if _, err = model.CorpAPIUserManager.UserUpdate(args); err != nil {
+			log.Log.Error("更新企业微信用户["+u.Name+u.Userid+"]错误: ", err)
+			model.CreateWeworkUserSyncRecord(u.Userid, u.Name, eid, "属性同步失败, "+err.Error())
+			continue
+		}
+		for _, c := range changes {
+			if c.Kind == ChangeDepart {
+				c.Old, c.New = departNames[c.Old]+"("+c.Old+")", departNames[c.New]+"("+c.New+")"
+			}
+			model.CreateWeworkUserSyncRecord(u.Userid, u.Name, eid, c.Kind+" ["+c.Old+"]->["+c.New+"]")
+		}
+		applyUserArgs(&u, args)
+		if b, e := json.Marshal(u); e == nil {
+			_, _ = cache.HSet("wework_users", eid, b) // 避免缓存刷新前重复更新
+		}
+		updated++
+	}
+	log.Log.Info("同步企业微信用户属性完成! 更新", updated, "人")
+}
+
+// hasHrCompanySetting 只同步公司配置了HR公司代码的员工
+func hasHrCompanySetting(code string) bool {
+	_, ok := model.FetchCompanySettingByHrCode(code)
+	return ok
+}
+
+// diffUser 对比企业微信用户与HR数据 返回需更新的参数与变化
+// 部门只在HR部门有对应的企业微信部门时调整 仅替换主部门 保留其他部门
+// 手机和邮箱在企业微信未返回时(应用无权限读取)不更新 未配置负责人职务时不更新负责人标识
+func diffUser(u UserDetails, h hr.User, departId int, leaderTitles []string) (args map[string]interface{}, changes []userChange) {
+	args = make(map[string]interface{})
+
+	departs := append([]int(nil), u.Department...)
+	leaders := make([]int, len(departs))
+	copy(leaders, u.IsLeaderInDept)
+	main := indexOf(departs, u.MainDepartment)
+	if departId != 0 && u.MainDepartment != departId {
+		switch j := indexOf(departs, departId); {
+		case j >= 0: // 已在该部门 改为主部门 原主部门移除
+			if main >= 0 {
+				departs = append(departs[:main], departs[main+1:]...)
+				leaders = append(leaders[:main], leaders[main+1:]...)
+			}
+		case main >= 0:
+			departs[main], leaders[main] = departId, 0
+		default:
+			departs, leaders = append(departs, departId), append(leaders, 0)
+		}
+		main = indexOf(departs, departId)
+		args["department"], args["main_department"] = departs, departId
+		changes = append(changes, userChange{ChangeDepart, strconv.Itoa(u.MainDepartment), strconv.Itoa(departId)})
+	}
+	departChanged := len(changes) > 0
+
+	if title := strings.TrimSpace(h.Title); title != "" && title != u.Position {
+		args["position"] = title
+		changes = append(changes, userChange{ChangePosition, u.Position, title})
+	}
+	if mail := strings.ToLower(strings.TrimSpace(h.Mail)); mail != "" && u.Email != "" && mail != strings.ToLower(u.Email) {
+		args["email"] = mail
+		changes = append(changes, userChange{ChangeEmail, u.Email, mail})
+	}
+	if mobile := strings.TrimSpace(h.Mobile); mobile != "" && u.Mobile != "" && mobile != u.Mobile {
+		args["mobile"] = mobile
+		changes = append(changes, userChange{ChangeMobile, u.Mobile, mobile})
+	}
+
+	if len(leaderTitles) > 0 && main >= 0 {
+		leader := 0
+		for _, t := range leaderTitles {
+			if t = strings.TrimSpace(t); t != "" && strings.Contains(h.Title, t) {
+				leader = 1
+				break
+			}
+		}
+		if leaders[main] != leader {
+			changes = append(changes, userChange{ChangeLeader, strconv.Itoa(leaders[main]), strconv.Itoa(leader)})
+			leaders[main] = leader
+			departChanged = true
+		}
+	}
+	if departChanged { // 负责人标识与部门列表一一对应 需一起更新
+		args["department"], args["is_leader_in_dept"] = departs, leaders
+	}
+	return
+}
+
+// applyUserArgs 将已更新的参数写回企业微信用户
+func applyUserArgs(u *UserDetails, args map[string]interface{}) {
+	if v, ok := args["department"].([]int); ok {
+		u.Department = v
+	}
+	if v, ok := args["main_department"].(int); ok {
+		u.MainDepartment = v
+	}
+	if v, ok := args["is_leader_in_dept"].([]int); ok {
+		u.IsLeaderInDept = v
+	}
+	if v, ok := args["position"].(string); ok {
+		u.Position = v
+	}
+	if v, ok := args["email"].(string); ok {
+		u.Email = v
+	}
+	if v, ok := args["mobile"].(string); ok {
+		u.Mobile = v
+	}
+}
+
+// indexOf 查找部门id的位置
+func indexOf(ids []int, id int) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,55 @@
+package wework
+
+import (
+	"reflect"
+	"testing"
+
+	"gitee.com/RandolphCYG/akita/pkg/hr"
+)
+
+func TestDiffUser(t *testing.T) {
+	u := UserDetails{
+		Userid:         "zhangsan",
+		Position:       "工程师",
+		Email:          "ZhangSan@example.com",
+		Mobile:         "",
+		MainDepartment: 11,
+		Department:     []int{11, 30},
+		IsLeaderInDept: []int{0, 1},
+	}
+	h := hr.User{Title: "研发经理", Mail: "zhangsan@example.com", Mobile: "13800000000"}
+
+	args, changes := diffUser(u, h, 12, []string{"经理", "总监"})
+	kinds := make([]string, 0, len(changes))
+	for _, c := range changes {
+		kinds = append(kinds, c.Kind)
+	}
+	// 邮箱仅大小写不同 手机企业微信未返回 均不更新
+	if want := []string{ChangeDepart, ChangePosition, ChangeLeader}; !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("got changes %v, want %v", kinds, want)
+	}
+	if !reflect.DeepEqual(args["department"], []int{12, 30}) || args["main_department"] != 12 {
+		t.Errorf("got department %v main %v", args["department"], args["main_department"])
+	}
+	if !reflect.DeepEqual(args["is_leader_in_dept"], []int{1, 1}) {
+		t.Errorf("got is_leader_in_dept %v", args["is_leader_in_dept"])
+	}
+	if _, ok := args["email"]; ok {
+		t.Errorf("email should not be updated")
+	}
+
+	// 已在目标部门 只改主部门 未配置负责人职务时不修改负责人标识
+	u.Position = "研发经理"
+	args, changes = diffUser(u, h, 30, nil)
+	if len(changes) != 1 || changes[0].Kind != ChangeDepart {
+		t.Fatalf("got changes %+v", changes)
+	}
+	if !reflect.DeepEqual(args["department"], []int{30}) || !reflect.DeepEqual(args["is_leader_in_dept"], []int{1}) {
+		t.Errorf("got department %v leaders %v", args["department"], args["is_leader_in_dept"])
+	}
+
+	// 部门没有对应关系时不调整
+	if _, changes = diffUser(u, h, 0, nil); len(changes) != 0 {
+		t.Errorf("got changes %+v, want none", changes)
+	}
+}
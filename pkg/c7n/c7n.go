@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/kirinlabs/HttpRequest"
@@ -139,6 +140,21 @@ func FetchProject(projectName string) (projectFields ProjectFields, err error) {
 	return
 }
 
+// FetchProjectById 按项目id在项目缓存中查询项目
+func FetchProjectById(id string) (projectFields ProjectFields, err error) {
+	projects, err := cache.HGetAll("c7n_projects")
+	if err != nil {
+		return
+	}
+	for _, p := range projects {
+		var project ProjectFields
+		if json.Unmarshal([]byte(p), &project) == nil && strconv.Itoa(project.Id) == id {
+			return project, nil
+		}
+	}
+	return projectFields, errors.New("C7N项目[" + id + "]不存在")
+}
+
 // FetchUser 根据真实姓名、登录名查询用户
 func FetchUser(realName, loginName string) (user UserFields, err error) {
 	// 取token
@@ -182,6 +198,43 @@ func FetchUser(realName, loginName string) (user UserFields, err error) {
 	return
 }
 
+// FetchUsers 分页查询所有用户
+func FetchUsers() (users []UserFields, err error) {
+	// 取token
+	header, err := GetToken()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetToken)
+		return
+	}
+
+	// 从缓存取url
+	c7nFetchUsers, err := cache.HGet("third_party_cfgs", "c7n_fetch_users")
+	if err != nil {
+		err = errors.New("读取三方系统-c7n配置错误: " + err.Error())
+		return
+	}
+
+	req := HttpRequest.NewRequest()
+	req.SetHeaders(header)
+	for page := 0; ; page++ {
+		respFetchUsers, e := req.Get(fmt.Sprintf(c7nFetchUsers, page, 500))
+		if e != nil {
+			return nil, errors.New("Fail to fetch c7n users, err: " + e.Error())
+		}
+		var userResp UserResp
+		e = respFetchUsers.Json(&userResp)
+		respFetchUsers.Close()
+		if e != nil {
+			return nil, errors.Wrap(e, serializer.ErrConvertRespToJson)
+		}
+		users = append(users, userResp.Content...)
+		if page+1 >= userResp.TotalPages {
+			break
+		}
+	}
+	return
+}
+
 // FetchRole 查询角色
 func FetchRole(roleName string) (role RoleFields, err error) {
 	// 取token
@@ -250,6 +303,87 @@ func AssignUserProjectRole(c7nProjectId string, c7nUserId string, c7nRoleIds []s
 	return
 }
 
+// DisableUser 禁用c7n用户
+func DisableUser(c7nUserId string) (err error) {
+	// 取token
+	header, err := GetToken()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetToken)
+		return
+	}
+
+	// 从缓存取url
+	c7nDisableUser, err := cache.HGet("third_party_cfgs", "c7n_disable_user")
+	if err != nil {
+		err = errors.New("读取三方系统-c7n配置错误: " + err.Error())
+		return
+	}
+
+	// 发送请求
+	req := HttpRequest.NewRequest()
+	req.SetHeaders(header)
+	respDisableUser, err := req.Put(fmt.Sprintf(c7nDisableUser, c7nUserId))
+	if err != nil {
+		err = errors.New("Fail to disable c7n user, err: " + err.Error())
+		return
+	}
+	defer respDisableUser.Close() // 关闭
+	if respDisableUser.StatusCode() >= 300 {
+		body, _ := respDisableUser.Content()
+		err = errors.New("Fail to disable c7n user, resp: " + body)
+	}
+	return
+}
+
+// FetchUserProjects 查询用户参与的项目
+func FetchUserProjects(c7nUserId string) (projects []ProjectFields, err error) {
+	// 取token
+	header, err := GetToken()
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrGetToken)
+		return
+	}
+
+	// 从缓存取url
+	c7nFetchUserProjects, err := cache.HGet("third_party_cfgs", "c7n_fetch_user_projects")
+	if err != nil {
+		err = errors.New("读取三方系统-c7n配置错误: " + err.Error())
+		return
+	}
+
+	// 发送请求
+	req := HttpRequest.NewRequest()
+	req.SetHeaders(header)
+	respFetchUserProjects, err := req.Get(fmt.Sprintf(c7nFetchUserProjects, c7nUserId))
+	if err != nil {
+		err = errors.New("Fail to fetch c7n user projects, err: " + err.Error())
+		return
+	}
+	defer respFetchUserProjects.Close() // 关闭
+
+	// 反序列化
+	err = respFetchUserProjects.Json(&projects)
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrConvertRespToJson)
+	}
+	return
+}
+
+// RemoveUserProjectRoles 移除用户在所有项目中的角色 返回涉及的项目名
+func RemoveUserProjectRoles(c7nUserId string) (names []string, err error) {
+	projects, err := FetchUserProjects(c7nUserId)
+	if err != nil {
+		return
+	}
+	for _, p := range projects {
+		if err = AssignUserProjectRole(strconv.Itoa(p.Id), c7nUserId, []string{}); err != nil {
+			return names, errors.Wrap(err, "移除项目["+p.Name+"]角色失败")
+		}
+		names = append(names, p.Name)
+	}
+	return
+}
+
 // SyncUsersManual 手动触发LDAP用户同步到C7N
 func SyncUsersManual() serializer.Response {
 	go func() {
@@ -86,6 +86,71 @@ func Get(key string) (res interface{}, err error) {
 	return
 }
 
+// SetEx 存string 并设置过期时间
+func SetEx(key string, value interface{}, expiration time.Duration) (err error) {
+	err = RedisClient.Set(ctx, key, value, expiration).Err()
+	if err != nil {
+		err = errors.New("Fail to cache data with expiration, err: " + err.Error())
+		return
+	}
+	return
+}
+
+// GetString 取string 原样返回
+func GetString(key string) (res string, err error) {
+	res, err = RedisClient.Get(ctx, key).Result()
+	return
+}
+
+// incrExScript 自增 首次自增时设置过期时间 保证计数一定会过期
+var incrExScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// IncrEx 原子自增 首次自增时设置过期时间 返回自增后的值
+func IncrEx(key string, expiration time.Duration) (res int64, err error) {
+	res, err = incrExScript.Run(ctx, RedisClient, []string{key}, expiration.Milliseconds()).Int64()
+	if err != nil {
+		err = errors.New("Fail to incr key, err: " + err.Error())
+		return
+	}
+	return
+}
+
+// SetNX 键不存在时存string并设置过期时间 返回是否设置成功
+func SetNX(key string, value interface{}, expiration time.Duration) (res bool, err error) {
+	res, err = RedisClient.SetNX(ctx, key, value, expiration).Result()
+	if err != nil {
+		err = errors.New("Fail to cache data if not exists, err: " + err.Error())
+		return
+	}
+	return
+}
+
+// Del 删除缓存项
+func Del(keys ...string) (res int64, err error) {
+	res, err = RedisClient.Del(ctx, keys...).Result()
+	if err != nil {
+		err = errors.New("Fail to delete keys, err: " + err.Error())
+		return
+	}
+	return
+}
+
+// Rename 重命名 新键已存在时被原子地覆盖
+func Rename(key, newKey string) (err error) {
+	err = RedisClient.Rename(ctx, key, newKey).Err()
+	if err != nil {
+		err = errors.New("Fail to rename key, err: " + err.Error())
+		return
+	}
+	return
+}
+
 /*
 以下是对hash操作的封装 将上下文参数隐藏 错误上抛
 */
@@ -120,6 +185,16 @@ func HDel(key string) (res int64, err error) {
 	return
 }
 
+// HDelFields hash 删除某些元素
+func HDelFields(key string, fields ...string) (res int64, err error) {
+	res, err = RedisClient.HDel(ctx, key, fields...).Result()
+	if err != nil {
+		err = errors.New("Fail to delete fields, err: " + err.Error())
+		return
+	}
+	return
+}
+
 // HGet hash 获取某个元素
 func HGet(key string, field string) (res string, err error) {
 	res, err = RedisClient.HGet(ctx, key, field).Result()
@@ -0,0 +1,82 @@
+package hr
+
+import (
+	"sort"
+)
+
+const (
+	StatLeft = "离职" // 离职状态
+)
+
+// Change 单个人员的某项变化
+type Change struct {
+	User User   `json:"user"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Changes 两份HR数据之间的人员变化
+type Changes struct {
+	Joiners        []User   `json:"joiners"`         // 入职 新出现或由离职恢复在职
+	Leavers        []User   `json:"leavers"`         // 离职 状态变为离职或从数据中消失
+	Transfers      []Change `json:"transfers"`       // 部门调动
+	TitleChanges   []Change `json:"title_changes"`   // 职务变化
+	CompanyChanges []Change `json:"company_changes"` // 公司变化
+}
+
+// Empty 是否没有任何变化
+func (c Changes) Empty() bool {
+	return len(c.Joiners)+len(c.Leavers)+len(c.Transfers)+len(c.TitleChanges)+len(c.CompanyChanges) == 0
+}
+
+// Diff 按工号对比新旧两份HR数据 结果按工号排序
+func Diff(oldUsers, newUsers []User) (changes Changes) {
+	olds := make(map[string]User, len(oldUsers))
+	for _, u := range oldUsers {
+		olds[u.Eid] = u
+	}
+	news := make(map[string]User, len(newUsers))
+	for _, u := range newUsers {
+		news[u.Eid] = u
+	}
+
+	for eid, n := range news {
+		o, ok := olds[eid]
+		switch {
+		case n.Stat == StatLeft:
+			if ok && o.Stat != StatLeft {
+				changes.Leavers = append(changes.Leavers, n)
+			}
+			continue
+		case !ok || o.Stat == StatLeft:
+			changes.Joiners = append(changes.Joiners, n)
+			continue
+		}
+		if o.Department != n.Department {
+			changes.Transfers = append(changes.Transfers, Change{User: n, Old: o.Department, New: n.Department})
+		}
+		if o.Title != n.Title {
+			changes.TitleChanges = append(changes.TitleChanges, Change{User: n, Old: o.Title, New: n.Title})
+		}
+		if o.CompanyName != n.CompanyName {
+			changes.CompanyChanges = append(changes.CompanyChanges, Change{User: n, Old: o.CompanyName, New: n.CompanyName})
+		}
+	}
+	for eid, o := range olds {
+		if _, ok := news[eid]; !ok && o.Stat != StatLeft {
+			changes.Leavers = append(changes.Leavers, o)
+		}
+	}
+
+	sortUsers(changes.Joiners)
+	sortUsers(changes.Leavers)
+	for _, c := range [][]Change{changes.Transfers, changes.TitleChanges, changes.CompanyChanges} {
+		sort.Slice(c, func(i, j int) bool { return c[i].User.Eid < c[j].User.Eid })
+	}
+	return
+}
+
+// sortUsers 按工号排序
+func sortUsers(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Eid < users[j].Eid })
+}
@@ -0,0 +1,29 @@
+package hr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	oldUsers := []User{
+		{Eid: "1", Name: "张三", Department: "公司.研发部", Title: "工程师", CompanyName: "A"},
+		{Eid: "2", Name: "李四", Department: "公司.财务部"},
+		{Eid: "3", Name: "王五", Department: "公司.行政部"},
+		{Eid: "5", Name: "孙七", Stat: StatLeft},
+	}
+	newUsers := []User{
+		{Eid: "1", Name: "张三", Department: "公司.测试部", Title: "高级工程师", CompanyName: "B"},
+		{Eid: "2", Name: "李四", Department: "公司.财务部", Stat: StatLeft},
+		{Eid: "4", Name: "赵六", Department: "公司.研发部"},
+		{Eid: "5", Name: "孙七"},
+	}
+	changes := Diff(oldUsers, newUsers)
+	assert.Equal(t, []User{newUsers[2], newUsers[3]}, changes.Joiners)
+	assert.Equal(t, []User{newUsers[1], oldUsers[2]}, changes.Leavers)
+	assert.Equal(t, []Change{{User: newUsers[0], Old: "公司.研发部", New: "公司.测试部"}}, changes.Transfers)
+	assert.Equal(t, []Change{{User: newUsers[0], Old: "工程师", New: "高级工程师"}}, changes.TitleChanges)
+	assert.Equal(t, []Change{{User: newUsers[0], Old: "A", New: "B"}}, changes.CompanyChanges)
+	assert.True(t, Diff(newUsers, newUsers).Empty())
+}
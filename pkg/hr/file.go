@@ -0,0 +1,85 @@
+package hr
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xuri/excelize/v2"
+)
+
+// FileSource CSV/XLSX文件数据源 首行为表头
+type FileSource struct {
+	Path    string
+	Sheet   string
+	Mapping map[string]string
+}
+
+// FetchUsers 读取文件中的用户
+func (f *FileSource) FetchUsers() (users []User, err error) {
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(f.Path)) {
+	case ".csv":
+		rows, err = f.readCsv()
+	case ".xlsx":
+		rows, err = f.readXlsx()
+	default:
+		err = errors.New("不支持的HR数据文件类型: " + f.Path)
+	}
+	if err != nil {
+		return
+	}
+	return mapUsers(rowsToRecords(rows), f.Mapping), nil
+}
+
+// readCsv 读取csv 兼容带BOM的utf-8文件
+func (f *FileSource) readCsv() (rows [][]string, err error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	rows, err = r.ReadAll()
+	if err == nil && len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return
+}
+
+// readXlsx 读取xlsx的指定工作表
+func (f *FileSource) readXlsx() (rows [][]string, err error) {
+	file, err := excelize.OpenFile(f.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	sheet := f.Sheet
+	if sheet == "" {
+		sheet = file.GetSheetName(0)
+	}
+	return file.GetRows(sheet)
+}
+
+// rowsToRecords 以首行为表头 将行转换为记录
+func rowsToRecords(rows [][]string) (records []map[string]string) {
+	if len(rows) < 2 {
+		return
+	}
+	header := rows[0]
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		for i, h := range header {
+			if i < len(row) {
+				record[strings.TrimSpace(h)] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
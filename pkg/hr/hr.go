@@ -1,12 +1,26 @@
 package hr
 
 import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"gitee.com/RandolphCYG/akita/pkg/serializer"
 	"github.com/pkg/errors"
 
 	"github.com/kirinlabs/HttpRequest"
 )
 
+const (
+	fetchRetries = 3 // 每页最多请求次数
+)
+
+var (
+	// ErrIncrementalUnsupported 数据源不支持增量查询
+	ErrIncrementalUnsupported = errors.New("HR数据源不支持增量查询")
+)
+
 // TokenResp 获取token接口返回数据结构体
 type TokenResp struct {
 	// 正确时候
@@ -54,6 +68,10 @@ type HrDataConn struct {
 	UrlGetToken string `json:"url_get_token" gorm:"type:varchar(255);not null;comment:获取token的地址"`
 	// 获取 数据 的URL
 	UrlGetData string `json:"url_get_data" gorm:"type:varchar(255);not null;comment:获取数据的地址"`
+	// 每页条数 0表示使用接口默认值
+	PageSize int `json:"page_size" gorm:"type:int;not null;default:0;comment:每页条数 0使用接口默认值"`
+	// 增量查询参数名 为空表示接口不支持增量查询
+	SinceParam string `json:"since_param" gorm:"type:varchar(100);comment:增量查询参数名 为空表示不支持"`
 }
 
 // FetchToken 获取token
@@ -79,8 +97,81 @@ func (h *HrDataConn) FetchToken() (tokenResp TokenResp, err error) {
 	return
 }
 
-// FetchData 带着token去获取HR数据
+// FetchData 带着token逐页获取全量HR数据
 func (h *HrDataConn) FetchData() (users []User, err error) {
+	return h.fetchPages(nil)
+}
+
+// FetchChangedUsers 增量获取某时间之后变化的HR数据
+func (h *HrDataConn) FetchChangedUsers(since time.Time) (users []User, err error) {
+	if h.SinceParam == "" {
+		return nil, ErrIncrementalUnsupported
+	}
+	return h.fetchPages(url.Values{h.SinceParam: []string{since.Format("2006-01-02 15:04:05")}})
+}
+
+// fetchPages 逐页获取 每页失败重试 最后校验条数与TotalElements一致
+func (h *HrDataConn) fetchPages(params url.Values) (users []User, err error) {
+	first, err := h.fetchPage(params, 0, h.PageSize)
+	if err != nil {
+		return
+	}
+	users = append(users, first.Content...)
+	size := h.PageSize
+	if size == 0 {
+		size = first.Size
+	}
+	for page := first.Number + 1; page < first.TotalPages; page++ {
+		var resp DataResp
+		if resp, err = h.fetchPage(params, page, size); err != nil {
+			return nil, err
+		}
+		if resp.TotalElements != first.TotalElements {
+			return nil, errors.Errorf("%s第%d页总数%d与首页总数%d不一致", serializer.ErrFetchHrData, page, resp.TotalElements, first.TotalElements)
+		}
+		users = append(users, resp.Content...)
+	}
+
+	// 接口返回了分页信息时校验条数 防止漏页
+	if (first.TotalPages > 0 || first.TotalElements > 0) && len(users) != first.TotalElements {
+		return nil, errors.Errorf("%s收到%d条与总数%d不一致", serializer.ErrFetchHrData, len(users), first.TotalElements)
+	}
+	return
+}
+
+// fetchPage 获取一页数据 失败时重新获取token并重试
+func (h *HrDataConn) fetchPage(params url.Values, page, size int) (dataResp DataResp, err error) {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if size > 0 {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("size", strconv.Itoa(size))
+	}
+	dataUrl := h.UrlGetData
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(dataUrl, "?") {
+			sep = "&"
+		}
+		dataUrl += sep + query.Encode()
+	}
+
+	for i := 0; i < fetchRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 2 * time.Second)
+		}
+		if dataResp, err = h.postData(dataUrl); err == nil {
+			return
+		}
+	}
+	err = errors.Wrapf(err, "第%d页重试%d次仍失败", page, fetchRetries)
+	return
+}
+
+// postData 带着token请求一次数据接口
+func (h *HrDataConn) postData(dataUrl string) (dataResp DataResp, err error) {
 	req := HttpRequest.NewRequest()
 	hrToken, err := h.FetchToken()
 	if err != nil {
@@ -92,22 +183,21 @@ func (h *HrDataConn) FetchData() (users []User, err error) {
 	}
 	// 发送请求
 	req.SetHeaders(header)
-	respFetchData, err := req.Post(h.UrlGetData)
+	respFetchData, err := req.Post(dataUrl)
 	if err != nil {
 		err = errors.Wrap(err, serializer.ErrFetchHrData)
 		return
 	}
 
-	var dataResp DataResp
 	err = respFetchData.Json(&dataResp)
 	if err != nil {
-		return nil, err
+		err = errors.Wrap(err, serializer.ErrConvertRespToJson)
+		return
 	}
 	// 返回数据是否有报错字段
 	if dataResp.Result != "" {
-		err = errors.Wrap(err, serializer.ErrFetchHrData+dataResp.Result)
+		err = errors.New(serializer.ErrFetchHrData + dataResp.Result)
 		return
 	}
-	users = dataResp.Content
 	return
 }
@@ -0,0 +1,46 @@
+package hr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchDataPages(t *testing.T) {
+	all := []User{{Eid: "1"}, {Eid: "2"}, {Eid: "3"}, {Eid: "4"}, {Eid: "5"}}
+	total := len(all)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(TokenResp{AccessToken: "t", TokenType: "Bearer", Success: true})
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		end := (page + 1) * size
+		if end > len(all) {
+			end = len(all)
+		}
+		json.NewEncoder(w).Encode(DataResp{
+			Content:       all[page*size : end],
+			Number:        page,
+			Size:          size,
+			TotalElements: total,
+			TotalPages:    (len(all) + size - 1) / size,
+		})
+	}))
+	defer server.Close()
+
+	h := &HrDataConn{UrlGetToken: server.URL + "/token", UrlGetData: server.URL + "/data", PageSize: 2}
+	users, err := h.FetchData()
+	assert.Nil(t, err)
+	assert.Equal(t, all, users)
+
+	// 条数与TotalElements不一致时报错
+	total = 6
+	_, err = h.FetchData()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+package hr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kirinlabs/HttpRequest"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// HttpSource JSON接口数据源 按DataPath取出用户列表后按字段映射转换
+type HttpSource struct {
+	Url      string
+	Method   string
+	Headers  map[string]string
+	DataPath string
+	Mapping  map[string]string
+}
+
+// FetchUsers 请求接口中的用户
+func (h *HttpSource) FetchUsers() (users []User, err error) {
+	req := HttpRequest.NewRequest()
+	req.SetHeaders(h.Headers)
+	var resp *HttpRequest.Response
+	if strings.EqualFold(h.Method, "POST") {
+		resp, err = req.Post(h.Url)
+	} else {
+		resp, err = req.Get(h.Url)
+	}
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrFetchHrData)
+		return
+	}
+	body, err := resp.Body()
+	if err != nil {
+		return
+	}
+
+	var data interface{}
+	if err = json.Unmarshal(body, &data); err != nil {
+		err = errors.Wrap(err, serializer.ErrConvertRespToJson)
+		return
+	}
+	list, err := dataAtPath(data, h.DataPath)
+	if err != nil {
+		return
+	}
+
+	records := make([]map[string]string, 0, len(list))
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		record := make(map[string]string, len(obj))
+		for k, v := range obj {
+			if v != nil {
+				record[k] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+	return mapUsers(records, h.Mapping), nil
+}
+
+// dataAtPath 按.分隔的路径取出json中的列表
+func dataAtPath(data interface{}, path string) ([]interface{}, error) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := data.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("HR接口返回数据中不存在路径: " + path)
+			}
+			data = obj[key]
+		}
+	}
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, errors.New("HR接口返回数据路径[" + path + "]不是列表")
+	}
+	return list, nil
+}
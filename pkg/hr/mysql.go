@@ -0,0 +1,58 @@
+package hr
+
+import (
+	"database/sql"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	"gitee.com/RandolphCYG/akita/pkg/serializer"
+)
+
+// MysqlSource 数据库视图数据源 查询结果的列名按字段映射转换
+type MysqlSource struct {
+	Dsn     string
+	Query   string
+	Mapping map[string]string
+}
+
+// FetchUsers 查询视图中的用户
+func (m *MysqlSource) FetchUsers() (users []User, err error) {
+	db, err := sql.Open("mysql", m.Dsn)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(m.Query)
+	if err != nil {
+		err = errors.Wrap(err, serializer.ErrFetchHrData)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	var records []map[string]string
+	values := make([]sql.NullString, len(columns))
+	scans := make([]interface{}, len(columns))
+	for i := range values {
+		scans[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(scans...); err != nil {
+			return
+		}
+		record := make(map[string]string, len(columns))
+		for i, c := range columns {
+			record[c] = values[i].String
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	return mapUsers(records, m.Mapping), nil
+}
@@ -0,0 +1,112 @@
+package hr
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SourceApi   = "api"   // 默认HR接口 连接信息存于数据库
+	SourceFile  = "file"  // CSV/XLSX文件
+	SourceMysql = "mysql" // 数据库视图
+	SourceHttp  = "http"  // JSON接口
+)
+
+// HRSource HR数据源 各适配器返回统一的用户信息
+type HRSource interface {
+	FetchUsers() ([]User, error)
+}
+
+// IncrementalSource 支持增量查询的HR数据源
+type IncrementalSource interface {
+	FetchChangedUsers(since time.Time) ([]User, error)
+}
+
+// SourceCfg HR数据源配置 Mapping 的键为User的json字段名 值为数据源中的列名或字段名 未配置的字段按同名读取
+type SourceCfg struct {
+	Type        string            // 数据源类型 api file mysql http 为空时使用api
+	Incremental bool              // 数据源支持时 每天首次全量 之后只获取上次成功后变化的数据
+	Path        string            // file: 文件路径 按扩展名区分csv与xlsx
+	Sheet       string            // file: xlsx的工作表 为空时读取第一个
+	Dsn         string            // mysql: 连接串
+	Query       string            // mysql: 查询语句
+	Url         string            // http: 接口地址
+	Method      string            // http: 请求方法 为空时GET
+	Headers     map[string]string // http: 请求头
+	DataPath    string            // http: 用户列表在返回json中的路径 以.分隔 为空时返回值本身是列表
+	Mapping     map[string]string // 字段映射
+}
+
+// NewSource 根据配置创建数据源 api类型需传入数据库中的HR接口连接信息
+func NewSource(cfg SourceCfg, conn *HrDataConn) (HRSource, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", SourceApi:
+		if conn == nil || conn.UrlGetData == "" {
+			return nil, errors.New("HR接口连接信息为空")
+		}
+		return conn, nil
+	case SourceFile:
+		return &FileSource{Path: cfg.Path, Sheet: cfg.Sheet, Mapping: cfg.Mapping}, nil
+	case SourceMysql:
+		return &MysqlSource{Dsn: cfg.Dsn, Query: cfg.Query, Mapping: cfg.Mapping}, nil
+	case SourceHttp:
+		return &HttpSource{Url: cfg.Url, Method: cfg.Method, Headers: cfg.Headers, DataPath: cfg.DataPath, Mapping: cfg.Mapping}, nil
+	default:
+		return nil, errors.New("未知的HR数据源类型: " + cfg.Type)
+	}
+}
+
+// userFields User的json字段名及取值位置
+var userFields = []struct {
+	key string
+	ptr func(u *User) *string
+}{
+	{"company_code", func(u *User) *string { return &u.CompanyCode }},
+	{"company_name", func(u *User) *string { return &u.CompanyName }},
+	{"ename", func(u *User) *string { return &u.Name }},
+	{"org_all", func(u *User) *string { return &u.Department }},
+	{"pernr", func(u *User) *string { return &u.Eid }},
+	{"stat2", func(u *User) *string { return &u.Stat }},
+	{"usrid", func(u *User) *string { return &u.Mobile }},
+	{"usrid_long", func(u *User) *string { return &u.Mail }},
+	{"zmplans", func(u *User) *string { return &u.Title }},
+}
+
+// FieldValue 按json字段名取用户属性
+func FieldValue(u User, key string) (string, bool) {
+	for _, f := range userFields {
+		if f.key == key {
+			return *f.ptr(&u), true
+		}
+	}
+	return "", false
+}
+
+// mapUser 按字段映射将一条记录转换为用户信息
+func mapUser(record map[string]string, mapping map[string]string) (user User) {
+	for _, f := range userFields {
+		column := f.key
+		if c, ok := mapping[f.key]; ok && c != "" {
+			column = c
+		}
+		*f.ptr(&user) = strings.TrimSpace(record[column])
+	}
+	return
+}
+
+// mapUsers 批量转换 跳过没有工号的记录
+func mapUsers(records []map[string]string, mapping map[string]string) (users []User) {
+	for _, r := range records {
+		if u := mapUser(r, mapping); u.Eid != "" {
+			users = append(users, u)
+		}
+	}
+	return
+}
+
+// FetchUsers 默认HR接口 实现HRSource
+func (h *HrDataConn) FetchUsers() ([]User, error) {
+	return h.FetchData()
+}
@@ -0,0 +1,26 @@
+package hr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hr.csv")
+	content := "\ufeff工号,姓名,部门,状态\n1001,张三,公司.研发部,在职\n,无工号,公司,在职\n"
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+	source, err := NewSource(SourceCfg{
+		Type:    SourceFile,
+		Path:    path,
+		Mapping: map[string]string{"pernr": "工号", "ename": "姓名", "org_all": "部门", "stat2": "状态"},
+	}, nil)
+	assert.Nil(t, err)
+	users, err := source.FetchUsers()
+	assert.Nil(t, err)
+	// 没有工号的记录被跳过
+	assert.Equal(t, []User{{Eid: "1001", Name: "张三", Department: "公司.研发部", Stat: "在职"}}, users)
+}
@@ -10,6 +10,7 @@ var (
 	ErrUpdateUser                  = "根据缓存更新用户信息到服务端失败！"
 	ErrModifyUser                  = "修改用户信息失败！"
 	ErrCompanyNotExists            = "无此公司,请到LDAP服务器增加对应公司！"
+	ErrCompanySettingNotExists     = "无此公司配置,请在公司配置中增加："
 	ErrDeserialize                 = "反序列化错误！"
 	ErrFetchDB                     = "查询数据库错误！"
 	ErrNotFindUserInWeworkCache    = "企微缓存查询不到用户！"
@@ -20,6 +21,15 @@ var (
 	ErrGetToken                    = "获取token失败！"
 	ErrFetchHrData                 = "获取HR数据失败！"
 	ErrConvertRespToJson           = "Fail to convert response to json"
+	ErrWeworkOAuth                 = "企微身份认证失败！"
+	ErrPwdSessionExpired           = "会话已过期，请重新从企业微信进入页面！"
+	ErrVerifyCode                  = "验证码错误或已过期！"
+	ErrVerifyCodeTrials            = "验证码错误次数过多，请稍后再试！"
+	ErrVerifyCodeFrequent          = "验证码发送过于频繁，请稍后再试！"
+	ErrHrSnapshotStale             = "HR缓存未刷新，没有可对比的新快照！"
+	ErrOldPwd                      = "原密码错误！"
+	ErrOldPwdTrials                = "原密码错误次数过多，请稍后再试！"
+	ErrRenewalApplyExpired         = "续期链接已失效，请联系管理员提交账号续期审批！"
 )
 
 // Response 基础序列化器
@@ -0,0 +1,217 @@
+package util
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ambiguousBytes = "Il1O0o" // 易混淆字符
+	pwdMinLength   = 4
+	pwdMaxLength   = 64
+	pwdMaxRetry    = 100 // 命中禁用词典时的最大重新生成次数
+)
+
+var (
+	// DefaultPwdPolicy 默认密码策略 8位 至少包含三种字符
+	DefaultPwdPolicy = PwdPolicy{
+		Length:     8,
+		MinClasses: 3,
+	}
+)
+
+// PwdPolicy 密码策略
+type PwdPolicy struct {
+	Length           int      `json:"length"`            // 密码长度 生成时为固定长度 校验时为最小长度
+	MinClasses       int      `json:"min_classes"`       // 至少包含的字符种类数 小写、大写、数字、特殊字符
+	RequireLower     bool     `json:"require_lower"`     // 必须包含小写字母
+	RequireUpper     bool     `json:"require_upper"`     // 必须包含大写字母
+	RequireDigit     bool     `json:"require_digit"`     // 必须包含数字
+	RequireSpecial   bool     `json:"require_special"`   // 必须包含特殊字符
+	ExcludeAmbiguous bool     `json:"exclude_ambiguous"` // 生成时排除易混淆字符
+	Blacklist        []string `json:"blacklist"`         // 禁用词典 密码中不允许包含(忽略大小写)
+}
+
+// pwdClass 字符种类
+type pwdClass struct {
+	name     string
+	base     string
+	required bool
+	match    func(r rune) bool
+}
+
+// classes 按策略返回四种字符种类
+func (p PwdPolicy) classes() []pwdClass {
+	return []pwdClass{
+		{name: "小写字母", base: lowLetterBytes, required: p.RequireLower, match: unicode.IsLower},
+		{name: "大写字母", base: highLetterBytes, required: p.RequireUpper, match: unicode.IsUpper},
+		{name: "数字", base: digitBytes, required: p.RequireDigit, match: unicode.IsDigit},
+		{name: "特殊字符", base: characterBytes, required: p.RequireSpecial, match: func(r rune) bool {
+			return strings.ContainsRune(characterBytes, r)
+		}},
+	}
+}
+
+// Validate 校验密码策略本身是否合法
+func (p PwdPolicy) Validate() error {
+	if p.Length < pwdMinLength || p.Length > pwdMaxLength {
+		return errors.New("length is invalid")
+	}
+	if p.MinClasses < 0 || p.MinClasses > 4 {
+		return errors.New("min classes is invalid")
+	}
+	required := 0
+	for _, c := range p.classes() {
+		if c.required {
+			required++
+		}
+	}
+	if required > p.Length || p.MinClasses > p.Length {
+		return errors.New("length is too short for required classes")
+	}
+	return nil
+}
+
+// NewPwd 按策略生成密码 基于 crypto/rand
+func (p PwdPolicy) NewPwd() (pwd string, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+
+	// 参与生成的字符种类 默认四种全部参与
+	var pools []string
+	for _, c := range p.classes() {
+		if c.required {
+			pools = append(pools, p.filterAmbiguous(c.base))
+		}
+	}
+	if len(pools) < p.MinClasses || len(pools) == 0 {
+		pools = pools[:0]
+		for _, c := range p.classes() {
+			pools = append(pools, p.filterAmbiguous(c.base))
+		}
+	}
+	all := strings.Join(pools, "")
+
+	for i := 0; i < pwdMaxRetry; i++ {
+		b := make([]byte, p.Length)
+		// 每种字符至少一个
+		for j, pool := range pools {
+			if b[j], err = randByte(pool); err != nil {
+				return
+			}
+		}
+		for j := len(pools); j < p.Length; j++ {
+			if b[j], err = randByte(all); err != nil {
+				return
+			}
+		}
+		if err = shuffleBytes(b); err != nil {
+			return
+		}
+		pwd = string(b)
+		if p.hitBlacklist(pwd) == "" {
+			return pwd, nil
+		}
+	}
+	return "", errors.New("fail to generate pwd out of blacklist")
+}
+
+// Check 按策略校验密码 不满足时返回具体原因
+func (p PwdPolicy) Check(pwd string) error {
+	// 长度不满足
+	if len([]rune(pwd)) < p.Length {
+		return errors.Errorf("密码长度不能少于%d位", p.Length)
+	}
+	// 检查字符串元素复杂度
+	var flag []int
+	classes := p.classes()
+	for _, r := range pwd {
+		for i, c := range classes {
+			if c.match(r) {
+				flag = append(flag, i)
+				break
+			}
+		}
+	}
+	flag = removeRepeatedElement(flag)
+	for i, c := range classes {
+		if _, ok := findInt(flag, i); c.required && !ok {
+			return errors.New("密码必须包含" + c.name)
+		}
+	}
+	if len(flag) < p.MinClasses {
+		return errors.Errorf("密码至少包含小写字母、大写字母、数字、特殊字符(%s)中的%d种", characterBytes, p.MinClasses)
+	}
+	if word := p.hitBlacklist(pwd); word != "" {
+		return errors.New("密码不能包含常见弱口令[" + word + "]")
+	}
+	return nil
+}
+
+// filterAmbiguous 去除易混淆字符
+func (p PwdPolicy) filterAmbiguous(base string) string {
+	if !p.ExcludeAmbiguous {
+		return base
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(ambiguousBytes, r) {
+			return -1
+		}
+		return r
+	}, base)
+}
+
+// hitBlacklist 返回命中的禁用词 未命中返回空
+func (p PwdPolicy) hitBlacklist(pwd string) string {
+	lowerPwd := strings.ToLower(pwd)
+	for _, word := range p.Blacklist {
+		if word != "" && strings.Contains(lowerPwd, strings.ToLower(word)) {
+			return word
+		}
+	}
+	return ""
+}
+
+// NewPwd 复杂密码生成器 按默认策略生成指定长度的密码
+func NewPwd(length int) (string, error) {
+	p := DefaultPwdPolicy
+	p.Length = length
+	return p.NewPwd()
+}
+
+// randByte 从字符集中随机取一个字符
+func randByte(base string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(base))))
+	if err != nil {
+		return 0, err
+	}
+	return base[n.Int64()], nil
+}
+
+// shuffleBytes Fisher-Yates 洗牌
+func shuffleBytes(b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return err
+		}
+		j := n.Int64()
+		b[i], b[j] = b[j], b[i]
+	}
+	return nil
+}
+
+// findInt 判断整型切片是否有某元素
+func findInt(slice []int, val int) (int, bool) {
+	for i, item := range slice {
+		if item == val {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -2,12 +2,9 @@ package util
 
 import (
 	"encoding/json"
-	"fmt"
 	"math/rand"
 	"strings"
 	"time"
-	"unicode"
-	"unsafe"
 
 	"github.com/kirinlabs/HttpRequest"
 	"github.com/nosixtools/solarlunar/festival"
@@ -21,50 +18,8 @@ const (
 	digitBytes      = "1234567890"
 	lowLetterBytes  = "abcdefghijklmnopqrstuvwxyz"
 	highLetterBytes = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	letterIdxBits   = 6                    // 6 bits to represent a letter index
-	letterIdxMask   = 1<<letterIdxBits - 1 // All 1-bits, as many as letterIdxBits
-	letterIdxMax    = 63 / letterIdxBits   // # of letter indices fitting in 63 bits
 )
 
-// NewPwd 复杂密码生成器
-func NewPwd(length int) (string, error) {
-	// check length
-	if length < 4 || length > 25 {
-		return "", errors.New("length is invalid")
-	}
-	// assign elements from 4 kinds of base elements
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	factor := length / 4
-	b := make([]byte, length)
-	b = assignElement(lowLetterBytes, length, 1, b)
-	b = assignElement(highLetterBytes, length, factor*2, b)
-	b = assignElement(characterBytes, length, factor*3, b)
-	b = assignElement(digitBytes, length, factor*4, b)
-	// shuffle
-	rand.Shuffle(len(b), func(i, j int) {
-		i = r.Intn(length)
-		b[i], b[j] = b[j], b[i]
-	})
-	return *(*string)(unsafe.Pointer(&b)), nil
-}
-
-// assignElement 为密码分配元素
-func assignElement(base string, length int, factor int, b []byte) []byte {
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	for i, cacheValue, remain := length-factor, r.Int63(), letterIdxMax; i >= 0; {
-		if remain == 0 {
-			cacheValue, remain = r.Int63(), letterIdxMax
-		}
-		if idx := int(cacheValue & letterIdxMask); idx < len(base) {
-			b[i] = base[idx]
-			i--
-		}
-		cacheValue >>= letterIdxBits
-		remain--
-	}
-	return b
-}
-
 // SimpleNewPwd 复杂密码生成 简易实现方式
 func SimpleNewPwd(length int) (pwd string, err error) {
 	// check length
@@ -158,32 +113,9 @@ func getRandStr(baseStr string, length int) string {
 	return string(bytes)
 }
 
-// Judge 密码复杂度判断
+// Judge 密码复杂度判断 按默认密码策略校验
 func Judge(pwd string) bool {
-	// 长度不满足
-	if len(pwd) < 8 {
-		return false
-	}
-	// 检查字符串元素复杂度
-	var flag []int
-	for i := 0; i < len(pwd); i++ {
-		if unicode.IsLower(rune(pwd[i])) {
-			flag = append(flag, 1)
-		} else if unicode.IsDigit(rune(pwd[i])) {
-			flag = append(flag, 2)
-		} else if strings.Contains(characterBytes, string(pwd[i])) {
-			flag = append(flag, 3)
-		} else if unicode.IsUpper(rune(pwd[i])) {
-			flag = append(flag, 4)
-		}
-	}
-	// 复杂度标记切片去重
-	complexity := len(removeRepeatedElement(flag[:]))
-	if complexity >= 3 {
-		return true
-	} else {
-		return false
-	}
+	return DefaultPwdPolicy.Check(pwd) == nil
 }
 
 // removeRepeatedElement 数组去重 通过map键的唯一性去重
@@ -217,11 +149,11 @@ func IsExpire(expireDateStr string) bool {
 }
 
 // SendRobotMsg 发送机器人信息
-func SendRobotMsg(msg string) {
+func SendRobotMsg(msg string) (err error) {
 	// 从缓存取url
 	weworkRobotStaffChangesNotifier, err := cache.HGet("third_party_cfgs", "wework_robot_staff_changes_notifier")
 	if err != nil {
-		err = errors.New("读取三方系统-c7n配置错误: " + err.Error())
+		err = errors.New("读取三方系统-企微机器人配置错误: " + err.Error())
 		return
 	}
 	req := HttpRequest.NewRequest()
@@ -236,10 +168,20 @@ func SendRobotMsg(msg string) {
 	res, err := req.Post(weworkRobotStaffChangesNotifier, msgPkg)
 	if err != nil {
 		// 抛错
-		err = errors.New("Fail to fetch token, err: " + err.Error())
+		err = errors.New("Fail to send robot msg, err: " + err.Error())
 		return
 	}
-	fmt.Println(res.Content())
+	var robotResp struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err = res.Json(&robotResp); err != nil {
+		return
+	}
+	if robotResp.Errcode != 0 {
+		err = errors.New("Fail to send robot msg, err: " + robotResp.Errmsg)
+	}
+	return
 }
 
 // TruncateMsg 裁剪企业微信机器人消息 将长消息按行判断切分，返回消息切片
@@ -2,8 +2,10 @@ package util
 
 import (
 	"fmt"
-	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewPwd(t *testing.T) {
@@ -71,3 +73,37 @@ func TestMiddleNewPwd(t *testing.T) {
 	//// 测试密码复杂度
 	//assert.Equal(t, Judge(pwd3), true, "not satisfied!")
 }
+
+func TestPwdPolicy(t *testing.T) {
+	p := PwdPolicy{
+		Length:           12,
+		MinClasses:       4,
+		RequireLower:     true,
+		RequireUpper:     true,
+		RequireDigit:     true,
+		RequireSpecial:   true,
+		ExcludeAmbiguous: true,
+		Blacklist:        []string{"password", "123"},
+	}
+	for i := 0; i < 100; i++ {
+		pwd, err := p.NewPwd()
+		assert.Nil(t, err)
+		assert.Equal(t, 12, len(pwd))
+		// 测试密码复杂度
+		assert.Nil(t, p.Check(pwd), pwd)
+		assert.False(t, strings.ContainsAny(pwd, ambiguousBytes), pwd)
+	}
+
+	// 同一秒内生成的密码不应相同
+	pwd0, _ := NewPwd(8)
+	pwd1, _ := NewPwd(8)
+	assert.NotEqual(t, pwd0, pwd1)
+
+	assert.NotNil(t, p.Check("Aa1!Aa1!"))       // 长度不足
+	assert.NotNil(t, p.Check("abcdefgh12!?"))   // 缺少大写
+	assert.NotNil(t, p.Check("Password!2021x")) // 命中禁用词典
+	assert.Nil(t, p.Check("Tabby!Akita#7"))     // 满足策略
+
+	_, err := PwdPolicy{Length: 2}.NewPwd()
+	assert.NotNil(t, err)
+}
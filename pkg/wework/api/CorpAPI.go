@@ -45,7 +45,8 @@ var CORP_API_TYPE = map[string][]string{
 	"MENU_GET":    {"/cgi-bin/menu/get?access_token=ACCESS_TOKEN", "GET"},
 	"MENU_DELETE": {"/cgi-bin/menu/delete?access_token=ACCESS_TOKEN", "GET"},
 
-	"MESSAGE_SEND": {"/cgi-bin/message/send?access_token=ACCESS_TOKEN", "POST"},
+	"MESSAGE_SEND":                 {"/cgi-bin/message/send?access_token=ACCESS_TOKEN", "POST"},
+	"MESSAGE_UPDATE_TEMPLATE_CARD": {"/cgi-bin/message/update_template_card?access_token=ACCESS_TOKEN", "POST"},
 
 	"MEDIA_GET": {"/cgi-bin/media/get?access_token=ACCESS_TOKEN", "GET"},
 
@@ -58,6 +59,7 @@ var CORP_API_TYPE = map[string][]string{
 	"GET_CHECKIN_OPTION":  {"/cgi-bin/checkin/getcheckinoption?access_token=ACCESS_TOKEN", "POST"},
 	"GET_CHECKIN_DATA":    {"/cgi-bin/checkin/getcheckindata?access_token=ACCESS_TOKEN", "POST"},
 	"GET_APPROVAL_DETAIL": {"/cgi-bin/oa/getapprovaldetail?access_token=ACCESS_TOKEN", "POST"},
+	"APPLY_EVENT":         {"/cgi-bin/oa/applyevent?access_token=ACCESS_TOKEN", "POST"},
 
 	"GET_INVOICE_INFO":            {"/cgi-bin/card/invoice/reimburse/getinvoiceinfo?access_token=ACCESS_TOKEN", "POST"},
 	"UPDATE_INVOICE_STATUS":       {"/cgi-bin/card/invoice/reimburse/updateinvoicestatus?access_token=ACCESS_TOKEN", "POST"},
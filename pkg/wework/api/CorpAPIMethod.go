@@ -149,6 +149,10 @@ func (c *CorpAPI) MessageSend(args map[string]interface{}) (map[string]interface
 	return c.HttpCall(CORP_API_TYPE["MESSAGE_SEND"], args)
 }
 
+func (c *CorpAPI) MessageUpdateTemplateCard(args map[string]interface{}) (map[string]interface{}, error) {
+	return c.HttpCall(CORP_API_TYPE["MESSAGE_UPDATE_TEMPLATE_CARD"], args)
+}
+
 func (c *CorpAPI) GetUserDetail(args map[string]interface{}) (map[string]interface{}, error) {
 	return c.HttpCall(CORP_API_TYPE["GET_USER_DETAIL"], args)
 }
@@ -157,6 +161,10 @@ func (c *CorpAPI) GetApprovalDetail(args map[string]interface{}) (map[string]int
 	return c.HttpCall(CORP_API_TYPE["GET_APPROVAL_DETAIL"], args)
 }
 
+func (c *CorpAPI) ApplyEvent(args map[string]interface{}) (map[string]interface{}, error) {
+	return c.HttpCall(CORP_API_TYPE["APPLY_EVENT"], args)
+}
+
 func (c *CorpAPI) BatchUpdateInvoiceStatus(args map[string]interface{}) (map[string]interface{}, error) {
 	return c.HttpCall(CORP_API_TYPE["BATCH_UPDATE_INVOICE_STATUS"], args)
 }
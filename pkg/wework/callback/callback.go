@@ -0,0 +1,195 @@
+package callback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+* 企业微信回调消息加解密 https://developer.work.weixin.qq.com/document/path/90968
+* 签名为token、timestamp、nonce、密文排序拼接后的sha1 密文为AES-256-CBC 明文为16字节随机串+4字节消息长度+消息+ReceiveId
+*
+ */
+
+const blockSize = 32 // PKCS#7填充的块大小
+
+// Crypt 回调消息加解密
+type Crypt struct {
+	token     string
+	key       []byte
+	receiveId string // 企业ID
+}
+
+// Envelope 回调请求体
+type Envelope struct {
+	ToUserName string `xml:"ToUserName"`
+	AgentID    string `xml:"AgentID"`
+	Encrypt    string `xml:"Encrypt"`
+}
+
+// NewCrypt 以回调配置的Token、EncodingAESKey和企业ID创建
+func NewCrypt(token, encodingAesKey, receiveId string) (*Crypt, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAesKey + "=")
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("EncodingAESKey格式错误")
+	}
+	return &Crypt{token: token, key: key, receiveId: receiveId}, nil
+}
+
+// Signature 计算签名
+func (c *Crypt) Signature(timestamp, nonce, encrypt string) string {
+	parts := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyURL 校验回调地址 返回解密后的echostr
+func (c *Crypt) VerifyURL(msgSignature, timestamp, nonce, echostr string) ([]byte, error) {
+	if c.Signature(timestamp, nonce, echostr) != msgSignature {
+		return nil, errors.New("签名校验失败")
+	}
+	return c.Decrypt(echostr)
+}
+
+// DecryptMsg 校验签名并解密回调请求体 返回明文xml
+func (c *Crypt) DecryptMsg(msgSignature, timestamp, nonce string, body []byte) ([]byte, error) {
+	var env Envelope
+	if err := xml.Unmarshal(body, &env); err != nil {
+		return nil, errors.Wrap(err, "回调请求体格式错误")
+	}
+	if c.Signature(timestamp, nonce, env.Encrypt) != msgSignature {
+		return nil, errors.New("签名校验失败")
+	}
+	return c.Decrypt(env.Encrypt)
+}
+
+// Decrypt 解密密文 校验ReceiveId
+func (c *Crypt) Decrypt(encrypt string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, errors.Wrap(err, "密文格式错误")
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("密文长度错误")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, c.key[:aes.BlockSize]).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > blockSize || pad > len(plain) {
+		return nil, errors.New("填充错误")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, errors.New("明文长度错误")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+msgLen > len(plain) {
+		return nil, errors.New("消息长度错误")
+	}
+	if string(plain[20+msgLen:]) != c.receiveId {
+		return nil, errors.New("ReceiveId不匹配")
+	}
+	return plain[20 : 20+msgLen], nil
+}
+
+// Encrypt 加密消息 用于被动回复
+func (c *Crypt) Encrypt(msg []byte) (string, error) {
+	var buf bytes.Buffer
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	buf.Write(random)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+	buf.Write(msg)
+	buf.WriteString(c.receiveId)
+	pad := blockSize - buf.Len()%blockSize
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+	data := buf.Bytes()
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(data, data)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// ContactEvent 通讯录变更事件
+type ContactEvent struct {
+	ToUserName   string `xml:"ToUserName"`
+	FromUserName string `xml:"FromUserName"`
+	CreateTime   int64  `xml:"CreateTime"`
+	MsgType      string `xml:"MsgType"`
+	Event        string `xml:"Event"`      // change_contact
+	ChangeType   string `xml:"ChangeType"` // create_user update_user delete_user create_party update_party delete_party
+	UserID       string `xml:"UserID"`
+	NewUserID    string `xml:"NewUserID"` // 修改userid时的新userid
+	Name         string `xml:"Name"`
+	Department   string `xml:"Department"` // 成员部门id 逗号分隔
+	Position     string `xml:"Position"`
+	Mobile       string `xml:"Mobile"`
+	Email        string `xml:"Email"`
+	Id           int    `xml:"Id"` // 部门id
+	ParentId     string `xml:"ParentId"`
+}
+
+// ParseContactEvent 解析明文xml
+func ParseContactEvent(plain []byte) (event ContactEvent, err error) {
+	err = xml.Unmarshal(plain, &event)
+	return
+}
+
+// TemplateCardEvent 模板卡片事件 用户点击按钮或提交投票选择后推送到发送卡片的应用
+type TemplateCardEvent struct {
+	ToUserName    string         `xml:"ToUserName"`
+	FromUserName  string         `xml:"FromUserName"` // 点击的成员userid
+	CreateTime    int64          `xml:"CreateTime"`
+	MsgType       string         `xml:"MsgType"`
+	Event         string         `xml:"Event"`    // template_card_event
+	EventKey      string         `xml:"EventKey"` // 按钮key
+	TaskId        string         `xml:"TaskId"`
+	CardType      string         `xml:"CardType"`     // button_interaction vote_interaction
+	ResponseCode  string         `xml:"ResponseCode"` // 用于更新卡片 72小时内有效 只能使用一次
+	AgentID       int            `xml:"AgentID"`
+	SelectedItems []SelectedItem `xml:"SelectedItems>SelectedItem"`
+}
+
+// SelectedItem 投票选择
+type SelectedItem struct {
+	QuestionKey string   `xml:"QuestionKey"`
+	OptionIds   []string `xml:"OptionIds>OptionId"`
+}
+
+// ParseTemplateCardEvent 解析明文xml
+func ParseTemplateCardEvent(plain []byte) (event TemplateCardEvent, err error) {
+	err = xml.Unmarshal(plain, &event)
+	return
+}
+
+// Options 某个问题选中的选项id
+func (e TemplateCardEvent) Options(questionKey string) []string {
+	for _, item := range e.SelectedItems {
+		if item.QuestionKey == questionKey {
+			return item.OptionIds
+		}
+	}
+	return nil
+}
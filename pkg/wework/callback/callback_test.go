@@ -0,0 +1,68 @@
+package callback
+
+import (
+	"fmt"
+	"testing"
+)
+
+const testAesKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+
+func TestCryptRoundTrip(t *testing.T) {
+	c, err := NewCrypt("token", testAesKey, "ww0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := `<xml><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[change_contact]]></Event>` +
+		`<ChangeType><![CDATA[update_user]]></ChangeType><UserID><![CDATA[zhangsan]]></UserID><NewUserID><![CDATA[zhangsan1]]></NewUserID></xml>`
+	encrypt, err := c.Encrypt([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`<xml><ToUserName><![CDATA[ww0123456789]]></ToUserName><Encrypt><![CDATA[%s]]></Encrypt></xml>`, encrypt)
+
+	plain, err := c.DecryptMsg(c.Signature("1700000000", "nonce", encrypt), "1700000000", "nonce", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := ParseContactEvent(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ChangeType != "update_user" || event.UserID != "zhangsan" || event.NewUserID != "zhangsan1" {
+		t.Errorf("got %+v", event)
+	}
+
+	if _, err = c.DecryptMsg("bad", "1700000000", "nonce", []byte(body)); err == nil {
+		t.Error("expected signature error")
+	}
+	other, _ := NewCrypt("token", testAesKey, "ww_other")
+	if _, err = other.Decrypt(encrypt); err == nil {
+		t.Error("expected receive id error")
+	}
+
+	echo, err := c.VerifyURL(c.Signature("1", "2", encrypt), "1", "2", encrypt)
+	if err != nil || string(echo) != msg {
+		t.Errorf("VerifyURL got %q, %v", echo, err)
+	}
+}
+
+func TestParseTemplateCardEvent(t *testing.T) {
+	plain := `<xml><ToUserName><![CDATA[ww0123456789]]></ToUserName><FromUserName><![CDATA[lisi]]></FromUserName>` +
+		`<MsgType><![CDATA[event]]></MsgType><Event><![CDATA[template_card_event]]></Event><EventKey><![CDATA[renew]]></EventKey>` +
+		`<TaskId><![CDATA[task1]]></TaskId><CardType><![CDATA[vote_interaction]]></CardType><ResponseCode><![CDATA[code1]]></ResponseCode>` +
+		`<AgentID>1000002</AgentID><SelectedItems><SelectedItem><QuestionKey><![CDATA[accounts]]></QuestionKey>` +
+		`<OptionIds><OptionId><![CDATA[0]]></OptionId><OptionId><![CDATA[2]]></OptionId></OptionIds></SelectedItem></SelectedItems></xml>`
+	event, err := ParseTemplateCardEvent([]byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.FromUserName != "lisi" || event.TaskId != "task1" || event.ResponseCode != "code1" || event.AgentID != 1000002 {
+		t.Errorf("got %+v", event)
+	}
+	if got := event.Options("accounts"); len(got) != 2 || got[0] != "0" || got[1] != "2" {
+		t.Errorf("Options got %v", got)
+	}
+	if got := event.Options("other"); got != nil {
+		t.Errorf("Options got %v", got)
+	}
+}
@@ -0,0 +1,111 @@
+package card
+
+/*
+* 企业微信模板卡片消息 https://developer.work.weixin.qq.com/document/path/90236
+* 按钮交互型和投票选择型卡片 用户操作后以模板卡片事件回调发送卡片的应用 凭task_id对应到发送时的任务
+*
+ */
+
+const (
+	ButtonInteraction = "button_interaction" // 按钮交互型
+	VoteInteraction   = "vote_interaction"   // 投票选择型
+
+	MaxButtons = 6  // 按钮交互型最多按钮数
+	MaxOptions = 20 // 投票选择型最多选项数
+)
+
+// Card 卡片公共内容
+type Card struct {
+	Source   string // 来源描述 如应用名称
+	Title    string // 一级标题
+	Desc     string // 标题辅助信息
+	SubTitle string // 二级普通文本
+	TaskId   string // 任务id 同一应用内不可重复 最长128字节
+	Fields   []Field
+}
+
+// Field 二级标题+文本列表 最多6个
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Button 按钮
+type Button struct {
+	Text  string
+	Key   string // 回调事件中的EventKey
+	Style int    // 1蓝色 2灰色 3红色 4白色
+}
+
+// Option 投票选项
+type Option struct {
+	Id      string // 回调事件中的OptionId
+	Text    string
+	Checked bool
+}
+
+// body 卡片公共字段
+func (c Card) body(cardType string) map[string]interface{} {
+	body := map[string]interface{}{
+		"card_type":  cardType,
+		"main_title": map[string]interface{}{"title": c.Title, "desc": c.Desc},
+		"task_id":    c.TaskId,
+	}
+	if c.Source != "" {
+		body["source"] = map[string]interface{}{"desc": c.Source}
+	}
+	if c.SubTitle != "" {
+		body["sub_title_text"] = c.SubTitle
+	}
+	if len(c.Fields) > 0 {
+		fields := make([]map[string]interface{}, 0, len(c.Fields))
+		for _, f := range c.Fields {
+			fields = append(fields, map[string]interface{}{"keyname": f.Key, "value": f.Value})
+		}
+		body["horizontal_content_list"] = fields
+	}
+	return body
+}
+
+// ButtonCard 按钮交互型卡片
+func (c Card) ButtonCard(buttons ...Button) map[string]interface{} {
+	body := c.body(ButtonInteraction)
+	list := make([]map[string]interface{}, 0, len(buttons))
+	for _, b := range buttons {
+		list = append(list, map[string]interface{}{"text": b.Text, "style": b.Style, "key": b.Key})
+	}
+	body["button_list"] = list
+	return body
+}
+
+// VoteCard 多选的投票选择型卡片
+func (c Card) VoteCard(questionKey string, options []Option, submit Button) map[string]interface{} {
+	body := c.body(VoteInteraction)
+	list := make([]map[string]interface{}, 0, len(options))
+	for _, o := range options {
+		list = append(list, map[string]interface{}{"id": o.Id, "text": o.Text, "is_checked": o.Checked})
+	}
+	body["checkbox"] = map[string]interface{}{"question_key": questionKey, "option_list": list, "mode": 1}
+	body["submit_button"] = map[string]interface{}{"text": submit.Text, "key": submit.Key}
+	return body
+}
+
+// Message 应用消息
+func Message(userid string, agentId int, card map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"touser":        userid,
+		"msgtype":       "template_card",
+		"agentid":       agentId,
+		"template_card": card,
+	}
+}
+
+// Update 点击后将卡片按钮替换为不可点击的文案 responseCode为回调事件中的ResponseCode
+func Update(userid string, agentId int, responseCode, replaceName string) map[string]interface{} {
+	return map[string]interface{}{
+		"userids":       []string{userid},
+		"agentid":       agentId,
+		"response_code": responseCode,
+		"button":        map[string]interface{}{"replace_name": replaceName},
+	}
+}
@@ -0,0 +1,15 @@
+package web
+
+import (
+	_ "embed"
+)
+
+// PwdPage 企微自助修改/重置密码H5页面
+//
+//go:embed pwd.html
+var PwdPage []byte
+
+// RenewalPage 账号续期审批H5页面 展示待续期账号 确认后提交审批
+//
+//go:embed renewal.html
+var RenewalPage []byte